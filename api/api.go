@@ -7,9 +7,20 @@ import (
 )
 
 type Response struct {
-	Code    int    `json:"code,omitempty"`
-	Message string `json:"message,omitempty"`
-	Data    any    `json:"data,omitempty"`
+	Code    int            `json:"code,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Details []*ErrorDetail `json:"details,omitempty"`
+	Data    any            `json:"data,omitempty"`
+}
+
+// ErrorDetail is the reason a field of the request failed validation.
+type ErrorDetail struct {
+	// Field is the path of the field in the request, e.g. middlewares.items[0].id
+	Field string `json:"field"`
+	// Rule is the failed binding rule, e.g. required or oneof
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
 }
 
 func NewErrorResponse(code int, message string) *Response {
@@ -25,29 +36,89 @@ func NewSuccessResponse(data any) *Response {
 	}
 }
 
+type App struct {
+	ID                uint      `json:"id"`
+	AppID             uuid.UUID `json:"app_id"`
+	Name              string    `json:"name"`
+	RequestsPerMinute int       `json:"requests_per_minute"`
+	MonthlyTokenQuota int64     `json:"monthly_token_quota"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
 type Conv struct {
-	ID        uuid.UUID `json:"id"`
-	BotID     uint      `json:"bot_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           uuid.UUID `json:"id"`
+	BotID        uint      `json:"bot_id"`
+	UserIdentity string    `json:"user_identity,omitempty"`
+	BotVersion   int       `json:"bot_version,omitempty"`
+	ExperimentID uint      `json:"experiment_id,omitempty"`
+	Variant      string    `json:"variant,omitempty"`
+	WebhookURL   string    `json:"webhook_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type CreateConvRequest struct {
 	BotID        uint   `json:"bot_id" binding:"required"`
 	UserIdentity string `json:"user_identity"`
+	// BotVersion pins the version of the bot, 0 follows the published one.
+	BotVersion    int    `json:"bot_version" binding:"min=0"`
+	WebhookURL    string `json:"webhook_url" binding:"omitempty,url"`
+	WebhookSecret string `json:"webhook_secret"`
 }
 
 type CreateConvResponse Conv
 
-type UpdateConvRequest CreateConvRequest
+// UpdateConvRequest updates the fields that are set, the others are left as
+// they are. Changing the bot without a version resets BotVersion to 0, the
+// pinned version is one of the previous bot.
+type UpdateConvRequest struct {
+	BotID         *uint   `json:"bot_id,omitempty"`
+	BotVersion    *int    `json:"bot_version,omitempty" binding:"omitempty,min=0"`
+	WebhookURL    *string `json:"webhook_url,omitempty" binding:"omitempty,len=0|url"`
+	WebhookSecret *string `json:"webhook_secret,omitempty"`
+}
 
 type GetConvResponse Conv
 
+type PaginationRequest struct {
+	Cursor string `form:"cursor" json:"cursor"`
+	Limit  int    `form:"limit" json:"limit"`
+	Order  string `form:"order" json:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+type ListConvsRequest struct {
+	BotID        uint   `form:"bot_id" json:"bot_id"`
+	UserIdentity string `form:"user_identity" json:"user_identity"`
+	PaginationRequest
+}
+
+type ListConvsResponse struct {
+	Items      []*Conv `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+type ListTurnsRequest struct {
+	Status []TurnStatus `form:"status" json:"status"`
+	PaginationRequest
+}
+
+type ListTurnsResponse struct {
+	Items      []*Turn `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
 type MiddlewareResult struct {
 	Middleware
 	Code       MiddlewareErrorCode `json:"code"`
 	Err        string              `json:"err,omitempty"`
 	RenderData map[string]any      `json:"render_data,omitempty"`
+	// Response is the canned response of a middleware blocking the request,
+	// the turn responds it without calling the chat model.
+	Response string `json:"response,omitempty"`
+	// Request is the request rewritten by the middleware, which the
+	// middlewares depending on it and the chat model see instead.
+	Request string `json:"request,omitempty"`
 }
 
 type TurnError struct {
@@ -59,7 +130,9 @@ type Turn struct {
 	ID                uint                `json:"id"`
 	ConversationID    uuid.UUID           `json:"conversation_id"`
 	BotID             uint                `json:"bot_id"`
+	BotVersion        int                 `json:"bot_version,omitempty"`
 	Request           string              `json:"request"`
+	RewrittenRequest  string              `json:"rewritten_request,omitempty"` // the request the chat model saw, if middlewares rewrote it
 	Response          string              `json:"response"`
 	PromptTokens      int                 `json:"prompt_tokens"`
 	CompletionTokens  int                 `json:"completion_tokens"`
@@ -67,8 +140,12 @@ type Turn struct {
 	Status            TurnStatus          `json:"status"`
 	MiddlewareResults []*MiddlewareResult `json:"middleware_results,omitempty"`
 	Error             *TurnError          `json:"error,omitempty"`
-	CreatedAt         time.Time           `json:"created_at"`
-	UpdatedAt         time.Time           `json:"updated_at"`
+	// Feedback is only included in exports.
+	Feedback            *Feedback  `json:"feedback,omitempty"`
+	ProcessingStartedAt *time.Time `json:"processing_started_at,omitempty"`
+	ProcessedAt         *time.Time `json:"processed_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
 }
 
 type CreateTurnRequest struct {
@@ -87,6 +164,37 @@ type CreateTurnOnewayRequest struct {
 
 type CreateTurnOnewayResponse Turn
 
+type ConvMessageType string
+
+const (
+	ConvMessageTypeTurn ConvMessageType = "turn"
+)
+
+// ConvMessage is sent by clients over the conversation websocket.
+type ConvMessage struct {
+	Type    ConvMessageType `json:"type"`
+	Content string          `json:"content"`
+}
+
+type ConvEventType string
+
+const (
+	ConvEventTypeTurn  ConvEventType = "turn"
+	ConvEventTypeDelta ConvEventType = "delta"
+	ConvEventTypeError ConvEventType = "error"
+)
+
+// ConvEvent is sent to clients over the conversation websocket. Turn events
+// carry the turn on every status change, delta events carry a piece of the
+// response of a processing turn.
+type ConvEvent struct {
+	Type   ConvEventType `json:"type"`
+	Turn   *Turn         `json:"turn,omitempty"`
+	TurnID uint          `json:"turn_id,omitempty"`
+	Delta  string        `json:"delta,omitempty"`
+	Error  *Response     `json:"error,omitempty"`
+}
+
 type GetTurnRequest struct {
 	BlockUntilProcessed bool `form:"block_until_processed" json:"block_until_processed"`
 	TimeoutSeconds      int  `form:"timeout_seconds" json:"timeout_seconds"`
@@ -104,18 +212,38 @@ type Bot struct {
 	Temperature      float32           `json:"temperature"`
 	TimeoutSeconds   int               `json:"timeout_seconds"`
 	Middlewares      *MiddlewareConfig `json:"middlewares,omitempty"`
+	WebhookURL       string            `json:"webhook_url,omitempty"`
+	PublishedVersion int               `json:"published_version"`
 	CreatedAt        time.Time         `json:"created_at"`
 	UpdatedAt        time.Time         `json:"updated_at"`
 }
 
 type Middleware struct {
-	ID      string            `json:"id" binding:"required"`
-	Name    string            `json:"name" binding:"required"`
-	Options map[string]string `json:"options,omitempty"`
+	ID      string            `json:"id" yaml:"id" binding:"required"`
+	Name    string            `json:"name" yaml:"name" binding:"required"`
+	Options map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+	// DependsOn are the ids of the middlewares to run before this one, whose
+	// results the options can refer to as templates, e.g.
+	// {{.MIDDLEWARE_search_RESULT}}. Middlewares without dependencies
+	// between them run concurrently.
+	DependsOn []string `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
 }
 
 type MiddlewareConfig struct {
-	Items []*Middleware `json:"items,omitempty"`
+	Items []*Middleware `json:"items,omitempty" yaml:"items,omitempty"`
+	// ResponseItems run one after the other on the response of the chat
+	// model, which each can transform or reject.
+	ResponseItems []*Middleware `json:"response_items,omitempty" yaml:"response_items,omitempty"`
+	// Router lets a chat model select the middlewares to run for each
+	// request, all are run if not set.
+	Router *MiddlewareRouter `json:"router,omitempty" yaml:"router,omitempty"`
+}
+
+type MiddlewareRouter struct {
+	ChatModel string `json:"chat_model" yaml:"chat_model" binding:"required"`
+	// Prompt is appended to the instructions of the router, e.g. to tell
+	// when to search the web.
+	Prompt string `json:"prompt,omitempty" yaml:"prompt,omitempty"`
 }
 
 type CreateBotRequest struct {
@@ -125,7 +253,10 @@ type CreateBotRequest struct {
 	BoundaryPrompt   string            `json:"boundary_prompt"`
 	Temperature      float32           `json:"temperature" binding:"required"`
 	ContextTurnCount int               `json:"context_turn_count" binding:"required"`
+	TimeoutSeconds   int               `json:"timeout_seconds" binding:"min=0"`
 	Middlewares      *MiddlewareConfig `json:"middlewares"`
+	WebhookURL       string            `json:"webhook_url" binding:"omitempty,url"`
+	WebhookSecret    string            `json:"webhook_secret"`
 }
 
 type CreateBotResponse Bot
@@ -134,7 +265,249 @@ type GetBotResponse Bot
 
 type GetBotsResponse []Bot
 
-type UpdateBotRequest CreateBotRequest
+type UpdateBotRequest struct {
+	CreateBotRequest
+	// Draft stores the new version of the bot without publishing it.
+	Draft bool `json:"draft"`
+}
+
+type UpdateBotResponse BotVersion
+
+// BotPatch is a JSON merge patch (RFC 7396) of the fields of a bot, fields
+// not set are left as they are. A merge patch can also reset a field with
+// null, which BotPatch cannot express.
+type BotPatch struct {
+	Name             *string           `json:"name,omitempty"`
+	ChatModel        *string           `json:"chat_model,omitempty"`
+	Prompt           *string           `json:"prompt,omitempty"`
+	BoundaryPrompt   *string           `json:"boundary_prompt,omitempty"`
+	Temperature      *float32          `json:"temperature,omitempty"`
+	ContextTurnCount *int              `json:"context_turn_count,omitempty"`
+	TimeoutSeconds   *int              `json:"timeout_seconds,omitempty"`
+	Middlewares      *MiddlewareConfig `json:"middlewares,omitempty"`
+	WebhookURL       *string           `json:"webhook_url,omitempty"`
+	WebhookSecret    *string           `json:"webhook_secret,omitempty"`
+	// UpdatedAt applies the patch only if the bot was not updated since,
+	// like the If-Match header with the ETag of the bot.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type PatchBotRequest struct {
+	// Draft stores the new version of the bot without publishing it, the
+	// response has the settings of the draft then.
+	Draft bool `form:"draft" json:"draft"`
+}
+
+type PatchBotResponse Bot
+
+// BotVersion is an immutable snapshot of the chat settings of a bot.
+type BotVersion struct {
+	Version          int               `json:"version"`
+	ChatModel        string            `json:"chat_model"`
+	Prompt           string            `json:"prompt"`
+	BoundaryPrompt   string            `json:"boundary_prompt"`
+	ContextTurnCount int               `json:"context_turn_count"`
+	Temperature      float32           `json:"temperature"`
+	TimeoutSeconds   int               `json:"timeout_seconds"`
+	Middlewares      *MiddlewareConfig `json:"middlewares,omitempty"`
+	Published        bool              `json:"published"`
+	PublishedAt      *time.Time        `json:"published_at,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+type GetBotVersionsResponse []BotVersion
+
+type GetBotVersionResponse BotVersion
+
+type DiffBotVersionsRequest struct {
+	// From defaults to the published version and To to the latest one.
+	From int `form:"from" json:"from"`
+	To   int `form:"to" json:"to"`
+}
+
+type BotVersionChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type DiffBotVersionsResponse struct {
+	From    int                 `json:"from"`
+	To      int                 `json:"to"`
+	Changes []*BotVersionChange `json:"changes"`
+}
+
+type ExperimentStatus string
+
+const (
+	ExperimentStatusRunning ExperimentStatus = "running"
+	ExperimentStatusStopped ExperimentStatus = "stopped"
+)
+
+type ExperimentVariant struct {
+	Name string `json:"name" binding:"required"`
+	// Weight is the share of the new conversations assigned to the variant,
+	// relative to the weights of the other variants.
+	Weight int `json:"weight" binding:"min=1"`
+	// BotVersion answers the conversations of the variant, 0 follows the
+	// published version.
+	BotVersion int `json:"bot_version" binding:"min=0"`
+}
+
+type Experiment struct {
+	ID        uint                 `json:"id"`
+	BotID     uint                 `json:"bot_id"`
+	Name      string               `json:"name"`
+	Variants  []*ExperimentVariant `json:"variants"`
+	Status    ExperimentStatus     `json:"status"`
+	CreatedAt time.Time            `json:"created_at"`
+	StoppedAt *time.Time           `json:"stopped_at,omitempty"`
+}
+
+type CreateExperimentRequest struct {
+	BotID    uint                 `json:"bot_id" binding:"required"`
+	Name     string               `json:"name" binding:"required"`
+	Variants []*ExperimentVariant `json:"variants" binding:"required,min=2,dive"`
+}
+
+type CreateExperimentResponse Experiment
+
+type GetExperimentResponse Experiment
+
+type ListExperimentsRequest struct {
+	BotID uint `form:"bot_id" json:"bot_id"`
+}
+
+type ListExperimentsResponse []Experiment
+
+type ExperimentVariantMetrics struct {
+	Variant       string  `json:"variant"`
+	BotVersion    int     `json:"bot_version"`
+	Conversations int64   `json:"conversations"`
+	Turns         int64   `json:"turns"`
+	FailedTurns   int64   `json:"failed_turns"`
+	FailureRate   float64 `json:"failure_rate"`
+	// AvgLatencyMs is the average processing time of the succeeded turns.
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	AvgTotalTokens   float64 `json:"avg_total_tokens"`
+	Feedbacks        int64   `json:"feedbacks"`
+	ThumbsUp         int64   `json:"thumbs_up"`
+	ThumbsDown       int64   `json:"thumbs_down"`
+	// FeedbackScore is the average rating, from -1 to 1.
+	FeedbackScore float64 `json:"feedback_score"`
+}
+
+// ExperimentMetrics are computed from the processed turns of the
+// conversations of each variant.
+type ExperimentMetrics struct {
+	ExperimentID uint                        `json:"experiment_id"`
+	Variants     []*ExperimentVariantMetrics `json:"variants"`
+}
+
+// FeedbackRating is 1 for thumbs up and -1 for thumbs down.
+type FeedbackRating int
+
+const (
+	FeedbackRatingDown FeedbackRating = -1
+	FeedbackRatingUp   FeedbackRating = 1
+)
+
+type Feedback struct {
+	ID             uint           `json:"id"`
+	TurnID         uint           `json:"turn_id"`
+	ConversationID uuid.UUID      `json:"conversation_id"`
+	BotID          uint           `json:"bot_id"`
+	Rating         FeedbackRating `json:"rating"`
+	Tags           []string       `json:"tags"`
+	Correction     string         `json:"correction,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+type CreateFeedbackRequest struct {
+	Rating FeedbackRating `json:"rating" binding:"required,oneof=-1 1"`
+	Tags   []string       `json:"tags" binding:"max=16,dive,required,max=64"`
+	// Correction is the response the user expected, exported as the response
+	// of the turn for fine-tuning.
+	Correction string `json:"correction"`
+}
+
+type CreateFeedbackResponse Feedback
+
+type GetFeedbackResponse Feedback
+
+type ListFeedbackRequest struct {
+	Rating FeedbackRating `form:"rating" json:"rating" binding:"omitempty,oneof=-1 1"`
+	PaginationRequest
+}
+
+type ListFeedbackResponse struct {
+	Items      []*Feedback `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+type FeedbackSummary struct {
+	BotID       uint  `json:"bot_id"`
+	Total       int64 `json:"total"`
+	ThumbsUp    int64 `json:"thumbs_up"`
+	ThumbsDown  int64 `json:"thumbs_down"`
+	Corrections int64 `json:"corrections"`
+	// Score is the average rating, from -1 to 1.
+	Score float64          `json:"score"`
+	Tags  map[string]int64 `json:"tags"`
+}
+
+type PreviewBotRequest struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	// Version previews a version of the bot other than the published one,
+	// the version pinned by the conversation is used if not set.
+	Version int    `json:"version"`
+	Content string `json:"content" binding:"required"`
+}
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type PreviewBotResponse struct {
+	ChatModel         string              `json:"chat_model"`
+	Messages          []*ChatMessage      `json:"messages"`
+	PromptTokens      int                 `json:"prompt_tokens"`
+	MaxRequestTokens  int                 `json:"max_request_tokens"`
+	MiddlewareResults []*MiddlewareResult `json:"middleware_results,omitempty"`
+	// Response is the canned response of a middleware blocking the request,
+	// there are no messages then.
+	Response string `json:"response,omitempty"`
+}
+
+type ExportFormat string
+
+const (
+	ExportFormatJSON     ExportFormat = "json"
+	ExportFormatMarkdown ExportFormat = "markdown"
+	ExportFormatJSONL    ExportFormat = "jsonl"
+)
+
+type ExportRequest struct {
+	Format ExportFormat `form:"format" json:"format" binding:"omitempty,oneof=json markdown jsonl"`
+	Since  time.Time    `form:"since" json:"since"`
+	Until  time.Time    `form:"until" json:"until"`
+	Status []TurnStatus `form:"status" json:"status"`
+}
+
+type ExportConv struct {
+	Conv
+	Turns []*Turn `json:"turns"`
+}
+
+type Export struct {
+	Bot           *Bot          `json:"bot,omitempty"`
+	Conversations []*ExportConv `json:"conversations"`
+}
 
 type ListModelsResponse struct {
 	ChatModels      []string `json:"chat_models"`
@@ -146,20 +519,30 @@ type MiddlewareDescOption struct {
 	Desc         string `json:"desc"`
 	DefaultValue string `json:"default_value,omitempty"`
 	Required     bool   `json:"required,omitempty"`
+	// Raw values are passed as they are, they are not rendered as templates
+	// of the request, e.g. when they are templates of the middleware itself.
+	Raw bool `json:"raw,omitempty"`
 
 	Value          any                       `json:"-"`
 	ParseValueFunc func(string) (any, error) `json:"-"`
+	// PrepareFunc is applied to the value as written in the config, before
+	// it is rendered, so what the request renders into it is left alone.
+	PrepareFunc func(string) (string, error) `json:"-"`
 }
 
 type MiddlewareDesc struct {
 	Name    string                  `json:"name"`
 	Desc    string                  `json:"desc"`
 	Options []*MiddlewareDescOption `json:"options"`
+	// RewritesRequest tells that the middleware can rewrite the request, it
+	// then runs before the router of the config selects the others.
+	RewritesRequest bool `json:"rewrites_request,omitempty"`
 }
 
 type ListMiddlewaresResponse struct {
-	GeneralOptions []*MiddlewareDescOption `json:"general_options"`
-	Middlewares    []*MiddlewareDesc       `json:"middlewares"`
+	GeneralOptions      []*MiddlewareDescOption `json:"general_options"`
+	Middlewares         []*MiddlewareDesc       `json:"middlewares"`
+	ResponseMiddlewares []*MiddlewareDesc       `json:"response_middlewares"`
 }
 
 type UpsertIndexesRequest struct {
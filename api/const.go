@@ -1,5 +1,10 @@
 package api
 
+import (
+	"fmt"
+	"strings"
+)
+
 //go:generate go run golang.org/x/tools/cmd/stringer -type=TurnErrorCode -linecomment -trimprefix=TurnErrorCode
 //go:generate go run golang.org/x/tools/cmd/stringer -type=TurnStatus -linecomment --trimprefix TurnStatus
 
@@ -12,10 +17,61 @@ const (
 	TurnStatusFailed
 )
 
+// ParseTurnStatus parses a turn status from its name, case-insensitively.
+func ParseTurnStatus(s string) (TurnStatus, error) {
+	for i := TurnStatusInit; i <= TurnStatusFailed; i++ {
+		if strings.EqualFold(i.String(), s) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid turn status: %s", s)
+}
+
+// ErrorCode is the code of error responses. The http status of the response
+// tells the class of the error, the code tells the exact reason.
 type ErrorCode int
 
 const (
+	// 409, the conversation has a turn waiting to be processed
 	ErrorCodeConversationHasInitTurn ErrorCode = 1000
+	// 429, limits of the app or the user
+	ErrorCodeRateLimitExceeded  ErrorCode = 1001
+	ErrorCodeTokenQuotaExceeded ErrorCode = 1002
+
+	// 400, invalid requests
+	ErrorCodeInvalidRequest       ErrorCode = 1100
+	ErrorCodeValidationFailed     ErrorCode = 1101 // see Response.Details
+	ErrorCodeInvalidCursor        ErrorCode = 1102
+	ErrorCodeModelNotFound        ErrorCode = 1103
+	ErrorCodeTooManyRequestTokens ErrorCode = 1104
+
+	// 401
+	ErrorCodeUnauthorized ErrorCode = 1200
+
+	// 404
+	ErrorCodeNotFound             ErrorCode = 1300
+	ErrorCodeBotNotFound          ErrorCode = 1301
+	ErrorCodeConversationNotFound ErrorCode = 1302
+	ErrorCodeTurnNotFound         ErrorCode = 1303
+	ErrorCodeIndexNotFound        ErrorCode = 1304
+	ErrorCodeBotVersionNotFound   ErrorCode = 1305
+	ErrorCodeExperimentNotFound   ErrorCode = 1306
+	ErrorCodeFeedbackNotFound     ErrorCode = 1307
+
+	// 409 and 412
+	ErrorCodeConflict           ErrorCode = 1400
+	ErrorCodePreconditionFailed ErrorCode = 1401
+
+	// 502, 503 and 504, errors of the model provider
+	ErrorCodeModelCallFailed  ErrorCode = 1500
+	ErrorCodeModelRateLimited ErrorCode = 1501
+	ErrorCodeModelCallTimeout ErrorCode = 1502
+
+	// 408, the turn is not processed before the timeout
+	ErrorCodeTimeout ErrorCode = 1600
+
+	// 500
+	ErrorCodeInternal ErrorCode = 1900
 )
 
 type TurnErrorCode int
@@ -30,6 +86,8 @@ const (
 	TurnErrorCodeChatModelNotFound                  // Chat Model Not Found
 	TurnErrorCodeChatModelCallTimeout               // Chat Model Call Timeout
 	TurnErrorCodeChatModelCallError                 // Chat Model Call Error
+	TurnErrorCodeResponseRejected                   // Response Rejected
+	TurnErrorCodeRequestBlocked                     // Request Blocked
 )
 
 type MiddlewareErrorCode int
@@ -39,4 +97,8 @@ const (
 	MiddlewareErrorCodeConfigInvalid
 	MiddlewareErrorCodeProcessFailed
 	MiddlewareErrorCodeTimeout
+	MiddlewareErrorCodeDependencyFailed
+	MiddlewareErrorCodeSkipped
+	MiddlewareErrorCodeRejected
+	MiddlewareErrorCodeBlocked
 )
@@ -0,0 +1,64 @@
+package api
+
+// BotManifest declares a bot in YAML or JSON, bots are matched by name when
+// a manifest is applied. Webhook secrets are not part of manifests, applying
+// a manifest keeps the secret of an existing bot.
+type BotManifest struct {
+	Name             string            `json:"name" yaml:"name" binding:"required"`
+	ChatModel        string            `json:"chat_model" yaml:"chat_model" binding:"required"`
+	Prompt           string            `json:"prompt,omitempty" yaml:"prompt,omitempty"`
+	BoundaryPrompt   string            `json:"boundary_prompt,omitempty" yaml:"boundary_prompt,omitempty"`
+	ContextTurnCount int               `json:"context_turn_count" yaml:"context_turn_count"`
+	Temperature      float32           `json:"temperature" yaml:"temperature"`
+	TimeoutSeconds   int               `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"`
+	Middlewares      *MiddlewareConfig `json:"middlewares,omitempty" yaml:"middlewares,omitempty"`
+	WebhookURL       string            `json:"webhook_url,omitempty" yaml:"webhook_url,omitempty" binding:"omitempty,url"`
+	// IndexGroups are the group keys of the indexes searched by the
+	// middlewares, applying warns about the groups without indexes.
+	IndexGroups []string `json:"index_groups,omitempty" yaml:"index_groups,omitempty"`
+}
+
+type Manifest struct {
+	Bots []*BotManifest `json:"bots" yaml:"bots" binding:"required,dive,required"`
+}
+
+type ManifestFormat string
+
+const (
+	ManifestFormatYAML ManifestFormat = "yaml"
+	ManifestFormatJSON ManifestFormat = "json"
+)
+
+type ExportManifestRequest struct {
+	// Names selects the bots to export, all bots are exported if empty.
+	Names  []string       `form:"name" json:"name"`
+	Format ManifestFormat `form:"format" json:"format" binding:"omitempty,oneof=yaml json"`
+}
+
+type ApplyManifestRequest struct {
+	// DryRun only computes the changes.
+	DryRun bool `form:"dry_run" json:"dry_run"`
+}
+
+type ManifestAction string
+
+const (
+	ManifestActionCreate    ManifestAction = "create"
+	ManifestActionUpdate    ManifestAction = "update"
+	ManifestActionUnchanged ManifestAction = "unchanged"
+)
+
+type BotManifestResult struct {
+	Name   string         `json:"name"`
+	BotID  uint           `json:"bot_id,omitempty"`
+	Action ManifestAction `json:"action"`
+	// Version is the published version of the bot after applying.
+	Version  int                 `json:"version,omitempty"`
+	Changes  []*BotVersionChange `json:"changes,omitempty"`
+	Warnings []string            `json:"warnings,omitempty"`
+}
+
+type ApplyManifestResponse struct {
+	DryRun bool                 `json:"dry_run"`
+	Bots   []*BotManifestResult `json:"bots"`
+}
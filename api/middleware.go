@@ -0,0 +1,25 @@
+package api
+
+// RemoteMiddlewareProcessRequest is posted to the process endpoint of a remote
+// middleware, the describe endpoint responds a MiddlewareDesc.
+type RemoteMiddlewareProcessRequest struct {
+	// ID is the id of the middleware in the bot config.
+	ID string `json:"id"`
+	// Turn has the request as rewritten by the middlewares the middleware
+	// depends on, if they rewrote it.
+	Turn Turn `json:"turn"`
+	// Conv is nil for previews without a conversation.
+	Conv    *Conv             `json:"conversation,omitempty"`
+	Options map[string]string `json:"options"`
+}
+
+// RemoteMiddlewareProcessResponse is the response of the process endpoint of a
+// remote middleware. Result is rendered as MIDDLEWARE_<ID>_RESULT and each
+// render data key as MIDDLEWARE_<ID>_DATA_<KEY>, a non empty Request rewrites
+// the request and a non empty Error fails the middleware.
+type RemoteMiddlewareProcessResponse struct {
+	Result     string         `json:"result"`
+	RenderData map[string]any `json:"render_data,omitempty"`
+	Request    string         `json:"request,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
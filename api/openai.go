@@ -0,0 +1,62 @@
+package api
+
+// The types below follow the OpenAI chat completions API, so that clients
+// of OpenAI can talk to botastic bots.
+
+type OpenAIChatMessage struct {
+	Role    string `json:"role" binding:"required,oneof=system user assistant"`
+	Content string `json:"content" binding:"required"`
+}
+
+type OpenAIChatCompletionRequest struct {
+	// Model is the name of the bot.
+	Model    string               `json:"model" binding:"required"`
+	Messages []*OpenAIChatMessage `json:"messages" binding:"required,min=1,dive,required"`
+	Stream   bool                 `json:"stream"`
+	// User is used as the user identity of new conversations.
+	User string `json:"user"`
+}
+
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type OpenAIChatCompletionChoice struct {
+	Index        int                `json:"index"`
+	Message      *OpenAIChatMessage `json:"message,omitempty"`
+	Delta        *OpenAIChatMessage `json:"delta,omitempty"`
+	FinishReason *string            `json:"finish_reason"`
+}
+
+type OpenAIChatCompletionResponse struct {
+	ID      string                        `json:"id"`
+	Object  string                        `json:"object"`
+	Created int64                         `json:"created"`
+	Model   string                        `json:"model"`
+	Choices []*OpenAIChatCompletionChoice `json:"choices"`
+	Usage   *OpenAIUsage                  `json:"usage,omitempty"`
+}
+
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type OpenAIListModelsResponse struct {
+	Object string         `json:"object"`
+	Data   []*OpenAIModel `json:"data"`
+}
+
+type OpenAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    any    `json:"code"`
+}
+
+type OpenAIErrorResponse struct {
+	Error *OpenAIError `json:"error"`
+}
@@ -16,11 +16,13 @@ func _() {
 	_ = x[TurnErrorCodeChatModelNotFound-6]
 	_ = x[TurnErrorCodeChatModelCallTimeout-7]
 	_ = x[TurnErrorCodeChatModelCallError-8]
+	_ = x[TurnErrorCodeResponseRejected-9]
+	_ = x[TurnErrorCodeRequestBlocked-10]
 }
 
-const _TurnErrorCode_name = "Internal Server ErrorConversation Not FoundBot Not FoundMiddleware ErrorRender Prompt ErrorChat Model Not FoundChat Model Call TimeoutChat Model Call Error"
+const _TurnErrorCode_name = "Internal Server ErrorConversation Not FoundBot Not FoundMiddleware ErrorRender Prompt ErrorChat Model Not FoundChat Model Call TimeoutChat Model Call ErrorResponse RejectedRequest Blocked"
 
-var _TurnErrorCode_index = [...]uint8{0, 21, 43, 56, 72, 91, 111, 134, 155}
+var _TurnErrorCode_index = [...]uint8{0, 21, 43, 56, 72, 91, 111, 134, 155, 172, 187}
 
 func (i TurnErrorCode) String() string {
 	i -= 1
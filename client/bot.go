@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pandodao/botastic/api"
+)
+
+func (c *Client) CreateBot(ctx context.Context, req api.CreateBotRequest) (*api.Bot, error) {
+	var resp api.Bot
+	if err := c.do(ctx, http.MethodPost, "/api/v1/bots/", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetBot(ctx context.Context, botID uint) (*api.Bot, error) {
+	var resp api.Bot
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/bots/%d", botID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetBots(ctx context.Context) ([]api.Bot, error) {
+	var resp []api.Bot
+	if err := c.do(ctx, http.MethodGet, "/api/v1/bots/", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// UpdateBot stores the chat settings of the request as a new version of the
+// bot, published unless Draft is set.
+func (c *Client) UpdateBot(ctx context.Context, botID uint, req api.UpdateBotRequest) (*api.BotVersion, error) {
+	var resp api.BotVersion
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/bots/%d", botID), nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PatchBot updates fields of the bot with a JSON merge patch, an api.BotPatch
+// or a map to reset fields with nil values. Set the UpdatedAt of the patch to
+// only update the bot if it was not updated since.
+func (c *Client) PatchBot(ctx context.Context, botID uint, patch any, draft bool) (*api.Bot, error) {
+	var resp api.Bot
+	req := api.PatchBotRequest{Draft: draft}
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/v1/bots/%d", botID), req, patch, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteBot(ctx context.Context, botID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/bots/%d", botID), nil, nil, nil)
+}
+
+func (c *Client) PreviewBot(ctx context.Context, botID uint, req api.PreviewBotRequest) (*api.PreviewBotResponse, error) {
+	var resp api.PreviewBotResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/bots/%d/preview", botID), nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportBot writes the export of the conversations of the bot in the
+// requested format to w.
+func (c *Client) ExportBot(ctx context.Context, botID uint, req api.ExportRequest, w io.Writer) error {
+	return c.export(ctx, fmt.Sprintf("/api/v1/bots/%d/export", botID), req, w)
+}
+
+func (c *Client) ListBotVersions(ctx context.Context, botID uint) ([]api.BotVersion, error) {
+	var resp []api.BotVersion
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/bots/%d/versions", botID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetBotVersion(ctx context.Context, botID uint, version int) (*api.BotVersion, error) {
+	var resp api.BotVersion
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/bots/%d/versions/%d", botID, version), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DiffBotVersions(ctx context.Context, botID uint, req api.DiffBotVersionsRequest) (*api.DiffBotVersionsResponse, error) {
+	var resp api.DiffBotVersionsResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/bots/%d/diff", botID), req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) PublishBotVersion(ctx context.Context, botID uint, version int) (*api.Bot, error) {
+	var resp api.Bot
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/bots/%d/versions/%d/publish", botID, version), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RollbackBot publishes the version published before the current one.
+func (c *Client) RollbackBot(ctx context.Context, botID uint) (*api.Bot, error) {
+	var resp api.Bot
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/bots/%d/rollback", botID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,255 @@
+// Package client is a Go client of the botastic HTTP API, it uses the request
+// and response types of the api package.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+)
+
+const (
+	headerAppID     = "X-BOTASTIC-APPID"
+	headerAppSecret = "X-BOTASTIC-SECRET"
+)
+
+type Client struct {
+	baseURL    string
+	appID      string
+	appSecret  string
+	httpClient *http.Client
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the http client used to send requests, the default is
+// http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// New creates a client of the botastic instance at baseURL, e.g.
+// https://botastic.example.com, authenticated as the given app.
+func New(baseURL, appID, appSecret string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		appID:      appID,
+		appSecret:  appSecret,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is returned when the server responds with an error.
+type Error struct {
+	StatusCode int
+	// Code is one of api.ErrorCode
+	Code    int
+	Message string
+	// Details are the failed fields of api.ErrorCodeValidationFailed errors.
+	Details []*api.ErrorDetail
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("botastic: %s (status %d, code %d)", e.Message, e.StatusCode, e.Code)
+}
+
+// HealthCheck checks that the server is up.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/hc", nil, nil, nil)
+}
+
+// OpenAPI returns the OpenAPI document of the server.
+func (c *Client) OpenAPI(ctx context.Context) (map[string]any, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/api/v1/openapi.json", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var spec map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func (c *Client) ListModels(ctx context.Context) (*api.ListModelsResponse, error) {
+	var resp api.ListModelsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/models", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListMiddlewares(ctx context.Context) (*api.ListMiddlewaresResponse, error) {
+	var resp api.ListMiddlewaresResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/middlewares", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do sends the request and decodes the data of the api.Response envelope
+// into data, if not nil.
+func (c *Client) do(ctx context.Context, method, path string, query, body, data any) error {
+	resp, err := c.send(ctx, method, path, query, body, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if data == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	r := api.Response{Data: data}
+	return json.NewDecoder(resp.Body).Decode(&r)
+}
+
+// send sends the request, the caller must close the body of the returned
+// response. Error responses are returned as *Error.
+func (c *Client) send(ctx context.Context, method, path string, query, body any, header http.Header) (*http.Response, error) {
+	u := c.baseURL + path
+	if query != nil {
+		values := url.Values{}
+		encodeQuery(values, reflect.ValueOf(query))
+		if len(values) > 0 {
+			u += "?" + values.Encode()
+		}
+	}
+
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set(headerAppID, c.appID)
+	req.Header.Set(headerAppSecret, c.appSecret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return resp, nil
+}
+
+func decodeError(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    http.StatusText(resp.StatusCode),
+	}
+
+	// both the api.Response and the OpenAI compatible error formats
+	var r struct {
+		api.Response
+		Error *api.OpenAIError `json:"error"`
+	}
+	if json.Unmarshal(data, &r) == nil {
+		switch {
+		case r.Error != nil:
+			e.Message = r.Error.Message
+			if code, ok := r.Error.Code.(float64); ok {
+				e.Code = int(code)
+			}
+		case r.Message != "":
+			e.Code = r.Code
+			e.Message = r.Message
+			e.Details = r.Details
+		}
+	}
+	return e
+}
+
+// encodeQuery adds the fields of the struct v to values by their form tags,
+// zero values are omitted.
+func encodeQuery(values url.Values, v reflect.Value) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			encodeQuery(values, fv)
+			continue
+		}
+		if !f.IsExported() || name == "" || name == "-" || fv.IsZero() {
+			continue
+		}
+
+		if fv.Kind() == reflect.Slice {
+			for j := 0; j < fv.Len(); j++ {
+				values.Add(name, formatQueryValue(fv.Index(j)))
+			}
+			continue
+		}
+		values.Set(name, formatQueryValue(fv))
+	}
+}
+
+func formatQueryValue(v reflect.Value) string {
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case uuid.UUID:
+		return x.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
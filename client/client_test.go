@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+)
+
+func TestClientRoundTrip(t *testing.T) {
+	convID := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headerAppID) != "app" || r.Header.Get(headerAppSecret) != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/conversations/":
+			var req api.CreateConvRequest
+			if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&req) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(api.NewSuccessResponse(api.Conv{ID: convID, BotID: req.BotID, UserIdentity: req.UserIdentity}))
+		case "GET /api/v1/conversations/":
+			if q := r.URL.RawQuery; q != "bot_id=3&limit=10&user_identity=alice" {
+				t.Errorf("query = %s", q)
+			}
+			json.NewEncoder(w).Encode(api.NewSuccessResponse(api.ListConvsResponse{Items: []*api.Conv{{ID: convID}}, NextCursor: "next"}))
+		case "DELETE /api/v1/conversations/" + convID.String():
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(api.NewErrorResponse(int(api.ErrorCodeConversationNotFound), "conversation not found"))
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL+"/", "app", "secret")
+	ctx := context.Background()
+
+	conv, err := c.CreateConv(ctx, api.CreateConvRequest{BotID: 3, UserIdentity: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.ID != convID || conv.BotID != 3 || conv.UserIdentity != "alice" {
+		t.Errorf("conv = %+v", conv)
+	}
+
+	convs, err := c.ListConvs(ctx, api.ListConvsRequest{
+		BotID:             3,
+		UserIdentity:      "alice",
+		PaginationRequest: api.PaginationRequest{Limit: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs.Items) != 1 || convs.Items[0].ID != convID || convs.NextCursor != "next" {
+		t.Errorf("convs = %+v", convs)
+	}
+
+	if err := c.DeleteConv(ctx, convID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.GetConv(ctx, convID)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound || e.Code != int(api.ErrorCodeConversationNotFound) || e.Message != "conversation not found" {
+		t.Errorf("err = %v, want the error of the response", err)
+	}
+
+	_, err = New(srv.URL, "app", "wrong").GetConv(ctx, convID)
+	if !errors.As(err, &e) || e.StatusCode != http.StatusUnauthorized || e.Message != http.StatusText(http.StatusUnauthorized) {
+		t.Errorf("err = %v, want unauthorized", err)
+	}
+}
+
+func TestDecodeOpenAIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(api.OpenAIErrorResponse{Error: &api.OpenAIError{
+			Message: "rate limit exceeded",
+			Code:    int(api.ErrorCodeRateLimitExceeded),
+		}})
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "app", "secret").OpenAIListModels(context.Background())
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusTooManyRequests || e.Code != int(api.ErrorCodeRateLimitExceeded) || e.Message != "rate limit exceeded" {
+		t.Errorf("err = %v, want the OpenAI error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+)
+
+func (c *Client) CreateConv(ctx context.Context, req api.CreateConvRequest) (*api.Conv, error) {
+	var resp api.Conv
+	if err := c.do(ctx, http.MethodPost, "/api/v1/conversations/", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListConvs(ctx context.Context, req api.ListConvsRequest) (*api.ListConvsResponse, error) {
+	var resp api.ListConvsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/conversations/", req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetConv(ctx context.Context, convID uuid.UUID) (*api.Conv, error) {
+	var resp api.Conv
+	if err := c.do(ctx, http.MethodGet, "/api/v1/conversations/"+convID.String(), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateConv(ctx context.Context, convID uuid.UUID, req api.UpdateConvRequest) error {
+	return c.do(ctx, http.MethodPut, "/api/v1/conversations/"+convID.String(), nil, req, nil)
+}
+
+func (c *Client) DeleteConv(ctx context.Context, convID uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/conversations/"+convID.String(), nil, nil, nil)
+}
+
+func (c *Client) ListTurns(ctx context.Context, convID uuid.UUID, req api.ListTurnsRequest) (*api.ListTurnsResponse, error) {
+	var resp api.ListTurnsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/conversations/"+convID.String()+"/turns", req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportConv writes the export of the conversation in the requested format
+// to w.
+func (c *Client) ExportConv(ctx context.Context, convID uuid.UUID, req api.ExportRequest, w io.Writer) error {
+	return c.export(ctx, "/api/v1/conversations/"+convID.String()+"/export", req, w)
+}
+
+func (c *Client) export(ctx context.Context, path string, req api.ExportRequest, w io.Writer) error {
+	resp, err := c.send(ctx, http.MethodGet, path, req, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pandodao/botastic/api"
+)
+
+func (c *Client) CreateExperiment(ctx context.Context, req api.CreateExperimentRequest) (*api.Experiment, error) {
+	var resp api.Experiment
+	if err := c.do(ctx, http.MethodPost, "/api/v1/experiments/", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListExperiments(ctx context.Context, req api.ListExperimentsRequest) ([]api.Experiment, error) {
+	var resp []api.Experiment
+	if err := c.do(ctx, http.MethodGet, "/api/v1/experiments/", req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetExperiment(ctx context.Context, experimentID uint) (*api.Experiment, error) {
+	var resp api.Experiment
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/experiments/%d", experimentID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) StopExperiment(ctx context.Context, experimentID uint) (*api.Experiment, error) {
+	var resp api.Experiment
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/experiments/%d/stop", experimentID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetExperimentMetrics(ctx context.Context, experimentID uint) (*api.ExperimentMetrics, error) {
+	var resp api.ExperimentMetrics
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/experiments/%d/metrics", experimentID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pandodao/botastic/api"
+)
+
+// CreateFeedback rates a processed turn, replacing its previous feedback.
+func (c *Client) CreateFeedback(ctx context.Context, turnID uint, req api.CreateFeedbackRequest) (*api.Feedback, error) {
+	var resp api.Feedback
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/turns/%d/feedback", turnID), nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetFeedback(ctx context.Context, turnID uint) (*api.Feedback, error) {
+	var resp api.Feedback
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/turns/%d/feedback", turnID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListBotFeedback(ctx context.Context, botID uint, req api.ListFeedbackRequest) (*api.ListFeedbackResponse, error) {
+	var resp api.ListFeedbackResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/bots/%d/feedback", botID), req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetBotFeedbackSummary(ctx context.Context, botID uint) (*api.FeedbackSummary, error) {
+	var resp api.FeedbackSummary
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/bots/%d/feedback/summary", botID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
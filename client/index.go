@@ -0,0 +1,24 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pandodao/botastic/api"
+)
+
+func (c *Client) UpsertIndexes(ctx context.Context, req api.UpsertIndexesRequest) (*api.UpsertIndexesResponse, error) {
+	var resp api.UpsertIndexesResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/indexes/", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) SearchIndexes(ctx context.Context, req api.SearchIndexesRequest) (*api.SearchIndexesResponse, error) {
+	var resp api.SearchIndexesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/indexes/search", req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
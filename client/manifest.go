@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pandodao/botastic/api"
+)
+
+// ExportManifest returns the manifest of the named bots, or of all bots if
+// no name is given.
+func (c *Client) ExportManifest(ctx context.Context, names ...string) (*api.Manifest, error) {
+	var resp api.Manifest
+	req := api.ExportManifestRequest{Names: names}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/manifest", req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ApplyManifest creates or updates the bots of the manifest by name, only
+// computing the changes if dryRun is set.
+func (c *Client) ApplyManifest(ctx context.Context, m api.Manifest, dryRun bool) (*api.ApplyManifestResponse, error) {
+	var resp api.ApplyManifestResponse
+	req := api.ApplyManifestRequest{DryRun: dryRun}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/manifest", req, m, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
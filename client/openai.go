@@ -0,0 +1,107 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+)
+
+const headerConvID = "X-BOTASTIC-CONVERSATION-ID"
+
+// OpenAIChatCompletions sends the last message of the request as a new turn
+// of the conversation through the OpenAI compatible API, a new conversation
+// is created if convID is uuid.Nil. The id of the conversation is returned
+// with the completion.
+func (c *Client) OpenAIChatCompletions(ctx context.Context, convID uuid.UUID, req api.OpenAIChatCompletionRequest) (*api.OpenAIChatCompletionResponse, uuid.UUID, error) {
+	req.Stream = false
+	resp, err := c.send(ctx, http.MethodPost, "/v1/chat/completions", nil, req, convHeader(convID))
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	defer resp.Body.Close()
+
+	var r api.OpenAIChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, uuid.Nil, err
+	}
+	convID, err = uuid.Parse(resp.Header.Get(headerConvID))
+	return &r, convID, err
+}
+
+// OpenAIChatCompletionsStream is like OpenAIChatCompletions but streams the
+// completion, calling onChunk with every chunk.
+func (c *Client) OpenAIChatCompletionsStream(ctx context.Context, convID uuid.UUID, req api.OpenAIChatCompletionRequest, onChunk func(*api.OpenAIChatCompletionResponse)) (uuid.UUID, error) {
+	req.Stream = true
+	resp, err := c.send(ctx, http.MethodPost, "/v1/chat/completions", nil, req, convHeader(convID))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer resp.Body.Close()
+
+	convID, err = uuid.Parse(resp.Header.Get(headerConvID))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data: "))
+		if !ok {
+			continue
+		}
+		if string(data) == "[DONE]" {
+			return convID, nil
+		}
+
+		var chunk struct {
+			api.OpenAIChatCompletionResponse
+			Error *api.OpenAIError `json:"error"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return convID, err
+		}
+		if chunk.Error != nil {
+			e := &Error{
+				StatusCode: resp.StatusCode,
+				Message:    chunk.Error.Message,
+			}
+			if code, ok := chunk.Error.Code.(float64); ok {
+				e.Code = int(code)
+			}
+			return convID, e
+		}
+		onChunk(&chunk.OpenAIChatCompletionResponse)
+	}
+	if err := scanner.Err(); err != nil {
+		return convID, err
+	}
+	return convID, errors.New("botastic: stream closed before done")
+}
+
+func (c *Client) OpenAIListModels(ctx context.Context) (*api.OpenAIListModelsResponse, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/v1/models", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r api.OpenAIListModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func convHeader(convID uuid.UUID) http.Header {
+	if convID == uuid.Nil {
+		return nil
+	}
+	return http.Header{headerConvID: []string{convID.String()}}
+}
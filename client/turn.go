@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"golang.org/x/net/websocket"
+)
+
+// waitTurnTimeoutSeconds is the timeout of each blocking request of WaitTurn.
+const waitTurnTimeoutSeconds = 30
+
+func (c *Client) CreateTurn(ctx context.Context, convID uuid.UUID, req api.CreateTurnRequest) (*api.Turn, error) {
+	var resp api.Turn
+	if err := c.do(ctx, http.MethodPost, "/api/v1/conversations/"+convID.String(), nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateTurnOneway creates a turn, and the conversation if no conversation
+// id is given. The turn is returned once processed if BlockUntilProcessed is
+// set.
+func (c *Client) CreateTurnOneway(ctx context.Context, req api.CreateTurnOnewayRequest) (*api.Turn, error) {
+	var resp api.Turn
+	if err := c.do(ctx, http.MethodPost, "/api/v1/turns/", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetTurn gets the turn, blocking until it is processed or the timeout if
+// BlockUntilProcessed is set.
+func (c *Client) GetTurn(ctx context.Context, turnID uint, req api.GetTurnRequest) (*api.Turn, error) {
+	var resp api.Turn
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/turns/%d", turnID), req, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WaitTurn blocks until the turn is processed or ctx is done.
+func (c *Client) WaitTurn(ctx context.Context, turnID uint) (*api.Turn, error) {
+	for {
+		turn, err := c.GetTurn(ctx, turnID, api.GetTurnRequest{
+			BlockUntilProcessed: true,
+			TimeoutSeconds:      waitTurnTimeoutSeconds,
+		})
+		var e *Error
+		switch {
+		case errors.As(err, &e) && e.StatusCode == http.StatusRequestTimeout:
+			continue
+		case err != nil:
+			return nil, err
+		case turn.Status == api.TurnStatusSuccess || turn.Status == api.TurnStatusFailed:
+			return turn, nil
+		}
+	}
+}
+
+// ConvConn is a websocket connection to a conversation.
+type ConvConn struct {
+	ws *websocket.Conn
+}
+
+// DialConv opens the websocket of the conversation, the deadline of ctx
+// applies to the dial only.
+func (c *Client) DialConv(ctx context.Context, convID uuid.UUID) (*ConvConn, error) {
+	u := c.baseURL + "/api/v1/conversations/" + convID.String() + "/ws"
+	cfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(u, "http"), c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Header.Set(headerAppID, c.appID)
+	cfg.Header.Set(headerAppSecret, c.appSecret)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		cfg.Dialer = &net.Dialer{Deadline: deadline}
+	}
+
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &ConvConn{ws: ws}, nil
+}
+
+// SendTurn sends a new turn of the conversation, its events are received by
+// Recv.
+func (c *ConvConn) SendTurn(content string) error {
+	return websocket.JSON.Send(c.ws, &api.ConvMessage{
+		Type:    api.ConvMessageTypeTurn,
+		Content: content,
+	})
+}
+
+// Recv receives the next event of the conversation.
+func (c *ConvConn) Recv() (*api.ConvEvent, error) {
+	var e api.ConvEvent
+	if err := websocket.JSON.Receive(c.ws, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (c *ConvConn) Close() error {
+	return c.ws.Close()
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/models"
+	"github.com/spf13/cobra"
+)
+
+// appCmd represents the app command
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "Manage apps and their keys",
+}
+
+var appCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an app and display its secret",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		sh, err := provideStorage(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		app, secret, err := models.NewApp(name)
+		if err != nil {
+			return err
+		}
+		app.RequestsPerMinute, _ = cmd.Flags().GetInt("requests-per-minute")
+		app.MonthlyTokenQuota, _ = cmd.Flags().GetInt64("monthly-tokens")
+		if err := sh.CreateApp(cmd.Context(), app); err != nil {
+			return err
+		}
+
+		fmt.Printf("app_id: %s\n", app.AppID)
+		fmt.Printf("app_secret: %s\n", secret)
+		return nil
+	},
+}
+
+var appListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List apps",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sh, err := provideStorage(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		apps, err := sh.GetApps(cmd.Context())
+		if err != nil {
+			return err
+		}
+		for _, app := range apps {
+			fmt.Printf("%s\t%s\n", app.AppID, app.Name)
+		}
+		return nil
+	},
+}
+
+var appResetSecretCmd = &cobra.Command{
+	Use:   "reset-secret [app_id]",
+	Short: "Replace the secret of an app and display it",
+	Long:  "Replace the secret of an app and display it, e.g. of the default app the resources created before there were apps are moved to.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID, err := uuid.Parse(args[0])
+		if err != nil {
+			return err
+		}
+
+		sh, err := provideStorage(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		app := &models.App{AppID: appID}
+		secret, err := app.ResetSecret()
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := sh.UpdateAppSecretHash(cmd.Context(), appID, app.SecretHash)
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("app not found: %s", appID)
+		}
+
+		fmt.Printf("app_id: %s\n", appID)
+		fmt.Printf("app_secret: %s\n", secret)
+		return nil
+	},
+}
+
+var appDeleteCmd = &cobra.Command{
+	Use:   "delete [app_id]",
+	Short: "Delete an app",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID, err := uuid.Parse(args[0])
+		if err != nil {
+			return err
+		}
+
+		sh, err := provideStorage(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := sh.DeleteApp(cmd.Context(), appID)
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("app not found: %s", appID)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(appCmd)
+	appCmd.AddCommand(appCreateCmd, appListCmd, appResetSecretCmd, appDeleteCmd)
+	appCreateCmd.Flags().StringP("name", "n", "", "app name")
+	appCreateCmd.Flags().Int("requests-per-minute", 0, "turn requests per minute, 0 uses the configured default, negative means unlimited")
+	appCreateCmd.Flags().Int64("monthly-tokens", 0, "monthly token quota, 0 uses the configured default, negative means unlimited")
+}
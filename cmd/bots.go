@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// botsCmd represents the bots command
+var botsCmd = &cobra.Command{
+	Use:   "bots",
+	Short: "Export and apply bot manifests",
+}
+
+var botsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the bots of an app as a manifest",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		if format != string(api.ManifestFormatYAML) && format != string(api.ManifestFormatJSON) {
+			return fmt.Errorf("invalid format: %s", format)
+		}
+
+		ctx := cmd.Context()
+		app, err := getAppFromFlag(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		mh, err := provideManifestHandler(ctx, cfgFile)
+		if err != nil {
+			return err
+		}
+
+		names, _ := cmd.Flags().GetStringSlice("name")
+		m, err := mh.Export(ctx, app.ID, names)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			file, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if format == string(api.ManifestFormatJSON) {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(m)
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+		return enc.Close()
+	},
+}
+
+var botsApplyCmd = &cobra.Command{
+	Use:   "apply [file]",
+	Short: "Create or update the bots of a YAML or JSON manifest by name",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		// JSON is valid YAML
+		var m api.Manifest
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		app, err := getAppFromFlag(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		mh, err := provideManifestHandler(ctx, cfgFile)
+		if err != nil {
+			return err
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		resp, err := mh.Apply(ctx, app.ID, &m, dryRun)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range resp.Bots {
+			switch r.Action {
+			case api.ManifestActionCreate:
+				fmt.Printf("+ %s\n", r.Name)
+			case api.ManifestActionUpdate:
+				fmt.Printf("~ %s\n", r.Name)
+			default:
+				fmt.Printf("  %s\n", r.Name)
+			}
+			for _, c := range r.Changes {
+				from, _ := json.Marshal(c.From)
+				to, _ := json.Marshal(c.To)
+				fmt.Printf("    %s: %s -> %s\n", c.Field, from, to)
+			}
+			for _, w := range r.Warnings {
+				fmt.Printf("    warning: %s\n", w)
+			}
+		}
+		if dryRun {
+			fmt.Println("dry run, nothing applied")
+		}
+		return nil
+	},
+}
+
+func getAppFromFlag(ctx context.Context, cmd *cobra.Command) (*models.App, error) {
+	appIDStr, _ := cmd.Flags().GetString("app-id")
+	appID, err := uuid.Parse(appIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --app-id: %w", err)
+	}
+
+	sh, err := provideStorage(cfgFile)
+	if err != nil {
+		return nil, err
+	}
+	app, err := sh.GetAppByAppID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	if app == nil {
+		return nil, fmt.Errorf("app not found: %s", appID)
+	}
+	return app, nil
+}
+
+func init() {
+	rootCmd.AddCommand(botsCmd)
+	botsCmd.AddCommand(botsExportCmd, botsApplyCmd)
+	botsCmd.PersistentFlags().String("app-id", "", "app id of the bots")
+	botsCmd.MarkPersistentFlagRequired("app-id")
+
+	botsExportCmd.Flags().StringSliceP("name", "n", nil, "names of the bots to export, all bots if not set")
+	botsExportCmd.Flags().StringP("format", "f", string(api.ManifestFormatYAML), "manifest format: yaml or json")
+	botsExportCmd.Flags().StringP("output", "o", "", "output file, defaults to stdout")
+
+	botsApplyCmd.Flags().Bool("dry-run", false, "only print the changes")
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/internal/export"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export one conversation or all conversations of a bot",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		botID, _ := cmd.Flags().GetUint("bot-id")
+		convIDStr, _ := cmd.Flags().GetString("conv-id")
+		if (botID == 0) == (convIDStr == "") {
+			return errors.New("exactly one of --bot-id and --conv-id is required")
+		}
+
+		formatStr, _ := cmd.Flags().GetString("format")
+		format := api.ExportFormat(formatStr)
+		switch format {
+		case api.ExportFormatJSON, api.ExportFormatMarkdown, api.ExportFormatJSONL:
+		default:
+			return fmt.Errorf("invalid format: %s", formatStr)
+		}
+
+		var (
+			f   export.Filter
+			err error
+		)
+		sinceStr, _ := cmd.Flags().GetString("since")
+		if f.Since, err = parseExportTime(sinceStr); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		untilStr, _ := cmd.Flags().GetString("until")
+		if f.Until, err = parseExportTime(untilStr); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+		statuses, _ := cmd.Flags().GetStringSlice("status")
+		for _, s := range statuses {
+			status, err := api.ParseTurnStatus(s)
+			if err != nil {
+				return err
+			}
+			f.Status = append(f.Status, status)
+		}
+
+		sh, err := provideStorage(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			file, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+
+		ctx := cmd.Context()
+		exporter := export.New(sh)
+		if botID != 0 {
+			bot, err := sh.GetBot(ctx, botID)
+			if err != nil {
+				return err
+			}
+			if bot == nil {
+				return fmt.Errorf("bot not found: %d", botID)
+			}
+			return exporter.ExportBot(ctx, w, format, bot, f)
+		}
+
+		convID, err := uuid.Parse(convIDStr)
+		if err != nil {
+			return err
+		}
+		conv, err := sh.GetConv(ctx, convID)
+		if err != nil {
+			return err
+		}
+		if conv == nil {
+			return fmt.Errorf("conversation not found: %s", convID)
+		}
+		return exporter.ExportConv(ctx, w, format, conv, f)
+	},
+}
+
+func parseExportTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().Uint("bot-id", 0, "export all conversations of the bot")
+	exportCmd.Flags().String("conv-id", "", "export the conversation")
+	exportCmd.Flags().StringP("format", "f", string(api.ExportFormatJSON), "export format: json, markdown or jsonl")
+	exportCmd.Flags().String("since", "", "only export turns created at or after this date (2006-01-02 or RFC3339)")
+	exportCmd.Flags().String("until", "", "only export turns created before this date (2006-01-02 or RFC3339)")
+	exportCmd.Flags().StringSlice("status", nil, "only export turns with these statuses: init, processing, success, failed")
+	exportCmd.Flags().StringP("output", "o", "", "output file, defaults to stdout")
+}
@@ -4,11 +4,18 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/wire"
 	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/internal/experiment"
+	"github.com/pandodao/botastic/internal/export"
 	"github.com/pandodao/botastic/internal/httpd"
+	"github.com/pandodao/botastic/internal/manifest"
+	"github.com/pandodao/botastic/internal/quota"
+	"github.com/pandodao/botastic/internal/search"
 	"github.com/pandodao/botastic/internal/starter"
 	"github.com/pandodao/botastic/internal/vector"
+	"github.com/pandodao/botastic/internal/webhook"
 	"github.com/pandodao/botastic/pkg/chanhub"
 	"github.com/pandodao/botastic/pkg/llms"
 	"github.com/pandodao/botastic/pkg/middleware"
@@ -23,7 +30,7 @@ func provideHttpdStarter(ctx context.Context, cfgFile string) (starter.Starter,
 		provideLogger,
 		wire.NewSet(
 			config.Init,
-			wire.FieldsOf(new(*config.Config), "Log", "Httpd", "DB", "LLMs", "State", "VectorStorage"),
+			wire.FieldsOf(new(*config.Config), "Log", "Httpd", "DB", "LLMs", "State", "VectorStorage", "Quota", "Webhook", "Middlewares", "Search"),
 		),
 		wire.NewSet(storage.Init),
 		wire.NewSet(llms.New),
@@ -33,12 +40,34 @@ func provideHttpdStarter(ctx context.Context, cfgFile string) (starter.Starter,
 			vector.NewIndexHandler,
 		),
 		wire.NewSet(
+			search.New,
 			middleware.NewFetch,
 			middleware.NewDDGSearch,
+			middleware.NewWebSearch,
+			middleware.NewBotasticSearch,
+			middleware.NewModeration,
+			middleware.NewRedact,
+			middleware.NewRemotes,
 			provideMiddlewares,
+			middleware.NewRegex,
+			middleware.NewJSONValidate,
+			middleware.NewProfanityFilter,
+			middleware.NewTranslate,
+			middleware.NewFormat,
+			middleware.NewUnredact,
+			provideResponseMiddlewares,
 			middleware.New,
 			wire.Bind(new(httpd.MiddlewareHandler), new(*middleware.Handler)),
 			wire.Bind(new(state.MiddlewareHandler), new(*middleware.Handler)),
+			wire.Bind(new(manifest.MiddlewareValidator), new(*middleware.Handler)),
+		),
+		wire.NewSet(quota.New),
+		wire.NewSet(export.New),
+		wire.NewSet(experiment.New),
+		wire.NewSet(manifest.New),
+		wire.NewSet(
+			webhook.New,
+			wire.Bind(new(state.TurnNotifier), new(*webhook.Dispatcher)),
 		),
 		wire.NewSet(
 			httpd.New,
@@ -47,6 +76,7 @@ func provideHttpdStarter(ctx context.Context, cfgFile string) (starter.Starter,
 		wire.NewSet(
 			state.New,
 			wire.Bind(new(httpd.TurnTransmitter), new(*state.Handler)),
+			wire.Bind(new(httpd.TurnPreviewer), new(*state.Handler)),
 		),
 		wire.NewSet(
 			provideStarters,
@@ -55,8 +85,53 @@ func provideHttpdStarter(ctx context.Context, cfgFile string) (starter.Starter,
 	))
 }
 
-func provideStarters(s1 *httpd.Server, s2 *state.Handler) []starter.Starter {
-	return []starter.Starter{s1, s2}
+func provideStorage(cfgFile string) (*storage.Handler, error) {
+	panic(wire.Build(
+		config.Init,
+		wire.FieldsOf(new(*config.Config), "DB"),
+		storage.Init,
+	))
+}
+
+func provideManifestHandler(ctx context.Context, cfgFile string) (*manifest.Handler, error) {
+	panic(wire.Build(
+		provideLogger,
+		config.Init,
+		wire.FieldsOf(new(*config.Config), "Log", "DB", "LLMs", "VectorStorage", "Middlewares", "Search"),
+		storage.Init,
+		llms.New,
+		vector.Init,
+		vector.NewIndexHandler,
+		wire.NewSet(
+			search.New,
+			middleware.NewFetch,
+			middleware.NewDDGSearch,
+			middleware.NewWebSearch,
+			middleware.NewBotasticSearch,
+			middleware.NewModeration,
+			middleware.NewRedact,
+			middleware.NewRemotes,
+			provideMiddlewares,
+			middleware.NewRegex,
+			middleware.NewJSONValidate,
+			middleware.NewProfanityFilter,
+			middleware.NewTranslate,
+			middleware.NewFormat,
+			middleware.NewUnredact,
+			provideResponseMiddlewares,
+			middleware.New,
+			wire.Bind(new(manifest.MiddlewareValidator), new(*middleware.Handler)),
+		),
+		manifest.New,
+	))
+}
+
+func provideStarters(s1 *httpd.Server, s2 *state.Handler, s3 *webhook.Dispatcher) []starter.Starter {
+	return []starter.Starter{s1, s2, s3}
+}
+
+func provideResponseMiddlewares(m1 *middleware.Regex, m2 *middleware.JSONValidate, m3 *middleware.ProfanityFilter, m4 *middleware.Translate, m5 *middleware.Format, m6 *middleware.Unredact) []middleware.ResponseMiddleware {
+	return []middleware.ResponseMiddleware{m1, m2, m3, m4, m5, m6}
 }
 
 func provideLogger(cfg config.LogConfig) (*zap.Logger, error) {
@@ -69,6 +144,19 @@ func provideLogger(cfg config.LogConfig) (*zap.Logger, error) {
 	return zapCfg.Build()
 }
 
-func provideMiddlewares(m1 *middleware.Fetch, m2 *middleware.DDGSearch) []middleware.Middleware {
-	return []middleware.Middleware{m1, m2}
+func provideMiddlewares(m1 *middleware.Fetch, m2 *middleware.DDGSearch, m3 *middleware.BotasticSearch, m4 *middleware.Moderation, m5 *middleware.Redact, m6 *middleware.WebSearch, remotes []*middleware.Remote) ([]middleware.Middleware, error) {
+	ms := []middleware.Middleware{m1, m2, m3, m4, m5, m6}
+	for _, r := range remotes {
+		ms = append(ms, r)
+	}
+
+	names := map[string]bool{}
+	for _, m := range ms {
+		name := m.Desc().Name
+		if names[name] {
+			return nil, fmt.Errorf("duplicate middleware name: %s", name)
+		}
+		names[name] = true
+	}
+	return ms, nil
 }
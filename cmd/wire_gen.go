@@ -8,10 +8,17 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/internal/experiment"
+	"github.com/pandodao/botastic/internal/export"
 	"github.com/pandodao/botastic/internal/httpd"
+	"github.com/pandodao/botastic/internal/manifest"
+	"github.com/pandodao/botastic/internal/quota"
+	"github.com/pandodao/botastic/internal/search"
 	"github.com/pandodao/botastic/internal/starter"
 	"github.com/pandodao/botastic/internal/vector"
+	"github.com/pandodao/botastic/internal/webhook"
 	"github.com/pandodao/botastic/pkg/chanhub"
 	"github.com/pandodao/botastic/pkg/llms"
 	"github.com/pandodao/botastic/pkg/middleware"
@@ -43,28 +50,125 @@ func provideHttpdStarter(ctx context.Context, cfgFile2 string) (starter.Starter,
 	if err != nil {
 		return nil, err
 	}
-	fetch := middleware.NewFetch()
-	ddgSearch := middleware.NewDDGSearch()
-	v := provideMiddlewares(fetch, ddgSearch)
-	middlewareHandler := middleware.New(v...)
-	stateHandler := state.New(stateConfig, logger, handler, llmsHandler, hub, middlewareHandler)
+	middlewaresConfig := configConfig.Middlewares
+	fetch := middleware.NewFetch(middlewaresConfig, llmsHandler)
+	searchConfig := configConfig.Search
+	searchHandler := search.New(searchConfig)
+	ddgSearch := middleware.NewDDGSearch(searchHandler)
 	vectorStorageConfig := configConfig.VectorStorage
-	vectorStorage, err := vector.Init(ctx, vectorStorageConfig)
+	vectorStorage, err := vector.Init(ctx, vectorStorageConfig, handler)
 	if err != nil {
 		return nil, err
 	}
 	indexHandler := vector.NewIndexHandler(vectorStorage, handler, llmsHandler, logger)
-	httpdHandler := httpd.NewHandler(handler, llmsHandler, hub, stateHandler, logger, middlewareHandler, indexHandler)
+	botasticSearch := middleware.NewBotasticSearch(indexHandler, llmsHandler)
+	v, err := middleware.NewRemotes(ctx, middlewaresConfig, handler, logger)
+	if err != nil {
+		return nil, err
+	}
+	moderation := middleware.NewModeration(llmsHandler)
+	redact := middleware.NewRedact()
+	webSearch := middleware.NewWebSearch(searchHandler)
+	v2, err := provideMiddlewares(fetch, ddgSearch, botasticSearch, moderation, redact, webSearch, v)
+	if err != nil {
+		return nil, err
+	}
+	regex := middleware.NewRegex()
+	jsonValidate := middleware.NewJSONValidate()
+	profanityFilter := middleware.NewProfanityFilter()
+	translate := middleware.NewTranslate(llmsHandler)
+	format := middleware.NewFormat()
+	unredact := middleware.NewUnredact()
+	v3 := provideResponseMiddlewares(regex, jsonValidate, profanityFilter, translate, format, unredact)
+	middlewareHandler := middleware.New(handler, llmsHandler, v2, v3)
+	webhookConfig := configConfig.Webhook
+	dispatcher := webhook.New(webhookConfig, handler, logger)
+	stateHandler := state.New(stateConfig, logger, handler, llmsHandler, hub, middlewareHandler, dispatcher)
+	quotaConfig := configConfig.Quota
+	quotaHandler := quota.New(quotaConfig, handler)
+	exporter := export.New(handler)
+	experimentHandler := experiment.New(handler)
+	manifestHandler := manifest.New(handler, llmsHandler, middlewareHandler)
+	httpdHandler := httpd.NewHandler(handler, llmsHandler, hub, stateHandler, stateHandler, logger, middlewareHandler, indexHandler, quotaHandler, exporter, experimentHandler, manifestHandler)
 	server := httpd.New(httpdConfig, httpdHandler, logger)
-	v2 := provideStarters(server, stateHandler)
-	starterStarter := starter.Multi(v2...)
+	v4 := provideStarters(server, stateHandler, dispatcher)
+	starterStarter := starter.Multi(v4...)
 	return starterStarter, nil
 }
 
+func provideStorage(cfgFile2 string) (*storage.Handler, error) {
+	configConfig, err := config.Init(cfgFile2)
+	if err != nil {
+		return nil, err
+	}
+	dbConfig := configConfig.DB
+	handler, err := storage.Init(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+func provideManifestHandler(ctx context.Context, cfgFile2 string) (*manifest.Handler, error) {
+	configConfig, err := config.Init(cfgFile2)
+	if err != nil {
+		return nil, err
+	}
+	dbConfig := configConfig.DB
+	handler, err := storage.Init(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	llMsConfig := configConfig.LLMs
+	llmsHandler := llms.New(llMsConfig)
+	middlewaresConfig := configConfig.Middlewares
+	fetch := middleware.NewFetch(middlewaresConfig, llmsHandler)
+	searchConfig := configConfig.Search
+	searchHandler := search.New(searchConfig)
+	ddgSearch := middleware.NewDDGSearch(searchHandler)
+	vectorStorageConfig := configConfig.VectorStorage
+	vectorStorage, err := vector.Init(ctx, vectorStorageConfig, handler)
+	if err != nil {
+		return nil, err
+	}
+	logConfig := configConfig.Log
+	logger, err := provideLogger(logConfig)
+	if err != nil {
+		return nil, err
+	}
+	indexHandler := vector.NewIndexHandler(vectorStorage, handler, llmsHandler, logger)
+	botasticSearch := middleware.NewBotasticSearch(indexHandler, llmsHandler)
+	v, err := middleware.NewRemotes(ctx, middlewaresConfig, handler, logger)
+	if err != nil {
+		return nil, err
+	}
+	moderation := middleware.NewModeration(llmsHandler)
+	redact := middleware.NewRedact()
+	webSearch := middleware.NewWebSearch(searchHandler)
+	v2, err := provideMiddlewares(fetch, ddgSearch, botasticSearch, moderation, redact, webSearch, v)
+	if err != nil {
+		return nil, err
+	}
+	regex := middleware.NewRegex()
+	jsonValidate := middleware.NewJSONValidate()
+	profanityFilter := middleware.NewProfanityFilter()
+	translate := middleware.NewTranslate(llmsHandler)
+	format := middleware.NewFormat()
+	unredact := middleware.NewUnredact()
+	v3 := provideResponseMiddlewares(regex, jsonValidate, profanityFilter, translate, format, unredact)
+	middlewareHandler := middleware.New(handler, llmsHandler, v2, v3)
+	manifestHandler := manifest.New(handler, llmsHandler, middlewareHandler)
+	return manifestHandler, nil
+}
+
 // wire.go:
 
-func provideStarters(s1 *httpd.Server, s2 *state.Handler) []starter.Starter {
-	return []starter.Starter{s1, s2}
+func provideStarters(s1 *httpd.Server, s2 *state.Handler, s3 *webhook.Dispatcher) []starter.Starter {
+	return []starter.Starter{s1, s2, s3}
+}
+
+func provideResponseMiddlewares(m1 *middleware.Regex, m2 *middleware.JSONValidate, m3 *middleware.ProfanityFilter, m4 *middleware.Translate, m5 *middleware.Format, m6 *middleware.Unredact) []middleware.ResponseMiddleware {
+	return []middleware.ResponseMiddleware{m1, m2, m3, m4, m5, m6}
 }
 
 func provideLogger(cfg config.LogConfig) (*zap.Logger, error) {
@@ -77,6 +181,19 @@ func provideLogger(cfg config.LogConfig) (*zap.Logger, error) {
 	return zapCfg.Build()
 }
 
-func provideMiddlewares(m1 *middleware.Fetch, m2 *middleware.DDGSearch) []middleware.Middleware {
-	return []middleware.Middleware{m1, m2}
+func provideMiddlewares(m1 *middleware.Fetch, m2 *middleware.DDGSearch, m3 *middleware.BotasticSearch, m4 *middleware.Moderation, m5 *middleware.Redact, m6 *middleware.WebSearch, remotes []*middleware.Remote) ([]middleware.Middleware, error) {
+	ms := []middleware.Middleware{m1, m2, m3, m4, m5, m6}
+	for _, r := range remotes {
+		ms = append(ms, r)
+	}
+
+	names := map[string]bool{}
+	for _, m := range ms {
+		name := m.Desc().Name
+		if names[name] {
+			return nil, fmt.Errorf("duplicate middleware name: %s", name)
+		}
+		names[name] = true
+	}
+	return ms, nil
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
@@ -15,6 +16,10 @@ type Config struct {
 	VectorStorage VectorStorageConfig `yaml:"vector_storage"`
 	LLMs          LLMsConfig          `yaml:"llms"`
 	State         StateConfig         `yaml:"state"`
+	Quota         QuotaConfig         `yaml:"quota"`
+	Webhook       WebhookConfig       `yaml:"webhook"`
+	Middlewares   MiddlewaresConfig   `yaml:"middlewares"`
+	Search        SearchConfig        `yaml:"search"`
 }
 
 func (c Config) String() string {
@@ -38,6 +43,132 @@ type StateConfig struct {
 	WorkerCount int `yaml:"worker_count"`
 }
 
+// QuotaConfig holds the default limits applied when turns are created,
+// 0 means unlimited. Apps can override the app limits.
+type QuotaConfig struct {
+	AppRequestsPerMinute  int   `yaml:"app_requests_per_minute"`
+	UserRequestsPerMinute int   `yaml:"user_requests_per_minute"`
+	AppMonthlyTokens      int64 `yaml:"app_monthly_tokens"`
+	UserMonthlyTokens     int64 `yaml:"user_monthly_tokens"`
+}
+
+func (c QuotaConfig) Validate() error {
+	if c.AppRequestsPerMinute < 0 || c.UserRequestsPerMinute < 0 {
+		return fmt.Errorf("quota.*_requests_per_minute must not be negative")
+	}
+	if c.AppMonthlyTokens < 0 || c.UserMonthlyTokens < 0 {
+		return fmt.Errorf("quota.*_monthly_tokens must not be negative")
+	}
+	return nil
+}
+
+type WebhookConfig struct {
+	MaxAttempts    int `yaml:"max_attempts"`
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+	// WorkerCount is the number of webhook urls delivered to in parallel,
+	// the deliveries to a url are sequential.
+	WorkerCount int `yaml:"worker_count"`
+}
+
+func (c WebhookConfig) Validate() error {
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("webhook.max_attempts must be positive")
+	}
+	if c.TimeoutSeconds <= 0 {
+		return fmt.Errorf("webhook.timeout_seconds must be positive")
+	}
+	if c.WorkerCount <= 0 {
+		return fmt.Errorf("webhook.worker_count must be positive")
+	}
+	return nil
+}
+
+// MiddlewaresConfig registers the remote middlewares, served over HTTP and
+// listed and run like the builtin ones, and the secrets the headers of the
+// fetch middleware refer to as ${NAME}, which are kept out of bot configs.
+type MiddlewaresConfig struct {
+	Remote  []RemoteMiddlewareConfig `yaml:"remote"`
+	Secrets map[string]SecretConfig  `yaml:"secrets"`
+}
+
+// SecretConfig is a secret the headers of the fetch middleware can refer to.
+// Bots of any app can refer to it, so it is only sent to the listed hosts.
+type SecretConfig struct {
+	Value string `yaml:"value"`
+	// Hosts are the hosts of the urls the secret can be sent to, e.g.
+	// api.example.com.
+	Hosts []string `yaml:"hosts"`
+}
+
+type RemoteMiddlewareConfig struct {
+	// URL is the base url of the middleware, serving GET /describe and
+	// POST /process.
+	URL string `yaml:"url"`
+	// Secret signs the requests to the middleware like webhook requests,
+	// they are not signed if empty.
+	Secret string `yaml:"secret"`
+}
+
+func (c MiddlewaresConfig) Validate() error {
+	for i, r := range c.Remote {
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("middlewares.remote[%d].url is invalid: %s", i, r.URL)
+		}
+	}
+	for name, s := range c.Secrets {
+		if len(s.Hosts) == 0 {
+			return fmt.Errorf("middlewares.secrets.%s.hosts is required", name)
+		}
+	}
+	return nil
+}
+
+// SearchConfig holds the web search providers of the web-search middleware by
+// name, a duckduckgo provider named duckduckgo is added if missing.
+type SearchConfig struct {
+	Providers map[string]SearchProviderConfig `yaml:"providers"`
+}
+
+type SearchProviderConfig struct {
+	Type SearchProviderType `yaml:"type"`
+	// BaseURL replaces the url of the public service, it is required for
+	// searxng, which has no public instance.
+	BaseURL string `yaml:"base_url"`
+	// APIKey is required for brave and bing.
+	APIKey string `yaml:"api_key"`
+	// MaxConcurrency limits the concurrent searches, 10 if 0.
+	MaxConcurrency int `yaml:"max_concurrency"`
+}
+
+func (c SearchConfig) Validate() error {
+	for name, p := range c.Providers {
+		switch p.Type {
+		case SearchProviderDuckDuckGo:
+		case SearchProviderSearxNG:
+			if p.BaseURL == "" {
+				return fmt.Errorf("search.providers.%s.base_url is required", name)
+			}
+		case SearchProviderBrave, SearchProviderBing:
+			if p.APIKey == "" {
+				return fmt.Errorf("search.providers.%s.api_key is required", name)
+			}
+		default:
+			return fmt.Errorf("search.providers.%s.type is invalid: %s", name, p.Type)
+		}
+		if p.BaseURL != "" {
+			u, err := url.Parse(p.BaseURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("search.providers.%s.base_url is invalid: %s", name, p.BaseURL)
+			}
+		}
+		if p.MaxConcurrency < 0 {
+			return fmt.Errorf("search.providers.%s.max_concurrency must not be negative", name)
+		}
+	}
+	return nil
+}
+
 type LLMsConfig struct {
 	Enabled []string             `yaml:"enabled"`
 	Items   map[string]LLMConfig `yaml:"items"`
@@ -85,6 +216,9 @@ type OpenAIConfig struct {
 	Key             string   `yaml:"key"`
 	ChatModels      []string `yaml:"chat_models"`
 	EmbeddingModels []string `yaml:"embedding_models"`
+	// BaseURL is the url of an API compatible with OpenAI's, e.g. of a proxy,
+	// OpenAI's if empty.
+	BaseURL string `yaml:"base_url"`
 }
 
 type HttpdConfig struct {
@@ -143,7 +277,7 @@ func (c DBConfig) Validate() error {
 }
 
 func (c Config) validate() error {
-	for _, v := range []any{c.Log, c.Httpd, c.DB, c.VectorStorage, c.LLMs, c.State} {
+	for _, v := range []any{c.Log, c.Httpd, c.DB, c.VectorStorage, c.LLMs, c.State, c.Quota, c.Webhook, c.Middlewares, c.Search} {
 		if vi, ok := v.(interface{ Validate() error }); ok {
 			if err := vi.Validate(); err != nil {
 				return err
@@ -173,6 +307,17 @@ func ExampleConfig() *Config {
 		State: StateConfig{
 			WorkerCount: 10,
 		},
+		Webhook: WebhookConfig{
+			MaxAttempts:    10,
+			TimeoutSeconds: 10,
+			WorkerCount:    10,
+		},
+		Quota: QuotaConfig{
+			AppRequestsPerMinute:  600,
+			UserRequestsPerMinute: 20,
+			AppMonthlyTokens:      10000000,
+			UserMonthlyTokens:     100000,
+		},
 		LLMs: LLMsConfig{
 			Enabled: []string{"openai-1"},
 			Items: map[string]LLMConfig{
@@ -186,6 +331,13 @@ func ExampleConfig() *Config {
 				},
 			},
 		},
+		Search: SearchConfig{
+			Providers: map[string]SearchProviderConfig{
+				"duckduckgo": {
+					Type: SearchProviderDuckDuckGo,
+				},
+			},
+		},
 	}
 }
 
@@ -208,6 +360,11 @@ func DefaultConfig() *Config {
 		State: StateConfig{
 			WorkerCount: 10,
 		},
+		Webhook: WebhookConfig{
+			MaxAttempts:    10,
+			TimeoutSeconds: 10,
+			WorkerCount:    10,
+		},
 	}
 }
 
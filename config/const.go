@@ -20,3 +20,12 @@ type LLMProvider string
 const (
 	LLMProviderOpenAI LLMProvider = "openai"
 )
+
+type SearchProviderType string
+
+const (
+	SearchProviderDuckDuckGo SearchProviderType = "duckduckgo"
+	SearchProviderSearxNG    SearchProviderType = "searxng"
+	SearchProviderBrave      SearchProviderType = "brave"
+	SearchProviderBing       SearchProviderType = "bing"
+)
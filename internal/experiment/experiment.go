@@ -0,0 +1,153 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+)
+
+type Handler struct {
+	sh *storage.Handler
+}
+
+func New(sh *storage.Handler) *Handler {
+	return &Handler{
+		sh: sh,
+	}
+}
+
+// Assign assigns the new conversation to a variant of the running experiment
+// of its bot, if any, pinning the bot version of the variant, 0 follows the
+// published version. Conversations pinning a bot version themselves are left
+// out of experiments.
+func (h *Handler) Assign(ctx context.Context, conv *models.Conv) error {
+	if conv.BotVersion != 0 {
+		return nil
+	}
+
+	e, err := h.sh.GetRunningExperiment(ctx, conv.BotID)
+	if err != nil || e == nil {
+		return err
+	}
+
+	v := pickVariant(e, conv.UserIdentity)
+	conv.ExperimentID = e.ID
+	conv.Variant = v.Name
+	conv.BotVersion = v.BotVersion
+	return nil
+}
+
+// pickVariant picks a variant by weight, the same user always gets the same
+// variant of an experiment.
+func pickVariant(e *models.Experiment, userIdentity string) *api.ExperimentVariant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+
+	var n int
+	if userIdentity == "" {
+		n = rand.Intn(total)
+	} else {
+		hash := fnv.New32a()
+		fmt.Fprintf(hash, "%d:%s", e.ID, userIdentity)
+		n = int(hash.Sum32() % uint32(total))
+	}
+
+	for _, v := range e.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1]
+}
+
+// Metrics computes the metrics of each variant of the experiment.
+func (h *Handler) Metrics(ctx context.Context, e *models.Experiment) (*api.ExperimentMetrics, error) {
+	r := &api.ExperimentMetrics{
+		ExperimentID: e.ID,
+		Variants:     make([]*api.ExperimentVariantMetrics, len(e.Variants)),
+	}
+	byName := make(map[string]*api.ExperimentVariantMetrics, len(e.Variants))
+	for i, v := range e.Variants {
+		r.Variants[i] = &api.ExperimentVariantMetrics{
+			Variant:    v.Name,
+			BotVersion: v.BotVersion,
+		}
+		byName[v.Name] = r.Variants[i]
+	}
+
+	counts, err := h.sh.CountExperimentConvs(ctx, e.ID)
+	if err != nil {
+		return nil, err
+	}
+	for name, count := range counts {
+		if m, ok := byName[name]; ok {
+			m.Conversations = count
+		}
+	}
+
+	// the turns processed before the processing times were stored have no
+	// latency
+	latencies := make(map[string]int64, len(e.Variants))
+	timedTurns := make(map[string]int64, len(e.Variants))
+	if err := h.sh.EachExperimentTurn(ctx, e.ID, func(variant string, turn *models.Turn) error {
+		m, ok := byName[variant]
+		if !ok {
+			return nil
+		}
+
+		m.Turns++
+		if turn.Status == api.TurnStatusFailed {
+			m.FailedTurns++
+			return nil
+		}
+		m.PromptTokens += int64(turn.PromptTokens)
+		m.CompletionTokens += int64(turn.CompletionTokens)
+		m.TotalTokens += int64(turn.TotalTokens)
+		if turn.ProcessingStartedAt != nil && turn.ProcessedAt != nil {
+			latencies[variant] += turn.ProcessedAt.Sub(*turn.ProcessingStartedAt).Milliseconds()
+			timedTurns[variant]++
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	feedback, err := h.sh.CountExperimentFeedback(ctx, e.ID)
+	if err != nil {
+		return nil, err
+	}
+	for name, ratings := range feedback {
+		m, ok := byName[name]
+		if !ok {
+			continue
+		}
+		m.ThumbsUp = ratings[api.FeedbackRatingUp]
+		m.ThumbsDown = ratings[api.FeedbackRatingDown]
+		m.Feedbacks = m.ThumbsUp + m.ThumbsDown
+	}
+
+	for _, m := range r.Variants {
+		if m.Feedbacks > 0 {
+			m.FeedbackScore = float64(m.ThumbsUp-m.ThumbsDown) / float64(m.Feedbacks)
+		}
+		if m.Turns > 0 {
+			m.FailureRate = float64(m.FailedTurns) / float64(m.Turns)
+		}
+		// latency and tokens of the succeeded turns only
+		if n := timedTurns[m.Variant]; n > 0 {
+			m.AvgLatencyMs = float64(latencies[m.Variant]) / float64(n)
+		}
+		if succeeded := m.Turns - m.FailedTurns; succeeded > 0 {
+			m.AvgTotalTokens = float64(m.TotalTokens) / float64(succeeded)
+		}
+	}
+	return r, nil
+}
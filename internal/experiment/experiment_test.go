@@ -0,0 +1,88 @@
+package experiment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+	"gorm.io/gorm"
+)
+
+func TestMetricsLatency(t *testing.T) {
+	ctx := context.Background()
+	sh, err := storage.Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bot := &models.Bot{AppID: 1, Name: "bot", ChatModel: "openai:gpt-3.5-turbo"}
+	if err := sh.CreateBot(ctx, bot); err != nil {
+		t.Fatal(err)
+	}
+	e := &models.Experiment{AppID: 1, BotID: bot.ID, Variants: models.ExperimentVariants{
+		{Name: "a", BotVersion: 1, Weight: 1},
+		{Name: "b", BotVersion: 2, Weight: 1},
+	}}
+	if err := sh.CreateExperiment(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	conv := &models.Conv{ID: uuid.New(), AppID: 1, BotID: bot.ID, ExperimentID: e.ID, Variant: "a"}
+	if err := sh.CreateConv(ctx, conv); err != nil {
+		t.Fatal(err)
+	}
+
+	// the turns are created long before they are processed
+	created := time.Now().Add(-time.Hour)
+	turn := func(status api.TurnStatus, latency time.Duration) *models.Turn {
+		turn := &models.Turn{
+			Model:       gorm.Model{CreatedAt: created},
+			AppID:       1,
+			ConvID:      conv.ID,
+			BotID:       1,
+			Status:      status,
+			TotalTokens: 10,
+		}
+		if latency > 0 {
+			started := time.Now()
+			processed := started.Add(latency)
+			turn.ProcessingStartedAt = &started
+			turn.ProcessedAt = &processed
+		}
+		return turn
+	}
+	if err := sh.CreateTurns(ctx, []*models.Turn{
+		turn(api.TurnStatusSuccess, 100*time.Millisecond),
+		turn(api.TurnStatusSuccess, 300*time.Millisecond),
+		// processed before the processing times were stored
+		turn(api.TurnStatusSuccess, 0),
+		turn(api.TurnStatusFailed, time.Second),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(sh).Metrics(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := r.Variants[0], r.Variants[1]
+	if a.Turns != 4 || a.FailedTurns != 1 {
+		t.Errorf("turns = %d, failed turns = %d, want 4 and 1", a.Turns, a.FailedTurns)
+	}
+	if a.AvgLatencyMs != 200 {
+		t.Errorf("avg latency = %v ms, want 200", a.AvgLatencyMs)
+	}
+	if a.AvgTotalTokens != 10 {
+		t.Errorf("avg total tokens = %v, want 10", a.AvgTotalTokens)
+	}
+	if b.Turns != 0 || b.AvgLatencyMs != 0 {
+		t.Errorf("variant b = %+v, want no turns", b)
+	}
+}
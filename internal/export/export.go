@@ -0,0 +1,403 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+)
+
+const pageSize = 100
+
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Status []api.TurnStatus
+}
+
+type Exporter struct {
+	sh *storage.Handler
+}
+
+func New(sh *storage.Handler) *Exporter {
+	return &Exporter{
+		sh: sh,
+	}
+}
+
+// ContentType returns the MIME type of the given export format.
+func ContentType(format api.ExportFormat) string {
+	switch format {
+	case api.ExportFormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case api.ExportFormatJSONL:
+		return "application/jsonl; charset=utf-8"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// FileExt returns the file extension of the given export format.
+func FileExt(format api.ExportFormat) string {
+	switch format {
+	case api.ExportFormatMarkdown:
+		return "md"
+	case api.ExportFormatJSONL:
+		return "jsonl"
+	default:
+		return "json"
+	}
+}
+
+// ExportConv writes the turns of a conversation matching the filter to w.
+func (e *Exporter) ExportConv(ctx context.Context, w io.Writer, format api.ExportFormat, conv *models.Conv, f Filter) error {
+	bot, err := e.sh.GetBot(ctx, conv.BotID)
+	if err != nil {
+		return err
+	}
+
+	ew := newWriter(w, format, e.newPrompts(ctx, bot))
+	turns, feedback, err := e.listTurns(ctx, conv, f)
+	if err != nil {
+		return err
+	}
+	if err := ew.write(conv, turns, feedback); err != nil {
+		return err
+	}
+
+	return ew.close()
+}
+
+// ExportBot writes all conversations of a bot that have turns matching the
+// filter to w.
+func (e *Exporter) ExportBot(ctx context.Context, w io.Writer, format api.ExportFormat, bot *models.Bot, f Filter) error {
+	ew := newWriter(w, format, e.newPrompts(ctx, bot))
+	params := storage.ListConvsParams{
+		AppID: bot.AppID,
+		BotID: bot.ID,
+		Limit: pageSize,
+	}
+	for {
+		convs, err := e.sh.ListConvs(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		for _, conv := range convs {
+			turns, feedback, err := e.listTurns(ctx, conv, f)
+			if err != nil {
+				return err
+			}
+			if len(turns) == 0 {
+				continue
+			}
+			if err := ew.write(conv, turns, feedback); err != nil {
+				return err
+			}
+		}
+
+		if len(convs) < params.Limit {
+			break
+		}
+		last := convs[len(convs)-1]
+		params.AfterCreatedAt, params.AfterID = last.CreatedAt, last.ID
+	}
+
+	return ew.close()
+}
+
+// listTurns lists the turns of the conversation matching the filter, with
+// their feedback by turn id.
+func (e *Exporter) listTurns(ctx context.Context, conv *models.Conv, f Filter) ([]*models.Turn, map[uint]*models.Feedback, error) {
+	params := storage.ListTurnsParams{
+		ConvID: conv.ID,
+		Status: f.Status,
+		Since:  f.Since,
+		Until:  f.Until,
+		Limit:  pageSize,
+	}
+
+	var turns []*models.Turn
+	for {
+		ts, err := e.sh.ListTurns(ctx, params)
+		if err != nil {
+			return nil, nil, err
+		}
+		turns = append(turns, ts...)
+		if len(ts) < params.Limit {
+			break
+		}
+		params.AfterID = ts[len(ts)-1].ID
+	}
+
+	ids := make([]uint, 0, len(turns))
+	for _, t := range turns {
+		ids = append(ids, t.ID)
+	}
+	feedback, err := e.sh.GetTurnsFeedback(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return turns, feedback, nil
+}
+
+func (e *Exporter) newPrompts(ctx context.Context, bot *models.Bot) *prompts {
+	return &prompts{
+		ctx:      ctx,
+		sh:       e.sh,
+		bot:      bot,
+		versions: make(map[int]*models.BotVersion),
+	}
+}
+
+// prompts renders the prompts the chat model got with the turns of a bot.
+type prompts struct {
+	ctx      context.Context
+	sh       *storage.Handler
+	bot      *models.Bot
+	versions map[int]*models.BotVersion
+}
+
+// render returns the prompt of the version of the bot the turn used,
+// rendered with the results of its middlewares as the state did.
+func (p *prompts) render(turn *models.Turn) (string, error) {
+	if p.bot == nil {
+		return "", nil
+	}
+
+	prompt, mc := p.bot.Prompt, p.bot.Middlewares
+	if turn.BotVersion != 0 && turn.BotVersion != p.bot.PublishedVersion {
+		v, ok := p.versions[turn.BotVersion]
+		if !ok {
+			var err error
+			if v, err = p.sh.GetBotVersion(p.ctx, p.bot.ID, turn.BotVersion); err != nil {
+				return "", err
+			}
+			p.versions[turn.BotVersion] = v
+		}
+		if v != nil {
+			prompt, mc = v.Prompt, v.Middlewares
+		}
+	}
+	// prompts of bots without middlewares are sent as they are
+	if prompt == "" || mc == nil {
+		return prompt, nil
+	}
+
+	data := map[string]any{}
+	for _, r := range turn.MiddlewareResults {
+		for k, v := range r.RenderData {
+			data[k] = v
+		}
+	}
+	t, err := template.New("prompt").Funcs(template.FuncMap{
+		"now": func() time.Time { return turn.CreatedAt },
+	}).Parse(prompt)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+type writer struct {
+	w       *bufio.Writer
+	format  api.ExportFormat
+	bot     *models.Bot
+	prompts *prompts
+	// convs is the number of conversations written in the JSON format
+	convs int
+}
+
+func newWriter(w io.Writer, format api.ExportFormat, prompts *prompts) *writer {
+	return &writer{
+		w:       bufio.NewWriter(w),
+		format:  format,
+		bot:     prompts.bot,
+		prompts: prompts,
+	}
+}
+
+func (ew *writer) isJSON() bool {
+	return ew.format == api.ExportFormatJSON || ew.format == ""
+}
+
+func (ew *writer) write(conv *models.Conv, turns []*models.Turn, feedback map[uint]*models.Feedback) error {
+	switch ew.format {
+	case api.ExportFormatMarkdown:
+		return ew.writeMarkdown(conv, turns, feedback)
+	case api.ExportFormatJSONL:
+		return ew.writeJSONL(turns, feedback)
+	default:
+		v := &api.ExportConv{
+			Conv:  conv.API(),
+			Turns: make([]*api.Turn, 0, len(turns)),
+		}
+		for _, t := range turns {
+			at := t.API()
+			if f, ok := feedback[t.ID]; ok {
+				af := f.API()
+				at.Feedback = &af
+			}
+			v.Turns = append(v.Turns, &at)
+		}
+		return ew.writeJSONConv(v)
+	}
+}
+
+// writeJSONConv writes the conversation as the next element of the
+// conversations of api.Export, which is written one conversation at a time
+// rather than held in memory.
+func (ew *writer) writeJSONConv(v *api.ExportConv) error {
+	if ew.convs == 0 {
+		if err := ew.writeJSONHead(); err != nil {
+			return err
+		}
+		ew.w.WriteString("\n")
+	} else {
+		ew.w.WriteString(",\n")
+	}
+	ew.convs++
+
+	data, err := json.MarshalIndent(v, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	ew.w.WriteString("    ")
+	_, err = ew.w.Write(data)
+	return err
+}
+
+func (ew *writer) writeJSONHead() error {
+	ew.w.WriteString("{\n")
+	if ew.bot != nil {
+		data, err := json.MarshalIndent(ew.bot.API(), "  ", "  ")
+		if err != nil {
+			return err
+		}
+		ew.w.WriteString(`  "bot": `)
+		ew.w.Write(data)
+		ew.w.WriteString(",\n")
+	}
+	_, err := ew.w.WriteString(`  "conversations": [`)
+	return err
+}
+
+func (ew *writer) close() error {
+	if ew.isJSON() {
+		if ew.convs == 0 {
+			if err := ew.writeJSONHead(); err != nil {
+				return err
+			}
+			ew.w.WriteString("]\n}\n")
+		} else {
+			ew.w.WriteString("\n  ]\n}\n")
+		}
+	}
+
+	return ew.w.Flush()
+}
+
+func (ew *writer) writeMarkdown(conv *models.Conv, turns []*models.Turn, feedback map[uint]*models.Feedback) error {
+	fmt.Fprintf(ew.w, "# Conversation %s\n\n", conv.ID)
+	if ew.bot != nil {
+		fmt.Fprintf(ew.w, "- Bot: %s (#%d)\n", ew.bot.Name, ew.bot.ID)
+	}
+	if conv.UserIdentity != "" {
+		fmt.Fprintf(ew.w, "- User: %s\n", conv.UserIdentity)
+	}
+	fmt.Fprintf(ew.w, "- Created at: %s\n\n", conv.CreatedAt.UTC().Format(time.RFC3339))
+
+	for _, t := range turns {
+		fmt.Fprintf(ew.w, "## Turn %d (%s, %s)\n\n", t.ID, t.Status, t.CreatedAt.UTC().Format(time.RFC3339))
+		fmt.Fprintf(ew.w, "**User:**\n\n%s\n\n", t.Request)
+		switch {
+		case t.Status == api.TurnStatusSuccess:
+			fmt.Fprintf(ew.w, "**Assistant:**\n\n%s\n\n", t.Response)
+		case t.Error != nil:
+			fmt.Fprintf(ew.w, "**Error:** %s\n\n", t.Error.Error())
+		}
+		if f, ok := feedback[t.ID]; ok {
+			writeMarkdownFeedback(ew.w, f)
+		}
+	}
+
+	_, err := fmt.Fprint(ew.w, "---\n\n")
+	return err
+}
+
+func writeMarkdownFeedback(w io.Writer, f *models.Feedback) {
+	rating := "up"
+	if f.Rating == api.FeedbackRatingDown {
+		rating = "down"
+	}
+	if len(f.Tags) > 0 {
+		rating += " (" + strings.Join(f.Tags, ", ") + ")"
+	}
+	fmt.Fprintf(w, "**Feedback:** %s\n\n", rating)
+	if f.Correction != "" {
+		fmt.Fprintf(w, "**Correction:**\n\n%s\n\n", f.Correction)
+	}
+}
+
+type fineTuningMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// writeJSONL writes the successful turns as one example in the OpenAI chat
+// fine-tuning format. The correction of a turn replaces its response, turns
+// rated down without correction are left out. The system message is the
+// prompt the chat model got with the last turn of the example.
+func (ew *writer) writeJSONL(turns []*models.Turn, feedback map[uint]*models.Feedback) error {
+	messages := make([]fineTuningMessage, 1, len(turns)*2+1)
+	var last *models.Turn
+	for _, t := range turns {
+		if t.Status != api.TurnStatusSuccess {
+			continue
+		}
+		response := t.Response
+		if f, ok := feedback[t.ID]; ok {
+			switch {
+			case f.Correction != "":
+				response = f.Correction
+			case f.Rating == api.FeedbackRatingDown:
+				continue
+			}
+		}
+		messages = append(messages,
+			fineTuningMessage{Role: "user", Content: t.Request},
+			fineTuningMessage{Role: "assistant", Content: response},
+		)
+		last = t
+	}
+	if last == nil {
+		return nil
+	}
+
+	prompt, err := ew.prompts.render(last)
+	if err != nil {
+		return err
+	}
+	if prompt != "" {
+		messages[0] = fineTuningMessage{Role: "system", Content: prompt}
+	} else {
+		messages = messages[1:]
+	}
+
+	return json.NewEncoder(ew.w).Encode(map[string]any{
+		"messages": messages,
+	})
+}
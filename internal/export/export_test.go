@@ -0,0 +1,113 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"gorm.io/gorm"
+)
+
+func testBot() *models.Bot {
+	return &models.Bot{
+		Model:            gorm.Model{ID: 1},
+		Name:             "bot",
+		Prompt:           "now {{now.Year}}, found {{.MIDDLEWARE_s_RESULT}}",
+		Middlewares:      &models.MiddlewareConfig{Items: []*api.Middleware{{ID: "s", Name: "search"}}},
+		PublishedVersion: 2,
+	}
+}
+
+func testTurn(id uint, request, response string) *models.Turn {
+	return &models.Turn{
+		Model:      gorm.Model{ID: id, CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		BotVersion: 2,
+		Request:    request,
+		Response:   response,
+		Status:     api.TurnStatusSuccess,
+		MiddlewareResults: models.MiddlewareResults{
+			{RenderData: map[string]any{"MIDDLEWARE_s_RESULT": request + " results"}},
+		},
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	e := &Exporter{}
+	ew := newWriter(&buf, api.ExportFormatJSONL, e.newPrompts(context.Background(), testBot()))
+	turns := []*models.Turn{
+		testTurn(1, "a", "b"),
+		testTurn(2, "c", "d"),
+		testTurn(3, "e", "f"),
+		{Model: gorm.Model{ID: 4}, Request: "g", Status: api.TurnStatusFailed},
+	}
+	feedback := map[uint]*models.Feedback{
+		2: {Rating: api.FeedbackRatingDown, Correction: "D"},
+		3: {Rating: api.FeedbackRatingDown},
+	}
+	if err := ew.write(&models.Conv{}, turns, feedback); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Messages []fineTuningMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []fineTuningMessage{
+		{Role: "system", Content: "now 2023, found c results"},
+		{Role: "user", Content: "a"},
+		{Role: "assistant", Content: "b"},
+		{Role: "user", Content: "c"},
+		{Role: "assistant", Content: "D"},
+	}
+	if !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("messages = %+v, want %+v", got.Messages, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	bot := testBot()
+	convs := []*models.Conv{{ID: uuid.New()}, {ID: uuid.New()}}
+	for n := 0; n <= len(convs); n++ {
+		var buf bytes.Buffer
+		e := &Exporter{}
+		ew := newWriter(&buf, api.ExportFormatJSON, e.newPrompts(context.Background(), bot))
+		for _, conv := range convs[:n] {
+			if err := ew.write(conv, []*models.Turn{testTurn(1, "a", "b")}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ew.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the output is the indented api.Export, written a conversation at a
+		// time
+		var got api.Export
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("%d conversations: %v\n%s", n, err, buf.String())
+		}
+		if len(got.Conversations) != n || got.Bot == nil || got.Bot.Name != bot.Name {
+			t.Errorf("%d conversations: got %+v", n, got)
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(indented.String()) != strings.TrimSpace(buf.String()) {
+			t.Errorf("%d conversations: the output is not indented:\n%s", n, buf.String())
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package httpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/internal/manifest"
+	"github.com/pandodao/botastic/internal/quota"
+	"github.com/pandodao/botastic/internal/vector"
+	llmsapi "github.com/pandodao/botastic/pkg/llms/api"
+	"github.com/pandodao/botastic/storage"
+	"gorm.io/gorm"
+)
+
+var (
+	errBotNotFound        = errors.New("bot not found")
+	errBotVersionNotFound = errors.New("bot version not found")
+	errConvNotFound       = errors.New("conversation not found")
+	errExperimentNotFound = errors.New("experiment not found")
+	errFeedbackNotFound   = errors.New("feedback not found")
+	errTurnNotFound       = errors.New("turn not found")
+)
+
+func init() {
+	// name the fields in validation errors as the clients do
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return f.Name
+		})
+	}
+}
+
+// errorCode maps err to the status and code of its response. Known errors of
+// the storage, the models and the vector indexes have their own status, other
+// errors keep the given status.
+func errorCode(statusCode int, err error) (int, api.ErrorCode) {
+	var (
+		verr    validator.ValidationErrors
+		ierr    *vector.IndexNotFoundError
+		callErr *llmsapi.CallError
+		qerr    *quota.ExceededError
+		merr    *manifest.InvalidError
+		mbErr   *manifest.BotNotFoundError
+	)
+	switch {
+	case errors.As(err, &verr):
+		return http.StatusBadRequest, api.ErrorCodeValidationFailed
+	case errors.As(err, &merr):
+		return http.StatusBadRequest, api.ErrorCodeInvalidRequest
+	case errors.Is(err, errInvalidCursor):
+		return http.StatusBadRequest, api.ErrorCodeInvalidCursor
+	case errors.Is(err, llmsapi.ErrModelNotFound):
+		return http.StatusBadRequest, api.ErrorCodeModelNotFound
+	case errors.Is(err, llmsapi.ErrTooManyRequestTokens):
+		return http.StatusBadRequest, api.ErrorCodeTooManyRequestTokens
+	case errors.Is(err, errBotNotFound):
+		return http.StatusNotFound, api.ErrorCodeBotNotFound
+	case errors.As(err, &mbErr):
+		return http.StatusNotFound, api.ErrorCodeBotNotFound
+	case errors.Is(err, errBotVersionNotFound):
+		return http.StatusNotFound, api.ErrorCodeBotVersionNotFound
+	case errors.Is(err, errExperimentNotFound):
+		return http.StatusNotFound, api.ErrorCodeExperimentNotFound
+	case errors.Is(err, errFeedbackNotFound):
+		return http.StatusNotFound, api.ErrorCodeFeedbackNotFound
+	case errors.Is(err, errConvNotFound):
+		return http.StatusNotFound, api.ErrorCodeConversationNotFound
+	case errors.Is(err, errTurnNotFound):
+		return http.StatusNotFound, api.ErrorCodeTurnNotFound
+	case errors.As(err, &ierr):
+		return http.StatusNotFound, api.ErrorCodeIndexNotFound
+	case errors.Is(err, storage.ErrBotModified):
+		return http.StatusPreconditionFailed, api.ErrorCodePreconditionFailed
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return http.StatusConflict, api.ErrorCodeConflict
+	case errors.As(err, &qerr):
+		return http.StatusTooManyRequests, qerr.Code
+	case errors.As(err, &callErr):
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return http.StatusGatewayTimeout, api.ErrorCodeModelCallTimeout
+		case callErr.StatusCode == http.StatusTooManyRequests:
+			return http.StatusServiceUnavailable, api.ErrorCodeModelRateLimited
+		default:
+			return http.StatusBadGateway, api.ErrorCodeModelCallFailed
+		}
+	}
+
+	switch statusCode {
+	case http.StatusBadRequest:
+		return statusCode, api.ErrorCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return statusCode, api.ErrorCodeUnauthorized
+	case http.StatusNotFound:
+		return statusCode, api.ErrorCodeNotFound
+	case http.StatusRequestTimeout:
+		return statusCode, api.ErrorCodeTimeout
+	case http.StatusConflict:
+		return statusCode, api.ErrorCodeConflict
+	case http.StatusPreconditionFailed:
+		return statusCode, api.ErrorCodePreconditionFailed
+	case http.StatusTooManyRequests:
+		return statusCode, api.ErrorCodeRateLimitExceeded
+	default:
+		return http.StatusInternalServerError, api.ErrorCodeInternal
+	}
+}
+
+// errorResponse builds the response of err, with the failed fields if err is
+// a validation error.
+func errorResponse(code api.ErrorCode, err error) *api.Response {
+	resp := api.NewErrorResponse(int(code), err.Error())
+
+	var verr validator.ValidationErrors
+	if errors.As(err, &verr) {
+		resp.Message = "invalid request fields"
+		for _, fe := range verr {
+			resp.Details = append(resp.Details, &api.ErrorDetail{
+				Field:   fieldPath(fe),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: validationMessage(fe),
+			})
+		}
+	}
+	return resp
+}
+
+// fieldPath strips the request type and the embedded structs from the
+// namespace of the field, e.g. CreateBotRequest.middlewares.items[0].id to
+// middlewares.items[0].id. They are the only capitalized parts as fields are
+// named by their tags.
+func fieldPath(fe validator.FieldError) string {
+	var parts []string
+	for _, part := range strings.Split(fe.Namespace(), ".") {
+		if part != "" && unicode.IsUpper(rune(part[0])) {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return fe.Field()
+	}
+	return strings.Join(parts, ".")
+}
+
+func validationMessage(fe validator.FieldError) string {
+	field := fieldPath(fe)
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.Join(strings.Fields(fe.Param()), ", "))
+	case "url":
+		return field + " must be a valid url"
+	case "len=0|url":
+		return field + " must be empty or a valid url"
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	default:
+		return fmt.Sprintf("%s failed on the %s rule", field, fe.Tag())
+	}
+}
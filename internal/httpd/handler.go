@@ -1,10 +1,18 @@
 package httpd
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/internal/experiment"
+	"github.com/pandodao/botastic/internal/export"
+	"github.com/pandodao/botastic/internal/manifest"
+	"github.com/pandodao/botastic/internal/quota"
 	"github.com/pandodao/botastic/internal/vector"
 	"github.com/pandodao/botastic/models"
 	"github.com/pandodao/botastic/pkg/chanhub"
@@ -17,8 +25,13 @@ type TurnTransmitter interface {
 	GetTurnsChan() chan<- *models.Turn
 }
 
+type TurnPreviewer interface {
+	PreviewTurn(ctx context.Context, bot *models.Bot, convID uuid.UUID, content string) (*api.PreviewBotResponse, error)
+}
+
 type MiddlewareHandler interface {
 	Middlewares() []*api.MiddlewareDesc
+	ResponseMiddlewares() []*api.MiddlewareDesc
 	GeneralOptions() []*api.MiddlewareDescOption
 	ValidateConfig(*api.MiddlewareConfig) error
 }
@@ -29,29 +42,96 @@ type Handler struct {
 	sh                *storage.Handler
 	hub               *chanhub.Hub
 	turnTransmitter   TurnTransmitter
+	turnPreviewer     TurnPreviewer
 	middlewareHandler MiddlewareHandler
 	vih               *vector.IndexHandler
+	qh                *quota.Handler
+	exporter          *export.Exporter
+	eh                *experiment.Handler
+	manifests         *manifest.Handler
 }
 
-func NewHandler(sh *storage.Handler, llms *llms.Handler, hub *chanhub.Hub, turnTransmitter TurnTransmitter,
-	logger *zap.Logger, middlewareHandler MiddlewareHandler, vih *vector.IndexHandler) *Handler {
+func NewHandler(sh *storage.Handler, llms *llms.Handler, hub *chanhub.Hub, turnTransmitter TurnTransmitter, turnPreviewer TurnPreviewer,
+	logger *zap.Logger, middlewareHandler MiddlewareHandler, vih *vector.IndexHandler, qh *quota.Handler, exporter *export.Exporter, eh *experiment.Handler, manifests *manifest.Handler) *Handler {
 	return &Handler{
 		logger:            logger.Named("httpd/handler"),
 		llms:              llms,
 		sh:                sh,
 		hub:               hub,
 		turnTransmitter:   turnTransmitter,
+		turnPreviewer:     turnPreviewer,
 		middlewareHandler: middlewareHandler,
 		vih:               vih,
+		qh:                qh,
+		exporter:          exporter,
+		eh:                eh,
+		manifests:         manifests,
 	}
 }
 
+const (
+	headerAppID     = "X-BOTASTIC-APPID"
+	headerAppSecret = "X-BOTASTIC-SECRET"
+
+	ctxKeyApp = "app"
+)
+
+// Auth authenticates the request by the app id and secret headers and stores
+// the app in the context, see appFromContext. Clients that can only send a
+// bearer token, like OpenAI clients, can use "app_id:app_secret" as token.
+// Websocket clients that cannot send headers, like browsers, can pass the
+// token in a subprotocol, see websocketToken.
+func (h *Handler) Auth(c *gin.Context) {
+	appIDStr, secret := c.GetHeader(headerAppID), c.GetHeader(headerAppSecret)
+	if appIDStr == "" {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			token, ok = websocketToken(c.Request)
+		}
+		if ok {
+			appIDStr, secret, _ = strings.Cut(token, ":")
+		}
+	}
+
+	appID, err := uuid.Parse(appIDStr)
+	if err != nil {
+		h.respErr(c, http.StatusUnauthorized, errors.New("invalid app id"))
+		c.Abort()
+		return
+	}
+
+	app, err := h.sh.GetAppByAppID(c, appID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		c.Abort()
+		return
+	}
+	if app == nil || !app.VerifySecret(secret) {
+		h.respErr(c, http.StatusUnauthorized, errors.New("invalid app id or secret"))
+		c.Abort()
+		return
+	}
+
+	c.Set(ctxKeyApp, app)
+	c.Next()
+}
+
+func appFromContext(c *gin.Context) *models.App {
+	return c.MustGet(ctxKeyApp).(*models.App)
+}
+
+// respErr responds with the error, statusCode is the status of errors not
+// known by errorCode. The code of the response is mapped from err unless
+// given.
 func (h *Handler) respErr(c *gin.Context, statusCode int, err error, codes ...api.ErrorCode) {
-	code := statusCode
+	statusCode, code := errorCode(statusCode, err)
 	if len(codes) > 0 {
-		code = int(codes[0])
+		code = codes[0]
+	}
+	if statusCode >= http.StatusInternalServerError {
+		h.logger.Error("request failed", zap.String("path", c.FullPath()), zap.Error(err))
 	}
-	c.JSON(code, api.NewErrorResponse(code, err.Error()))
+	c.JSON(statusCode, errorResponse(code, err))
 }
 
 func (h *Handler) respData(c *gin.Context, data interface{}) {
@@ -71,7 +151,8 @@ func (h *Handler) ListModels(c *gin.Context) {
 
 func (h *Handler) ListMiddlewares(c *gin.Context) {
 	h.respData(c, api.ListMiddlewaresResponse{
-		Middlewares:    h.middlewareHandler.Middlewares(),
-		GeneralOptions: h.middlewareHandler.GeneralOptions(),
+		Middlewares:         h.middlewareHandler.Middlewares(),
+		ResponseMiddlewares: h.middlewareHandler.ResponseMiddlewares(),
+		GeneralOptions:      h.middlewareHandler.GeneralOptions(),
 	})
 }
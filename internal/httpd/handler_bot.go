@@ -1,13 +1,21 @@
 package httpd
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
 	"github.com/pandodao/botastic/api"
 	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
 )
 
 func (h *Handler) CreateBot(c *gin.Context) {
@@ -18,7 +26,7 @@ func (h *Handler) CreateBot(c *gin.Context) {
 	}
 
 	if _, err := h.llms.GetChatModel(req.ChatModel); err != nil {
-		h.respErr(c, http.StatusBadRequest, errors.New("chat model does not exist"))
+		h.respErr(c, http.StatusBadRequest, errors.New("chat model does not exist"), api.ErrorCodeModelNotFound)
 		return
 	}
 	if req.Middlewares != nil {
@@ -29,12 +37,16 @@ func (h *Handler) CreateBot(c *gin.Context) {
 	}
 
 	bot := &models.Bot{
+		AppID:            appFromContext(c).ID,
 		Name:             req.Name,
 		Prompt:           req.Prompt,
 		ChatModel:        req.ChatModel,
 		BoundaryPrompt:   req.BoundaryPrompt,
 		ContextTurnCount: req.ContextTurnCount,
 		Temperature:      req.Temperature,
+		TimeoutSeconds:   req.TimeoutSeconds,
+		WebhookURL:       req.WebhookURL,
+		WebhookSecret:    req.WebhookSecret,
 	}
 	if req.Middlewares != nil {
 		v := models.MiddlewareConfig(*req.Middlewares)
@@ -62,16 +74,17 @@ func (h *Handler) GetBot(c *gin.Context) {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return
 	}
-	if bot == nil {
-		h.respErr(c, http.StatusNotFound, err)
+	if bot == nil || bot.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
 		return
 	}
 
+	c.Header("ETag", botETag(bot))
 	h.respData(c, api.GetBotResponse(bot.API()))
 }
 
 func (h *Handler) GetBots(c *gin.Context) {
-	bots, err := h.sh.GetBots(c)
+	bots, err := h.sh.GetBots(c, appFromContext(c).ID)
 	if err != nil {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return
@@ -85,11 +98,11 @@ func (h *Handler) GetBots(c *gin.Context) {
 	h.respData(c, data)
 }
 
+// UpdateBot replaces the fields of the bot, the middlewares are kept if not
+// set. The update is published unless draft is set.
 func (h *Handler) UpdateBot(c *gin.Context) {
-	botIDStr := c.Param("bot_id")
-	botId, err := strconv.ParseUint(botIDStr, 10, 64)
-	if err != nil {
-		h.respErr(c, http.StatusBadRequest, err)
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
 		return
 	}
 	var req api.UpdateBotRequest
@@ -97,57 +110,345 @@ func (h *Handler) UpdateBot(c *gin.Context) {
 		h.respErr(c, http.StatusBadRequest, err)
 		return
 	}
+	updatedAt, ok := h.checkBotIfMatch(c, bot)
+	if !ok {
+		return
+	}
 
-	if _, err := h.llms.GetChatModel(req.ChatModel); err != nil {
-		h.respErr(c, http.StatusBadRequest, errors.New("chat model does not exist"))
+	edited, ok := h.draftBot(c, bot)
+	if !ok {
+		return
+	}
+	if req.Middlewares == nil && edited.Middlewares != nil {
+		mc := api.MiddlewareConfig(*edited.Middlewares)
+		req.Middlewares = &mc
+	}
+	v, ok := h.updateBot(c, bot, req.CreateBotRequest, req.Draft, updatedAt)
+	if !ok {
+		return
+	}
+
+	publishedVersion := bot.PublishedVersion
+	if !req.Draft {
+		publishedVersion = v.Version
+	}
+	h.respData(c, api.UpdateBotResponse(v.API(publishedVersion)))
+}
+
+// PatchBot updates the bot with the JSON merge patch (RFC 7396) in the body,
+// see api.BotPatch. The update is conditional on the If-Match header or the
+// updated_at field of the patch if present. The patch applies to the latest
+// draft if there is one, so that drafts can be patched one after the other.
+func (h *Handler) PatchBot(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+	var req api.PatchBotRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+	var patch map[string]any
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+	updatedAt, ok := h.checkBotIfMatch(c, bot)
+	if !ok {
+		return
+	}
+
+	if v, ok := patch["updated_at"]; ok {
+		delete(patch, "updated_at")
+		s, _ := v.(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			h.respErr(c, http.StatusBadRequest, errors.New("updated_at must be an RFC 3339 time"))
+			return
+		}
+		if !t.Equal(bot.UpdatedAt) {
+			h.respErr(c, http.StatusPreconditionFailed, storage.ErrBotModified)
+			return
+		}
+		updatedAt = bot.UpdatedAt
+	}
+
+	edited, ok := h.draftBot(c, bot)
+	if !ok {
 		return
 	}
+	current := api.CreateBotRequest{
+		Name:             edited.Name,
+		ChatModel:        edited.ChatModel,
+		Prompt:           edited.Prompt,
+		BoundaryPrompt:   edited.BoundaryPrompt,
+		Temperature:      edited.Temperature,
+		ContextTurnCount: edited.ContextTurnCount,
+		TimeoutSeconds:   edited.TimeoutSeconds,
+		WebhookURL:       edited.WebhookURL,
+		WebhookSecret:    edited.WebhookSecret,
+	}
+	if edited.Middlewares != nil {
+		mc := api.MiddlewareConfig(*edited.Middlewares)
+		current.Middlewares = &mc
+	}
+	var patched patchedBot
+	if err := mergePatch(current, patch, &patched); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&patched); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	v, ok := h.updateBot(c, bot, api.CreateBotRequest(patched), req.Draft, updatedAt)
+	if !ok {
+		return
+	}
+
+	bot, err := h.sh.GetBot(c, bot.ID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if bot == nil {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
+		return
+	}
+	c.Header("ETag", botETag(bot))
+	// a draft responds its settings, which are not published
+	if req.Draft {
+		v.Apply(bot)
+	}
+	h.respData(c, api.PatchBotResponse(bot.API()))
+}
+
+// draftBot returns the bot with the chat settings of its latest version if it
+// is a draft which was never published, the bot itself otherwise.
+func (h *Handler) draftBot(c *gin.Context, bot *models.Bot) (*models.Bot, bool) {
+	v, err := h.sh.GetLatestBotVersion(c, bot.ID, 0)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if v == nil || v.Version <= bot.PublishedVersion || v.PublishedAt != nil {
+		return bot, true
+	}
+
+	edited := *bot
+	v.Apply(&edited)
+	return &edited, true
+}
+
+// updateBot stores the chat settings of req as a new version of the bot and
+// updates its other fields, which are not versioned.
+func (h *Handler) updateBot(c *gin.Context, bot *models.Bot, req api.CreateBotRequest, draft bool, updatedAt time.Time) (*models.BotVersion, bool) {
+	if _, err := h.llms.GetChatModel(req.ChatModel); err != nil {
+		h.respErr(c, http.StatusBadRequest, errors.New("chat model does not exist"), api.ErrorCodeModelNotFound)
+		return nil, false
+	}
 	if req.Middlewares != nil {
 		if err := h.middlewareHandler.ValidateConfig(req.Middlewares); err != nil {
 			h.respErr(c, http.StatusBadRequest, err)
-			return
+			return nil, false
 		}
 	}
 
 	m := map[string]any{
-		"name":               req.Name,
-		"chat_model":         req.ChatModel,
-		"prompt":             req.Prompt,
-		"boundary_prompt":    req.BoundaryPrompt,
-		"context_turn_count": req.ContextTurnCount,
-		"temperature":        req.Temperature,
+		"name":           req.Name,
+		"webhook_url":    req.WebhookURL,
+		"webhook_secret": req.WebhookSecret,
 	}
+	v := models.NewBotVersion(bot)
+	v.ChatModel = req.ChatModel
+	v.Prompt = req.Prompt
+	v.BoundaryPrompt = req.BoundaryPrompt
+	v.ContextTurnCount = req.ContextTurnCount
+	v.Temperature = req.Temperature
+	v.TimeoutSeconds = req.TimeoutSeconds
+	v.Middlewares = nil
 	if req.Middlewares != nil {
-		v := models.MiddlewareConfig(*req.Middlewares)
-		m["middlewares"] = &v
+		mc := models.MiddlewareConfig(*req.Middlewares)
+		v.Middlewares = &mc
 	}
 
-	rowsAffected, err := h.sh.UpdateBot(c, uint(botId), m)
+	rowsAffected, err := h.sh.UpdateBotVersion(c, bot.AppID, bot.ID, updatedAt, m, v, !draft)
 	if err != nil {
 		h.respErr(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if rowsAffected == 0 {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
+		return nil, false
+	}
+
+	return v, true
+}
+
+// botETag changes whenever the bot is updated.
+func botETag(bot *models.Bot) string {
+	return fmt.Sprintf(`"%d-%d"`, bot.ID, bot.UpdatedAt.UnixNano())
+}
+
+// checkBotIfMatch checks the If-Match header of the request against the ETag
+// of the bot, returning the update time the update must be conditional on,
+// zero if there is no header.
+func (h *Handler) checkBotIfMatch(c *gin.Context, bot *models.Bot) (time.Time, bool) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return time.Time{}, true
+	}
+
+	etag := botETag(bot)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return bot.UpdatedAt, true
+		}
+	}
+
+	h.respErr(c, http.StatusPreconditionFailed, storage.ErrBotModified)
+	return time.Time{}, false
+}
+
+// patchedBot is a bot with a merge patch applied. It is validated like
+// api.CreateBotRequest, except that a temperature or context turn count of 0
+// is valid, which the required rule rejects.
+type patchedBot struct {
+	Name             string                `json:"name" binding:"required"`
+	ChatModel        string                `json:"chat_model" binding:"required"`
+	Prompt           string                `json:"prompt"`
+	BoundaryPrompt   string                `json:"boundary_prompt"`
+	Temperature      float32               `json:"temperature" binding:"min=0"`
+	ContextTurnCount int                   `json:"context_turn_count" binding:"min=0"`
+	TimeoutSeconds   int                   `json:"timeout_seconds" binding:"min=0"`
+	Middlewares      *api.MiddlewareConfig `json:"middlewares"`
+	WebhookURL       string                `json:"webhook_url" binding:"omitempty,url"`
+	WebhookSecret    string                `json:"webhook_secret"`
+}
+
+// mergePatch applies the JSON merge patch to the JSON of target and decodes
+// the result into v, failing on fields unknown to v.
+func mergePatch(target any, patch map[string]any, v any) error {
+	data, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if data, err = json.Marshal(mergeObject(doc, patch)); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func mergeObject(doc, patch map[string]any) map[string]any {
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	for k, pv := range patch {
+		if pv == nil {
+			delete(doc, k)
+			continue
+		}
+		if po, ok := pv.(map[string]any); ok {
+			do, _ := doc[k].(map[string]any)
+			doc[k] = mergeObject(do, po)
+			continue
+		}
+		doc[k] = pv
+	}
+	return doc
+}
+
+func (h *Handler) DeleteBot(c *gin.Context) {
+	botIDStr := c.Param("bot_id")
+	botId, err := strconv.ParseUint(botIDStr, 10, 64)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
 		return
 	}
 
-	if rowsAffected == 0 {
-		h.respErr(c, http.StatusNotFound, errors.New("bot not found"))
+	if err := h.sh.DeleteBot(c, appFromContext(c).ID, uint(botId)); err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
-func (h *Handler) DeleteBot(c *gin.Context) {
+func (h *Handler) PreviewBot(c *gin.Context) {
 	botIDStr := c.Param("bot_id")
 	botId, err := strconv.ParseUint(botIDStr, 10, 64)
 	if err != nil {
 		h.respErr(c, http.StatusBadRequest, err)
 		return
 	}
+	var req api.PreviewBotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
 
-	if err := h.sh.DeleteBot(c, uint(botId)); err != nil {
+	bot, err := h.sh.GetBot(c, uint(botId))
+	if err != nil {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return
 	}
+	if bot == nil || bot.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
+		return
+	}
 
-	c.Status(http.StatusNoContent)
+	version := req.Version
+	if req.ConversationID != uuid.Nil {
+		conv, err := h.sh.GetConv(c, req.ConversationID)
+		if err != nil {
+			h.respErr(c, http.StatusInternalServerError, err)
+			return
+		}
+		if conv == nil || conv.AppID != bot.AppID {
+			h.respErr(c, http.StatusNotFound, errConvNotFound)
+			return
+		}
+		if conv.BotID != bot.ID {
+			h.respErr(c, http.StatusBadRequest, errors.New("conversation does not belong to the bot"))
+			return
+		}
+		if version == 0 {
+			version = conv.BotVersion
+		}
+	}
+
+	if version != 0 && version != bot.PublishedVersion {
+		v, err := h.sh.GetBotVersion(c, bot.ID, version)
+		if err != nil {
+			h.respErr(c, http.StatusInternalServerError, err)
+			return
+		}
+		if v == nil {
+			h.respErr(c, http.StatusNotFound, errBotVersionNotFound)
+			return
+		}
+		v.Apply(bot)
+	}
+
+	resp, err := h.turnPreviewer.PreviewTurn(c, bot, req.ConversationID, req.Content)
+	if err != nil {
+		var terr *models.TurnError
+		if errors.As(err, &terr) {
+			h.respErr(c, http.StatusBadRequest, terr)
+			return
+		}
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respData(c, resp)
 }
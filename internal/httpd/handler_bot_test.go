@@ -0,0 +1,258 @@
+package httpd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"gorm.io/gorm"
+)
+
+func TestMergePatch(t *testing.T) {
+	current := api.CreateBotRequest{
+		Name:             "bot",
+		ChatModel:        "openai:gpt-3.5-turbo",
+		Prompt:           "prompt",
+		Temperature:      1,
+		ContextTurnCount: 4,
+		WebhookURL:       "https://example.com/hook",
+		Middlewares: &api.MiddlewareConfig{
+			Items:  []*api.Middleware{{ID: "a", Name: "redact"}},
+			Router: &api.MiddlewareRouter{ChatModel: "openai:gpt-3.5-turbo", Prompt: "route"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		patch   map[string]any
+		want    patchedBot
+		wantErr bool
+	}{
+		{
+			name:  "fields not in the patch are kept",
+			patch: map[string]any{"prompt": "new", "temperature": float64(0)},
+			want: func() patchedBot {
+				b := patchedBot(current)
+				b.Prompt = "new"
+				b.Temperature = 0
+				return b
+			}(),
+		},
+		{
+			name:  "null removes the field",
+			patch: map[string]any{"webhook_url": nil, "middlewares": nil},
+			want: func() patchedBot {
+				b := patchedBot(current)
+				b.WebhookURL = ""
+				b.Middlewares = nil
+				return b
+			}(),
+		},
+		{
+			name: "objects are merged and arrays replaced",
+			patch: map[string]any{"middlewares": map[string]any{
+				"items":  []any{map[string]any{"id": "b", "name": "fetch"}},
+				"router": map[string]any{"prompt": nil},
+			}},
+			want: func() patchedBot {
+				b := patchedBot(current)
+				b.Middlewares = &api.MiddlewareConfig{
+					Items:  []*api.Middleware{{ID: "b", Name: "fetch"}},
+					Router: &api.MiddlewareRouter{ChatModel: "openai:gpt-3.5-turbo"},
+				}
+				return b
+			}(),
+		},
+		{
+			name:    "unknown fields",
+			patch:   map[string]any{"temprature": float64(1)},
+			wantErr: true,
+		},
+		{
+			name:    "wrong types",
+			patch:   map[string]any{"context_turn_count": "4"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got patchedBot
+			err := mergePatch(current, tt.patch, &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("mergePatch() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergePatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchedBotValidation(t *testing.T) {
+	valid := patchedBot{Name: "bot", ChatModel: "openai:gpt-3.5-turbo"}
+	if err := binding.Validator.ValidateStruct(&valid); err != nil {
+		t.Errorf("zero temperature and context turn count are invalid: %v", err)
+	}
+
+	for _, b := range []patchedBot{
+		{ChatModel: "openai:gpt-3.5-turbo"},
+		{Name: "bot", ChatModel: "openai:gpt-3.5-turbo", Temperature: -1},
+		{Name: "bot", ChatModel: "openai:gpt-3.5-turbo", ContextTurnCount: -1},
+		{Name: "bot", ChatModel: "openai:gpt-3.5-turbo", WebhookURL: "not a url"},
+	} {
+		b := b
+		if err := binding.Validator.ValidateStruct(&b); err == nil {
+			t.Errorf("%+v is valid, want error", b)
+		}
+	}
+}
+
+func TestCheckBotIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	updatedAt := time.Date(2023, 5, 1, 0, 0, 0, 123, time.UTC)
+	bot := &models.Bot{Model: gorm.Model{ID: 7, UpdatedAt: updatedAt}}
+	etag := botETag(bot)
+
+	updated := *bot
+	updated.UpdatedAt = updatedAt.Add(time.Nanosecond)
+	if botETag(&updated) == etag {
+		t.Fatal("the ETag does not change with the update time")
+	}
+
+	tests := []struct {
+		ifMatch string
+		want    time.Time
+		ok      bool
+	}{
+		{"", time.Time{}, true},
+		{"*", time.Time{}, true},
+		{etag, updatedAt, true},
+		{"W/" + etag, updatedAt, true},
+		{`"1-1", ` + etag, updatedAt, true},
+		{botETag(&updated), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/", nil)
+		if tt.ifMatch != "" {
+			c.Request.Header.Set("If-Match", tt.ifMatch)
+		}
+
+		got, ok := (&Handler{}).checkBotIfMatch(c, bot)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("If-Match %q: got %v, %v, want %v, %v", tt.ifMatch, got, ok, tt.want, tt.ok)
+		}
+		if !ok && w.Code != http.StatusPreconditionFailed {
+			t.Errorf("If-Match %q: status = %d", tt.ifMatch, w.Code)
+		}
+	}
+}
+
+func TestBotVersions(t *testing.T) {
+	s := newTestServer(t, config.QuotaConfig{})
+	ctx := context.Background()
+	bot, err := s.client.CreateBot(ctx, api.CreateBotRequest{Name: "bot", ChatModel: testChatModel, Prompt: "v1", Temperature: 1, ContextTurnCount: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// updates are published unless draft is set
+	v, err := s.client.UpdateBot(ctx, bot.ID, api.UpdateBotRequest{
+		CreateBotRequest: api.CreateBotRequest{Name: "bot", ChatModel: testChatModel, Prompt: "v2", Temperature: 1, ContextTurnCount: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 2 || !v.Published {
+		t.Fatalf("update = %+v, want version 2 published", v)
+	}
+	v, err = s.client.UpdateBot(ctx, bot.ID, api.UpdateBotRequest{
+		CreateBotRequest: api.CreateBotRequest{Name: "bot", ChatModel: testChatModel, Prompt: "v3", Temperature: 1, ContextTurnCount: 4},
+		Draft:            true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 3 || v.Published {
+		t.Fatalf("draft update = %+v, want version 3 not published", v)
+	}
+	checkPublished(t, s, bot.ID, 2, "v2", 1)
+
+	// draft patches build on the latest draft
+	patched, err := s.client.PatchBot(ctx, bot.ID, map[string]any{"temperature": 0.5}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Prompt != "v3" || patched.Temperature != 0.5 || patched.PublishedVersion != 2 {
+		t.Errorf("draft patch = %+v, want the draft settings", patched)
+	}
+	patched, err = s.client.PatchBot(ctx, bot.ID, map[string]any{"context_turn_count": 2}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Prompt != "v3" || patched.Temperature != 0.5 || patched.ContextTurnCount != 2 {
+		t.Errorf("second draft patch = %+v, want both patches", patched)
+	}
+	checkPublished(t, s, bot.ID, 2, "v2", 1)
+
+	// a patch without draft publishes the draft with the patch
+	patched, err = s.client.PatchBot(ctx, bot.ID, map[string]any{"prompt": "v6"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.PublishedVersion != 6 || patched.Prompt != "v6" || patched.Temperature != 0.5 || patched.ContextTurnCount != 2 {
+		t.Errorf("patch = %+v, want the draft published as version 6", patched)
+	}
+	checkPublished(t, s, bot.ID, 6, "v6", 0.5)
+
+	// once published, patches build on the published version again
+	if _, err := s.client.PatchBot(ctx, bot.ID, map[string]any{"temperature": 0.8}, false); err != nil {
+		t.Fatal(err)
+	}
+	checkPublished(t, s, bot.ID, 7, "v6", 0.8)
+
+	// rollback publishes the version published before the current one
+	rolledBack, err := s.client.RollbackBot(ctx, bot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.PublishedVersion != 6 || rolledBack.Temperature != 0.5 {
+		t.Errorf("rollback = %+v, want version 6", rolledBack)
+	}
+	checkPublished(t, s, bot.ID, 6, "v6", 0.5)
+
+	// publishing a version
+	if _, err := s.client.PublishBotVersion(ctx, bot.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	checkPublished(t, s, bot.ID, 1, "v1", 1)
+}
+
+// checkPublished checks the published version and settings of the bot.
+func checkPublished(t *testing.T, s *testServer, botID uint, version int, prompt string, temperature float32) {
+	t.Helper()
+	bot, err := s.client.GetBot(context.Background(), botID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.PublishedVersion != version || bot.Prompt != prompt || bot.Temperature != temperature {
+		t.Errorf("bot = version %d, prompt %q, temperature %v, want version %d, prompt %q, temperature %v",
+			bot.PublishedVersion, bot.Prompt, bot.Temperature, version, prompt, temperature)
+	}
+}
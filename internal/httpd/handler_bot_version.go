@@ -0,0 +1,172 @@
+package httpd
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+func (h *Handler) ListBotVersions(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.sh.GetBotVersions(c, bot.ID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := make(api.GetBotVersionsResponse, 0, len(versions))
+	for _, v := range versions {
+		data = append(data, v.API(bot.PublishedVersion))
+	}
+	h.respData(c, data)
+}
+
+func (h *Handler) GetBotVersion(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+	v, ok := h.getBotVersionFromParam(c, bot)
+	if !ok {
+		return
+	}
+
+	h.respData(c, api.GetBotVersionResponse(v.API(bot.PublishedVersion)))
+}
+
+// DiffBotVersions lists the chat settings changed between two versions, by
+// default from the published version to the latest one.
+func (h *Handler) DiffBotVersions(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+	var req api.DiffBotVersionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.From == 0 {
+		req.From = bot.PublishedVersion
+	}
+	from, err := h.sh.GetBotVersion(c, bot.ID, req.From)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	var to *models.BotVersion
+	if req.To == 0 {
+		to, err = h.sh.GetLatestBotVersion(c, bot.ID, 0)
+	} else {
+		to, err = h.sh.GetBotVersion(c, bot.ID, req.To)
+	}
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if from == nil || to == nil {
+		h.respErr(c, http.StatusNotFound, errBotVersionNotFound)
+		return
+	}
+
+	h.respData(c, api.DiffBotVersionsResponse{
+		From:    from.Version,
+		To:      to.Version,
+		Changes: from.Diff(*to),
+	})
+}
+
+func (h *Handler) PublishBotVersion(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+	v, ok := h.getBotVersionFromParam(c, bot)
+	if !ok {
+		return
+	}
+
+	h.publishBotVersion(c, bot, v)
+}
+
+// RollbackBot publishes the latest version published before the current one.
+func (h *Handler) RollbackBot(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+
+	v, err := h.sh.GetLatestBotVersion(c, bot.ID, bot.PublishedVersion)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if v == nil {
+		h.respErr(c, http.StatusConflict, errors.New("no version was published before the current one"))
+		return
+	}
+
+	h.publishBotVersion(c, bot, v)
+}
+
+func (h *Handler) publishBotVersion(c *gin.Context, bot *models.Bot, v *models.BotVersion) {
+	if err := h.sh.PublishBotVersion(c, v); err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	v.Apply(bot)
+	bot.PublishedVersion = v.Version
+	h.respData(c, api.GetBotResponse(bot.API()))
+}
+
+func (h *Handler) getBotFromParam(c *gin.Context) (*models.Bot, bool) {
+	botID, err := strconv.ParseUint(c.Param("bot_id"), 10, 64)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	bot, err := h.sh.GetBot(c, uint(botID))
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if bot == nil || bot.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
+		return nil, false
+	}
+
+	return bot, true
+}
+
+func (h *Handler) getBotVersionFromParam(c *gin.Context, bot *models.Bot) (*models.BotVersion, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	v, err := h.sh.GetBotVersion(c, bot.ID, version)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if v == nil {
+		h.respErr(c, http.StatusNotFound, errBotVersionNotFound)
+		return nil, false
+	}
+
+	return v, true
+}
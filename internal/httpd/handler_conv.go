@@ -3,11 +3,13 @@ package httpd
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/pandodao/botastic/api"
 	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
 )
 
 func (h *Handler) CreateConv(c *gin.Context) {
@@ -18,8 +20,12 @@ func (h *Handler) CreateConv(c *gin.Context) {
 	}
 
 	conv := &models.Conv{
-		BotID:        req.BotID,
-		UserIdentity: req.UserIdentity,
+		AppID:         appFromContext(c).ID,
+		BotID:         req.BotID,
+		UserIdentity:  req.UserIdentity,
+		BotVersion:    req.BotVersion,
+		WebhookURL:    req.WebhookURL,
+		WebhookSecret: req.WebhookSecret,
 	}
 	if !h.createConv(c, conv) {
 		return
@@ -39,8 +45,15 @@ func (h *Handler) createConv(c *gin.Context, conv *models.Conv) bool {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return false
 	}
-	if bot == nil {
-		h.respErr(c, http.StatusNotFound, errors.New("bot not found"))
+	if bot == nil || bot.AppID != conv.AppID {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
+		return false
+	}
+	if !h.checkBotVersion(c, bot.ID, conv.BotVersion) {
+		return false
+	}
+	if err := h.eh.Assign(c, conv); err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
 		return false
 	}
 
@@ -52,6 +65,26 @@ func (h *Handler) createConv(c *gin.Context, conv *models.Conv) bool {
 	return true
 }
 
+// checkBotVersion checks that the version pinned by a conversation exists, 0
+// follows the published version.
+func (h *Handler) checkBotVersion(c *gin.Context, botID uint, version int) bool {
+	if version == 0 {
+		return true
+	}
+
+	v, err := h.sh.GetBotVersion(c, botID, version)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return false
+	}
+	if v == nil {
+		h.respErr(c, http.StatusNotFound, errBotVersionNotFound)
+		return false
+	}
+	return true
+}
+
+// UpdateConv updates the fields of the conversation set in the request.
 func (h *Handler) UpdateConv(c *gin.Context) {
 	convIDStr := c.Param("conv_id")
 	convID, err := uuid.Parse(convIDStr)
@@ -65,15 +98,57 @@ func (h *Handler) UpdateConv(c *gin.Context) {
 		return
 	}
 
-	rowsAffected, err := h.sh.UpdateConv(c, convID, map[string]any{
-		"bot_id": req.BotID,
-	})
+	app := appFromContext(c)
+	conv, err := h.sh.GetConv(c, convID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if conv == nil || conv.AppID != app.ID {
+		h.respErr(c, http.StatusNotFound, errConvNotFound)
+		return
+	}
+
+	m := map[string]any{}
+	if req.BotID != nil && *req.BotID != conv.BotID {
+		bot, err := h.sh.GetBot(c, *req.BotID)
+		if err != nil {
+			h.respErr(c, http.StatusInternalServerError, err)
+			return
+		}
+		if bot == nil || bot.AppID != app.ID {
+			h.respErr(c, http.StatusNotFound, errBotNotFound)
+			return
+		}
+		m["bot_id"] = bot.ID
+		m["bot_version"] = 0
+		conv.BotID = bot.ID
+	}
+	if req.BotVersion != nil {
+		if !h.checkBotVersion(c, conv.BotID, *req.BotVersion) {
+			return
+		}
+		m["bot_version"] = *req.BotVersion
+	}
+	if req.WebhookURL != nil {
+		m["webhook_url"] = *req.WebhookURL
+	}
+	if req.WebhookSecret != nil {
+		m["webhook_secret"] = *req.WebhookSecret
+	}
+	if len(m) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	rowsAffected, err := h.sh.UpdateConv(c, app.ID, convID, m)
 	if err != nil {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return
 	}
 	if rowsAffected == 0 {
-		h.respErr(c, http.StatusNotFound, errors.New("conversation not found"))
+		h.respErr(c, http.StatusNotFound, errConvNotFound)
+		return
 	}
 
 	c.Status(http.StatusNoContent)
@@ -91,8 +166,8 @@ func (h *Handler) GetConv(c *gin.Context) {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return
 	}
-	if conv == nil {
-		h.respErr(c, http.StatusNotFound, errors.New("conversation not found"))
+	if conv == nil || conv.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errConvNotFound)
 		return
 	}
 
@@ -107,10 +182,123 @@ func (h *Handler) DeleteConv(c *gin.Context) {
 		return
 	}
 
-	if err := h.sh.DeleteConv(c, convID); err != nil {
+	if err := h.sh.DeleteConv(c, appFromContext(c).ID, convID); err != nil {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+func (h *Handler) ListConvs(c *gin.Context) {
+	var req api.ListConvsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	params := storage.ListConvsParams{
+		AppID:        appFromContext(c).ID,
+		BotID:        req.BotID,
+		UserIdentity: req.UserIdentity,
+		Limit:        pageLimit(req.PaginationRequest),
+		Desc:         req.Order != "asc",
+	}
+	if req.Cursor != "" {
+		t, id, err := decodeCursor(req.Cursor)
+		if err != nil {
+			h.respErr(c, http.StatusBadRequest, err)
+			return
+		}
+		params.AfterCreatedAt = t
+		params.AfterID, err = uuid.Parse(id)
+		if err != nil {
+			h.respErr(c, http.StatusBadRequest, errInvalidCursor)
+			return
+		}
+	}
+
+	convs, err := h.sh.ListConvs(c, params)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := api.ListConvsResponse{
+		Items: make([]*api.Conv, 0, len(convs)),
+	}
+	for _, conv := range convs {
+		v := conv.API()
+		resp.Items = append(resp.Items, &v)
+	}
+	if len(convs) == params.Limit {
+		last := convs[len(convs)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID.String())
+	}
+
+	h.respData(c, resp)
+}
+
+func (h *Handler) ListTurns(c *gin.Context) {
+	convIDStr := c.Param("conv_id")
+	convID, err := uuid.Parse(convIDStr)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+	var req api.ListTurnsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	conv, err := h.sh.GetConv(c, convID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if conv == nil || conv.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errConvNotFound)
+		return
+	}
+
+	params := storage.ListTurnsParams{
+		ConvID: convID,
+		Status: req.Status,
+		Limit:  pageLimit(req.PaginationRequest),
+		Desc:   req.Order == "desc",
+	}
+	if req.Cursor != "" {
+		_, id, err := decodeCursor(req.Cursor)
+		if err != nil {
+			h.respErr(c, http.StatusBadRequest, err)
+			return
+		}
+		afterID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			h.respErr(c, http.StatusBadRequest, errInvalidCursor)
+			return
+		}
+		params.AfterID = uint(afterID)
+	}
+
+	turns, err := h.sh.ListTurns(c, params)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := api.ListTurnsResponse{
+		Items: make([]*api.Turn, 0, len(turns)),
+	}
+	for _, turn := range turns {
+		v := turn.API()
+		resp.Items = append(resp.Items, &v)
+	}
+	if len(turns) == params.Limit {
+		last := turns[len(turns)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, strconv.FormatUint(uint64(last.ID), 10))
+	}
+
+	h.respData(c, resp)
+}
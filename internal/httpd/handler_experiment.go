@@ -0,0 +1,146 @@
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+)
+
+// CreateExperiment starts an experiment splitting the new conversations of a
+// bot across the variants, a bot runs one experiment at a time.
+func (h *Handler) CreateExperiment(c *gin.Context) {
+	var req api.CreateExperimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	app := appFromContext(c)
+	bot, err := h.sh.GetBot(c, req.BotID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if bot == nil || bot.AppID != app.ID {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
+		return
+	}
+
+	names := make(map[string]bool, len(req.Variants))
+	for _, v := range req.Variants {
+		if names[v.Name] {
+			h.respErr(c, http.StatusBadRequest, fmt.Errorf("duplicate variant name: %s", v.Name))
+			return
+		}
+		names[v.Name] = true
+
+		if !h.checkBotVersion(c, bot.ID, v.BotVersion) {
+			return
+		}
+	}
+
+	e := &models.Experiment{
+		AppID:    app.ID,
+		BotID:    bot.ID,
+		Name:     req.Name,
+		Variants: req.Variants,
+	}
+	if err := h.sh.CreateExperiment(c, e); err != nil {
+		if errors.Is(err, storage.ErrExperimentRunning) {
+			h.respErr(c, http.StatusConflict, err)
+			return
+		}
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respData(c, api.CreateExperimentResponse(e.API()))
+}
+
+func (h *Handler) ListExperiments(c *gin.Context) {
+	var req api.ListExperimentsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	experiments, err := h.sh.GetExperiments(c, appFromContext(c).ID, req.BotID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := make(api.ListExperimentsResponse, 0, len(experiments))
+	for _, e := range experiments {
+		data = append(data, e.API())
+	}
+	h.respData(c, data)
+}
+
+func (h *Handler) GetExperiment(c *gin.Context) {
+	e, ok := h.getExperimentFromParam(c)
+	if !ok {
+		return
+	}
+
+	h.respData(c, api.GetExperimentResponse(e.API()))
+}
+
+// StopExperiment stops assigning new conversations to the variants, the
+// assigned conversations keep their bot version.
+func (h *Handler) StopExperiment(c *gin.Context) {
+	e, ok := h.getExperimentFromParam(c)
+	if !ok {
+		return
+	}
+
+	if e.Running() {
+		if err := h.sh.StopExperiment(c, e); err != nil {
+			h.respErr(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	h.respData(c, api.GetExperimentResponse(e.API()))
+}
+
+func (h *Handler) GetExperimentMetrics(c *gin.Context) {
+	e, ok := h.getExperimentFromParam(c)
+	if !ok {
+		return
+	}
+
+	metrics, err := h.eh.Metrics(c, e)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respData(c, metrics)
+}
+
+func (h *Handler) getExperimentFromParam(c *gin.Context) (*models.Experiment, bool) {
+	id, err := strconv.ParseUint(c.Param("experiment_id"), 10, 64)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	e, err := h.sh.GetExperiment(c, uint(id))
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if e == nil || e.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errExperimentNotFound)
+		return nil, false
+	}
+
+	return e, true
+}
@@ -0,0 +1,87 @@
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/internal/export"
+	"go.uber.org/zap"
+)
+
+func (h *Handler) ExportConv(c *gin.Context) {
+	convIDStr := c.Param("conv_id")
+	convID, err := uuid.Parse(convIDStr)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+	var req api.ExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	conv, err := h.sh.GetConv(c, convID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if conv == nil || conv.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errConvNotFound)
+		return
+	}
+
+	setExportHeaders(c, req.Format, "conversation-"+conv.ID.String())
+	if err := h.exporter.ExportConv(c, c.Writer, req.Format, conv, exportFilter(req)); err != nil {
+		h.logger.Error("failed to export conversation", zap.Error(err), zap.String("conv_id", conv.ID.String()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) ExportBot(c *gin.Context) {
+	botIDStr := c.Param("bot_id")
+	botId, err := strconv.ParseUint(botIDStr, 10, 64)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+	var req api.ExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	bot, err := h.sh.GetBot(c, uint(botId))
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if bot == nil || bot.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errBotNotFound)
+		return
+	}
+
+	setExportHeaders(c, req.Format, fmt.Sprintf("bot-%d", bot.ID))
+	if err := h.exporter.ExportBot(c, c.Writer, req.Format, bot, exportFilter(req)); err != nil {
+		h.logger.Error("failed to export bot conversations", zap.Error(err), zap.Uint("bot_id", bot.ID))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+func exportFilter(req api.ExportRequest) export.Filter {
+	return export.Filter{
+		Since:  req.Since,
+		Until:  req.Until,
+		Status: req.Status,
+	}
+}
+
+func setExportHeaders(c *gin.Context, format api.ExportFormat, name string) {
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, export.FileExt(format)))
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,177 @@
+package httpd
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+)
+
+// CreateFeedback rates a processed turn, rating it again replaces the
+// previous feedback.
+func (h *Handler) CreateFeedback(c *gin.Context) {
+	turn, ok := h.getTurnFromParam(c)
+	if !ok {
+		return
+	}
+	var req api.CreateFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+	if !turn.IsProcessed() {
+		h.respErr(c, http.StatusConflict, errors.New("turn is not processed yet"))
+		return
+	}
+
+	f := &models.Feedback{
+		AppID:      turn.AppID,
+		BotID:      turn.BotID,
+		ConvID:     turn.ConvID,
+		TurnID:     turn.ID,
+		Rating:     req.Rating,
+		Tags:       req.Tags,
+		Correction: req.Correction,
+	}
+	if err := h.sh.SaveFeedback(c, f); err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respData(c, api.CreateFeedbackResponse(f.API()))
+}
+
+func (h *Handler) GetFeedback(c *gin.Context) {
+	turn, ok := h.getTurnFromParam(c)
+	if !ok {
+		return
+	}
+
+	f, err := h.sh.GetTurnFeedback(c, turn.ID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if f == nil {
+		h.respErr(c, http.StatusNotFound, errFeedbackNotFound)
+		return
+	}
+
+	h.respData(c, api.GetFeedbackResponse(f.API()))
+}
+
+func (h *Handler) ListBotFeedback(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+	var req api.ListFeedbackRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	params := storage.ListFeedbackParams{
+		BotID:  bot.ID,
+		Rating: req.Rating,
+		Limit:  pageLimit(req.PaginationRequest),
+		Desc:   req.Order != "asc",
+	}
+	if req.Cursor != "" {
+		_, id, err := decodeCursor(req.Cursor)
+		if err != nil {
+			h.respErr(c, http.StatusBadRequest, err)
+			return
+		}
+		afterID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			h.respErr(c, http.StatusBadRequest, errInvalidCursor)
+			return
+		}
+		params.AfterID = uint(afterID)
+	}
+
+	feedback, err := h.sh.ListFeedback(c, params)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := api.ListFeedbackResponse{
+		Items: make([]*api.Feedback, 0, len(feedback)),
+	}
+	for _, f := range feedback {
+		v := f.API()
+		resp.Items = append(resp.Items, &v)
+	}
+	if len(feedback) == params.Limit {
+		last := feedback[len(feedback)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, strconv.FormatUint(uint64(last.ID), 10))
+	}
+
+	h.respData(c, resp)
+}
+
+// GetBotFeedbackSummary aggregates the ratings and tags of the feedback of
+// the bot.
+func (h *Handler) GetBotFeedbackSummary(c *gin.Context) {
+	bot, ok := h.getBotFromParam(c)
+	if !ok {
+		return
+	}
+
+	summary := &api.FeedbackSummary{
+		BotID: bot.ID,
+		Tags:  map[string]int64{},
+	}
+	var ratings int64
+	if err := h.sh.EachBotFeedback(c, bot.ID, func(f *models.Feedback) error {
+		summary.Total++
+		ratings += int64(f.Rating)
+		switch f.Rating {
+		case api.FeedbackRatingUp:
+			summary.ThumbsUp++
+		case api.FeedbackRatingDown:
+			summary.ThumbsDown++
+		}
+		if f.Correction != "" {
+			summary.Corrections++
+		}
+		for _, tag := range f.Tags {
+			summary.Tags[tag]++
+		}
+		return nil
+	}); err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if summary.Total > 0 {
+		summary.Score = float64(ratings) / float64(summary.Total)
+	}
+
+	h.respData(c, summary)
+}
+
+func (h *Handler) getTurnFromParam(c *gin.Context) (*models.Turn, bool) {
+	turnID, err := strconv.ParseUint(c.Param("turn_id"), 10, 64)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	turn, err := h.sh.GetTurn(c, uint(turnID))
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if turn == nil || turn.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errTurnNotFound)
+		return nil, false
+	}
+
+	return turn, true
+}
@@ -0,0 +1,64 @@
+package httpd
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pandodao/botastic/api"
+)
+
+// ExportManifest responds the manifest of the bots of the app, as a YAML file
+// if asked, which can be applied as is.
+func (h *Handler) ExportManifest(c *gin.Context) {
+	var req api.ExportManifestRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	m, err := h.manifests.Export(c, appFromContext(c).ID, req.Names)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if req.Format == api.ManifestFormatYAML {
+		c.YAML(http.StatusOK, m)
+		return
+	}
+	h.respData(c, m)
+}
+
+// ApplyManifest upserts the bots of the manifest in the body, in YAML if the
+// content type says so and in JSON otherwise.
+func (h *Handler) ApplyManifest(c *gin.Context) {
+	var req api.ApplyManifestRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var (
+		m   api.Manifest
+		err error
+	)
+	if strings.Contains(c.ContentType(), "yaml") {
+		err = c.ShouldBindWith(&m, binding.YAML)
+	} else {
+		err = c.ShouldBindJSON(&m)
+	}
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := h.manifests.Apply(c, appFromContext(c).ID, &m, req.DryRun)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respData(c, resp)
+}
@@ -0,0 +1,371 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"go.uber.org/zap"
+)
+
+const (
+	headerConvID = "X-BOTASTIC-CONVERSATION-ID"
+
+	finishReasonStop = "stop"
+
+	// openAIWaitTimeout bounds the wait for the response of a completion
+	// which is not streamed, the turn still goes on in its conversation.
+	openAIWaitTimeout = 5 * time.Minute
+)
+
+// OpenAIChatCompletions serves the OpenAI chat completions API. The model is
+// the name of a bot of the app, and the last message is sent as a new turn of
+// a conversation. The conversation given in the X-BOTASTIC-CONVERSATION-ID
+// header is used if present, with its own history instead of the earlier
+// messages. Otherwise a new one is created and returned in that header, whose
+// history is the earlier messages, which must be pairs of user and assistant
+// messages.
+func (h *Handler) OpenAIChatCompletions(c *gin.Context) {
+	var req api.OpenAIChatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respOpenAIErr(c, http.StatusBadRequest, err)
+		return
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "user" || last.Content == "" {
+		h.respOpenAIErr(c, http.StatusBadRequest, errors.New("the last message must be a non-empty user message"))
+		return
+	}
+	convIDHeader := c.GetHeader(headerConvID)
+	var history []*api.OpenAIChatMessage
+	if convIDHeader == "" {
+		history = req.Messages[:len(req.Messages)-1]
+		if err := checkOpenAIHistory(history); err != nil {
+			h.respOpenAIErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	app := appFromContext(c)
+	bot, err := h.sh.GetBotByName(c, app.ID, req.Model)
+	if err != nil {
+		h.respOpenAIErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if bot == nil {
+		h.respOpenAIErr(c, http.StatusNotFound, fmt.Errorf("model %s does not exist", req.Model), api.ErrorCodeBotNotFound)
+		return
+	}
+
+	var (
+		conv  *models.Conv
+		turns []*models.Turn
+	)
+	if convIDHeader != "" {
+		convID, err := uuid.Parse(convIDHeader)
+		if err != nil {
+			h.respOpenAIErr(c, http.StatusBadRequest, err)
+			return
+		}
+		conv, err = h.sh.GetConv(c, convID)
+		if err != nil {
+			h.respOpenAIErr(c, http.StatusInternalServerError, err)
+			return
+		}
+		if conv == nil || conv.AppID != app.ID || conv.BotID != bot.ID {
+			h.respOpenAIErr(c, http.StatusNotFound, errConvNotFound)
+			return
+		}
+	} else {
+		// the conversation is stored with the turn once it is accepted
+		conv = &models.Conv{
+			ID:           uuid.New(),
+			AppID:        app.ID,
+			BotID:        bot.ID,
+			UserIdentity: req.User,
+		}
+		if err := h.eh.Assign(c, conv); err != nil {
+			h.respOpenAIErr(c, http.StatusInternalServerError, err)
+			return
+		}
+		turns = openAIHistoryTurns(bot, conv, history)
+	}
+	c.Header(headerConvID, conv.ID.String())
+
+	// subscribe before the turn is created to not miss any of its events
+	events, unsubscribe := h.hub.Subscribe(conv.ID, 1024)
+	defer unsubscribe()
+
+	turn := &models.Turn{
+		AppID:   app.ID,
+		ConvID:  conv.ID,
+		BotID:   bot.ID,
+		Request: last.Content,
+		Status:  api.TurnStatusInit,
+	}
+	result, err := h.enqueueTurn(c, app, conv, turn, turns)
+	if result != nil {
+		setQuotaHeaders(c, result)
+	}
+	if err != nil {
+		var rerr *turnRejectedError
+		if errors.As(err, &rerr) {
+			h.respOpenAIErr(c, rerr.statusCode, rerr.err, rerr.code)
+			return
+		}
+		h.respOpenAIErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := &api.OpenAIChatCompletionResponse{
+		ID:      fmt.Sprintf("chatcmpl-%d", turn.ID),
+		Object:  "chat.completion",
+		Created: turn.CreatedAt.Unix(),
+		Model:   bot.Name,
+	}
+	if req.Stream {
+		h.streamOpenAIChatCompletion(c, resp, turn.ID, events)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), openAIWaitTimeout)
+	defer cancel()
+	processed, err := waitTurnProcessed(ctx, turn.ID, events, nil)
+	switch {
+	case errors.Is(err, errEventsClosed):
+		h.respOpenAIErr(c, http.StatusInternalServerError, err)
+		return
+	case err != nil:
+		h.respOpenAIErr(c, http.StatusRequestTimeout, fmt.Errorf("turn %d is not processed yet: %w", turn.ID, err))
+		return
+	}
+	if processed.Status != api.TurnStatusSuccess {
+		h.respOpenAIErr(c, http.StatusInternalServerError, turnErr(processed))
+		return
+	}
+
+	finishReason := finishReasonStop
+	resp.Choices = []*api.OpenAIChatCompletionChoice{
+		{
+			Message:      &api.OpenAIChatMessage{Role: "assistant", Content: processed.Response},
+			FinishReason: &finishReason,
+		},
+	}
+	resp.Usage = &api.OpenAIUsage{
+		PromptTokens:     processed.PromptTokens,
+		CompletionTokens: processed.CompletionTokens,
+		TotalTokens:      processed.TotalTokens,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkOpenAIHistory checks that the messages before the last one can be the
+// history of a conversation, which has pairs of requests and responses. The
+// system messages are rejected rather than ignored, the prompt of the bot is
+// the system message.
+func checkOpenAIHistory(messages []*api.OpenAIChatMessage) error {
+	for i, m := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		switch {
+		case m.Role == "system":
+			return errors.New("system messages are not supported, the prompt of the bot is used instead")
+		case m.Role != role:
+			return fmt.Errorf("message %d must be a %s message, the messages before the last one must be pairs of user and assistant messages", i, role)
+		}
+	}
+	if len(messages)%2 == 1 {
+		return errors.New("the last user message before the last message has no assistant response")
+	}
+	return nil
+}
+
+// openAIHistoryTurns returns the pairs of user and assistant messages as the
+// successful turns of the new conversation, its history.
+func openAIHistoryTurns(bot *models.Bot, conv *models.Conv, messages []*api.OpenAIChatMessage) []*models.Turn {
+	version := conv.BotVersion
+	if version == 0 {
+		version = bot.PublishedVersion
+	}
+	turns := make([]*models.Turn, 0, len(messages)/2)
+	for i := 0; i+1 < len(messages); i += 2 {
+		turns = append(turns, &models.Turn{
+			AppID:      conv.AppID,
+			ConvID:     conv.ID,
+			BotID:      conv.BotID,
+			BotVersion: version,
+			Request:    messages[i].Content,
+			Response:   messages[i+1].Content,
+			Status:     api.TurnStatusSuccess,
+		})
+	}
+	return turns
+}
+
+func (h *Handler) streamOpenAIChatCompletion(c *gin.Context, resp *api.OpenAIChatCompletionResponse, turnID uint, events <-chan any) {
+	resp.Object = "chat.completion.chunk"
+	chunk := func(delta *api.OpenAIChatMessage, finishReason *string) *api.OpenAIChatCompletionResponse {
+		r := *resp
+		r.Choices = []*api.OpenAIChatCompletionChoice{
+			{
+				Delta:        delta,
+				FinishReason: finishReason,
+			},
+		}
+		return &r
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Render(-1, sseEvent{chunk(&api.OpenAIChatMessage{Role: "assistant"}, nil)})
+	c.Writer.Flush()
+
+	streamed := false
+	processed, err := waitTurnProcessed(c.Request.Context(), turnID, events, func(delta string) {
+		streamed = true
+		c.Render(-1, sseEvent{chunk(&api.OpenAIChatMessage{Content: delta}, nil)})
+		c.Writer.Flush()
+	})
+	switch {
+	case errors.Is(err, errEventsClosed):
+		_, e := openAIError(http.StatusInternalServerError, err)
+		c.Render(-1, sseEvent{&api.OpenAIErrorResponse{Error: e}})
+	case err != nil:
+		return
+	case processed.Status != api.TurnStatusSuccess:
+		_, e := openAIError(http.StatusInternalServerError, turnErr(processed))
+		c.Render(-1, sseEvent{&api.OpenAIErrorResponse{Error: e}})
+	default:
+		if !streamed {
+			c.Render(-1, sseEvent{chunk(&api.OpenAIChatMessage{Content: processed.Response}, nil)})
+		}
+		finishReason := finishReasonStop
+		c.Render(-1, sseEvent{chunk(&api.OpenAIChatMessage{}, &finishReason)})
+	}
+	c.Render(-1, sseEvent{"[DONE]"})
+	c.Writer.Flush()
+}
+
+// errEventsClosed is returned by waitTurnProcessed when the hub closed the
+// events of a subscriber too slow to keep up with them.
+var errEventsClosed = errors.New("too slow to receive the conversation events")
+
+// waitTurnProcessed waits on the conversation events for the turn to be
+// processed, passing the streamed pieces of its response to onDelta.
+func waitTurnProcessed(ctx context.Context, turnID uint, events <-chan any, onDelta func(string)) (*api.Turn, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case v, ok := <-events:
+			if !ok {
+				return nil, errEventsClosed
+			}
+			e := v.(*api.ConvEvent)
+			switch {
+			case e.Type == api.ConvEventTypeDelta && e.TurnID == turnID:
+				if onDelta != nil {
+					onDelta(e.Delta)
+				}
+			case e.Type == api.ConvEventTypeTurn && e.Turn.ID == turnID:
+				if e.Turn.Status == api.TurnStatusSuccess || e.Turn.Status == api.TurnStatusFailed {
+					return e.Turn, nil
+				}
+			}
+		}
+	}
+}
+
+func turnErr(t *api.Turn) error {
+	if t.Error != nil {
+		return errors.New(t.Error.Msg)
+	}
+	return errors.New("turn failed")
+}
+
+// OpenAIListModels lists the bots of the app as OpenAI models.
+func (h *Handler) OpenAIListModels(c *gin.Context) {
+	bots, err := h.sh.GetBots(c, appFromContext(c).ID)
+	if err != nil {
+		h.respOpenAIErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := api.OpenAIListModelsResponse{
+		Object: "list",
+		Data:   make([]*api.OpenAIModel, 0, len(bots)),
+	}
+	for _, b := range bots {
+		resp.Data = append(resp.Data, &api.OpenAIModel{
+			ID:      b.Name,
+			Object:  "model",
+			Created: b.CreatedAt.Unix(),
+			OwnedBy: "botastic",
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// respOpenAIErr is respErr in the OpenAI error format.
+func (h *Handler) respOpenAIErr(c *gin.Context, statusCode int, err error, codes ...api.ErrorCode) {
+	statusCode, e := openAIError(statusCode, err, codes...)
+	if statusCode >= http.StatusInternalServerError {
+		h.logger.Error("openai compatible request failed", zap.Error(err))
+	}
+	c.JSON(statusCode, &api.OpenAIErrorResponse{Error: e})
+}
+
+func openAIError(statusCode int, err error, codes ...api.ErrorCode) (int, *api.OpenAIError) {
+	statusCode, code := errorCode(statusCode, err)
+	if len(codes) > 0 {
+		code = codes[0]
+	}
+
+	typ := "invalid_request_error"
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		typ = "authentication_error"
+	case statusCode == http.StatusTooManyRequests:
+		typ = "rate_limit_error"
+	case statusCode >= http.StatusInternalServerError:
+		typ = "server_error"
+	}
+	return statusCode, &api.OpenAIError{
+		Message: err.Error(),
+		Type:    typ,
+		Code:    code,
+	}
+}
+
+// sseEvent renders a server-sent event whose data is v as JSON, or v itself
+// if it is a string.
+type sseEvent struct {
+	v any
+}
+
+func (e sseEvent) Render(w http.ResponseWriter) error {
+	var data []byte
+	if s, ok := e.v.(string); ok {
+		data = []byte(s)
+	} else {
+		var err error
+		if data, err = json.Marshal(e.v); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "data: "+string(data)+"\n\n")
+	return err
+}
+
+func (e sseEvent) WriteContentType(w http.ResponseWriter) {}
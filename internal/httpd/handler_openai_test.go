@@ -0,0 +1,156 @@
+package httpd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/client"
+	"github.com/pandodao/botastic/config"
+)
+
+// createTestBot creates a bot of the test chat model for the server's app.
+func createTestBot(t *testing.T, s *testServer, name string) *api.Bot {
+	bot, err := s.client.CreateBot(context.Background(), api.CreateBotRequest{
+		Name:             name,
+		ChatModel:        testChatModel,
+		Prompt:           "You are helpful.",
+		Temperature:      1,
+		ContextTurnCount: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+// countConvs returns the number of conversations of the server's app.
+func countConvs(t *testing.T, s *testServer) int {
+	r, err := s.client.ListConvs(context.Background(), api.ListConvsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(r.Items)
+}
+
+func TestOpenAIChatCompletions(t *testing.T) {
+	s := newTestServer(t, config.QuotaConfig{})
+	ctx := context.Background()
+	createTestBot(t, s, "bot")
+
+	resp, convID, err := s.client.OpenAIChatCompletions(ctx, uuid.Nil, api.OpenAIChatCompletionRequest{
+		Model: "bot",
+		Messages: []*api.OpenAIChatMessage{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hi there"},
+			{Role: "user", Content: "how are you?"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != testAnswer || resp.Usage.TotalTokens == 0 {
+		t.Fatalf("completion = %+v, want the answer", resp)
+	}
+
+	turns, err := s.client.ListTurns(ctx, convID, api.ListTurnsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns.Items) != 2 || turns.Items[0].Request != "hi" || turns.Items[0].Response != "hi there" ||
+		turns.Items[1].Request != "how are you?" || turns.Items[1].Response != testAnswer {
+		t.Fatalf("turns = %+v, want the history and the answered turn", turns.Items)
+	}
+
+	// the conversation continues, with its own history
+	var content strings.Builder
+	streamConvID, err := s.client.OpenAIChatCompletionsStream(ctx, convID, api.OpenAIChatCompletionRequest{
+		Model:    "bot",
+		Messages: []*api.OpenAIChatMessage{{Role: "user", Content: "bye"}},
+	}, func(chunk *api.OpenAIChatCompletionResponse) {
+		content.WriteString(chunk.Choices[0].Delta.Content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamConvID != convID || content.String() != testAnswer {
+		t.Errorf("stream = %s, %q, want %s, %q", streamConvID, content.String(), convID, testAnswer)
+	}
+	if n := countConvs(t, s); n != 1 {
+		t.Errorf("%d conversations, want 1", n)
+	}
+}
+
+func TestOpenAIChatCompletionsInvalid(t *testing.T) {
+	s := newTestServer(t, config.QuotaConfig{})
+	createTestBot(t, s, "bot")
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no messages", `{"model":"bot","messages":[]}`, http.StatusBadRequest},
+		{"null message", `{"model":"bot","messages":[null]}`, http.StatusBadRequest},
+		{"unknown role", `{"model":"bot","messages":[{"role":"tool","content":"hi"}]}`, http.StatusBadRequest},
+		{"empty content", `{"model":"bot","messages":[{"role":"user","content":""}]}`, http.StatusBadRequest},
+		{"last message of the assistant", `{"model":"bot","messages":[{"role":"assistant","content":"hi"}]}`, http.StatusBadRequest},
+		{"system message", `{"model":"bot","messages":[{"role":"system","content":"be nice"},{"role":"user","content":"hi"}]}`, http.StatusBadRequest},
+		{"unpaired history", `{"model":"bot","messages":[{"role":"user","content":"hi"},{"role":"user","content":"hi"}]}`, http.StatusBadRequest},
+		{"unknown bot", `{"model":"nobot","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.do(t, http.MethodPost, "/v1/chat/completions", tt.body)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+	if n := countConvs(t, s); n != 0 {
+		t.Errorf("%d conversations, want none", n)
+	}
+}
+
+func TestOpenAIChatCompletionsQuota(t *testing.T) {
+	s := newTestServer(t, config.QuotaConfig{AppRequestsPerMinute: 1})
+	ctx := context.Background()
+	createTestBot(t, s, "bot")
+
+	req := api.OpenAIChatCompletionRequest{
+		Model: "bot",
+		Messages: []*api.OpenAIChatMessage{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hi there"},
+			{Role: "user", Content: "how are you?"},
+		},
+	}
+	if _, _, err := s.client.OpenAIChatCompletions(ctx, uuid.Nil, req); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := s.client.OpenAIChatCompletions(ctx, uuid.Nil, req)
+	var cerr *client.Error
+	if !errors.As(err, &cerr) || cerr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("err = %v, want the rate limit exceeded", err)
+	}
+	if n := countConvs(t, s); n != 1 {
+		t.Errorf("%d conversations, want only the accepted one", n)
+	}
+}
+
+func TestOpenAIListModels(t *testing.T) {
+	s := newTestServer(t, config.QuotaConfig{})
+	createTestBot(t, s, "bot")
+
+	r, err := s.client.OpenAIListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Data) != 1 || r.Data[0].ID != "bot" {
+		t.Errorf("models = %+v, want the bot", r.Data)
+	}
+}
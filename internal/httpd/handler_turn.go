@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/internal/quota"
 	"github.com/pandodao/botastic/models"
 )
 
@@ -27,54 +28,128 @@ func (h *Handler) CreateTurn(c *gin.Context) {
 		return
 	}
 
+	conv, err := h.sh.GetConv(c, convID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if conv == nil || conv.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errConvNotFound)
+		return
+	}
+
 	turn := &models.Turn{
-		ConvID:  convID,
+		AppID:   conv.AppID,
+		ConvID:  conv.ID,
+		BotID:   conv.BotID,
 		Request: req.Content,
 		Status:  api.TurnStatusInit,
 	}
 
-	if !h.createTurn(c, turn, false) {
+	if !h.createTurn(c, conv, turn) {
 		return
 	}
 
 	h.respData(c, api.CreateTurnResponse(turn.API()))
 }
 
-func (h *Handler) createTurn(c *gin.Context, turn *models.Turn, newConv bool) bool {
-	if !newConv {
-		// make sure no init turn exists in the conversation
-		count, err := h.sh.GetTurnCount(c, turn.ConvID, api.TurnStatusInit)
-		if err != nil {
-			h.respErr(c, http.StatusInternalServerError, err)
+func (h *Handler) createTurn(c *gin.Context, conv *models.Conv, turn *models.Turn) bool {
+	result, err := h.enqueueTurn(c, appFromContext(c), conv, turn, nil)
+	if result != nil {
+		setQuotaHeaders(c, result)
+	}
+	if err != nil {
+		var rerr *turnRejectedError
+		if errors.As(err, &rerr) {
+			h.respErr(c, rerr.statusCode, rerr.err, rerr.code)
 			return false
 		}
-		if count != 0 {
-			h.respErr(c, http.StatusBadRequest, errors.New("conversation already has an init turn"), api.ErrorCodeConversationHasInitTurn)
-			return false
+		h.respErr(c, http.StatusInternalServerError, err)
+		return false
+	}
+
+	return true
+}
+
+// turnRejectedError is returned by enqueueTurn if the turn is not accepted
+// because of the conversation state or the limits of the app.
+type turnRejectedError struct {
+	statusCode int
+	code       api.ErrorCode
+	err        error
+}
+
+func (e *turnRejectedError) Error() string {
+	return e.err.Error()
+}
+
+// enqueueTurn stores the new turn of the conversation and sends it to be
+// processed by the version of the bot pinned by the conversation, or the
+// published one. A conversation which is not stored yet is created with the
+// history turns and the turn at once, so that rejected turns leave no
+// conversation behind.
+func (h *Handler) enqueueTurn(ctx context.Context, app *models.App, conv *models.Conv, turn *models.Turn, history []*models.Turn) (*quota.Result, error) {
+	// make sure no init turn exists in the conversation
+	count, err := h.sh.GetTurnCount(ctx, conv.ID, api.TurnStatusInit)
+	if err != nil {
+		return nil, err
+	}
+	if count != 0 {
+		return nil, &turnRejectedError{
+			statusCode: http.StatusConflict,
+			code:       api.ErrorCodeConversationHasInitTurn,
+			err:        errors.New("conversation already has an init turn"),
 		}
+	}
 
-		conv, err := h.sh.GetConv(c, turn.ConvID)
+	turn.BotVersion = conv.BotVersion
+	if turn.BotVersion == 0 {
+		bot, err := h.sh.GetBot(ctx, conv.BotID)
 		if err != nil {
-			h.respErr(c, http.StatusInternalServerError, err)
-			return false
+			return nil, err
 		}
-		if conv == nil {
-			h.respErr(c, http.StatusNotFound, errors.New("conversation not found"))
-			return false
+		if bot == nil {
+			return nil, &turnRejectedError{
+				statusCode: http.StatusNotFound,
+				code:       api.ErrorCodeBotNotFound,
+				err:        errBotNotFound,
+			}
 		}
-		turn.BotID = conv.BotID
+		turn.BotVersion = bot.PublishedVersion
 	}
 
-	if err := h.sh.CreateTurn(c, turn); err != nil {
-		h.respErr(c, http.StatusInternalServerError, err)
-		return false
+	result, err := h.qh.Check(ctx, app, conv.UserIdentity)
+	if err != nil {
+		var qerr *quota.ExceededError
+		if errors.As(err, &qerr) {
+			return result, &turnRejectedError{
+				statusCode: http.StatusTooManyRequests,
+				code:       qerr.Code,
+				err:        qerr,
+			}
+		}
+		return result, err
 	}
 
+	if conv.CreatedAt.IsZero() {
+		err = h.sh.CreateConvWithTurns(ctx, conv, append(history, turn))
+	} else {
+		err = h.sh.CreateTurn(ctx, turn)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	v := turn.API()
+	h.hub.Publish(conv.ID, &api.ConvEvent{
+		Type: api.ConvEventTypeTurn,
+		Turn: &v,
+	})
 	go func() {
 		h.turnTransmitter.GetTurnsChan() <- turn
 	}()
 
-	return true
+	return result, nil
 }
 
 func (h *Handler) CreateTurnOneway(c *gin.Context) {
@@ -85,8 +160,10 @@ func (h *Handler) CreateTurnOneway(c *gin.Context) {
 	}
 
 	var conv *models.Conv
+	app := appFromContext(c)
 	if req.ConversationID == uuid.Nil {
 		conv = &models.Conv{
+			AppID:        app.ID,
 			BotID:        req.BotID,
 			UserIdentity: req.UserIdentity,
 		}
@@ -100,22 +177,21 @@ func (h *Handler) CreateTurnOneway(c *gin.Context) {
 			h.respErr(c, http.StatusInternalServerError, err)
 			return
 		}
-		if conv == nil {
-			h.respErr(c, http.StatusNotFound, errors.New("conversation not found"))
+		if conv == nil || conv.AppID != app.ID {
+			h.respErr(c, http.StatusNotFound, errConvNotFound)
 			return
 		}
 	}
 
 	turn := &models.Turn{
+		AppID:   app.ID,
 		ConvID:  conv.ID,
+		BotID:   conv.BotID,
 		Request: req.Content,
 		Status:  api.TurnStatusInit,
 	}
-	if conv != nil {
-		turn.BotID = conv.BotID
-	}
 
-	if !h.createTurn(c, turn, conv != nil) {
+	if !h.createTurn(c, conv, turn) {
 		return
 	}
 
@@ -141,8 +217,8 @@ func (h *Handler) GetTurn(c *gin.Context) {
 		h.respErr(c, http.StatusInternalServerError, err)
 		return
 	}
-	if turn == nil {
-		h.respErr(c, http.StatusNotFound, errors.New("turn not found"))
+	if turn == nil || turn.AppID != appFromContext(c).ID {
+		h.respErr(c, http.StatusNotFound, errTurnNotFound)
 		return
 	}
 
@@ -177,3 +253,14 @@ func (h *Handler) getTurn(c *gin.Context, turn *models.Turn, req api.GetTurnRequ
 
 	h.respData(c, api.GetTurnResponse(turn.API()))
 }
+
+func setQuotaHeaders(c *gin.Context, r *quota.Result) {
+	if r.Requests.Limit > 0 {
+		c.Header("X-RateLimit-Limit", strconv.FormatInt(r.Requests.Limit, 10))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(r.Requests.Remaining, 10))
+	}
+	if r.Tokens.Limit > 0 {
+		c.Header("X-Quota-Limit", strconv.FormatInt(r.Tokens.Limit, 10))
+		c.Header("X-Quota-Remaining", strconv.FormatInt(r.Tokens.Remaining, 10))
+	}
+}
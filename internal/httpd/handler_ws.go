@@ -0,0 +1,165 @@
+package httpd
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	convEventsBufferSize = 256
+
+	// wsProtocol is the subprotocol selected for the clients offering it,
+	// browsers fail the connection if none of the subprotocols they offer is
+	// selected.
+	wsProtocol = "botastic"
+	// wsTokenProtocolPrefix prefixes the "app_id.app_secret" token of the
+	// clients authenticated by a subprotocol.
+	wsTokenProtocolPrefix = "botastic.token."
+)
+
+// ConvWebsocket lets the client send new turns of a conversation and receive
+// the status changes and streamed responses of its turns over a websocket.
+func (h *Handler) ConvWebsocket(c *gin.Context) {
+	convIDStr := c.Param("conv_id")
+	convID, err := uuid.Parse(convIDStr)
+	if err != nil {
+		h.respErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	app := appFromContext(c)
+	conv, err := h.sh.GetConv(c, convID)
+	if err != nil {
+		h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if conv == nil || conv.AppID != app.ID {
+		h.respErr(c, http.StatusNotFound, errConvNotFound)
+		return
+	}
+
+	server := websocket.Server{
+		// clients are authenticated by the app credentials, not by their
+		// origin
+		Handshake: func(cfg *websocket.Config, _ *http.Request) error {
+			protocols := cfg.Protocol
+			cfg.Protocol = nil
+			for _, p := range protocols {
+				if p == wsProtocol {
+					cfg.Protocol = []string{wsProtocol}
+				}
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			h.serveConvWebsocket(ws, app, conv)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// websocketToken returns the "app_id:app_secret" token of a websocket
+// handshake from a "botastic.token.app_id.app_secret" subprotocol. Tokens are
+// not taken from the query, URLs end up in logs and browser histories.
+func websocketToken(r *http.Request) (string, bool) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return "", false
+	}
+
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(p), wsTokenProtocolPrefix); ok {
+				// neither app ids nor secrets have dots, but colons are not
+				// allowed in subprotocols
+				return strings.Replace(token, ".", ":", 1), true
+			}
+		}
+	}
+	return "", false
+}
+
+func (h *Handler) serveConvWebsocket(ws *websocket.Conn, app *models.App, conv *models.Conv) {
+	defer ws.Close()
+
+	events, unsubscribe := h.hub.Subscribe(conv.ID, convEventsBufferSize)
+	defer unsubscribe()
+
+	var sendLock sync.Mutex
+	send := func(e *api.ConvEvent) error {
+		sendLock.Lock()
+		defer sendLock.Unlock()
+		return websocket.JSON.Send(ws, e)
+	}
+	sendErr := func(code api.ErrorCode, err error) error {
+		return send(&api.ConvEvent{
+			Type:  api.ConvEventTypeError,
+			Error: errorResponse(code, err),
+		})
+	}
+
+	ctx := ws.Request().Context()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg api.ConvMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+
+			if msg.Type != api.ConvMessageTypeTurn || msg.Content == "" {
+				if err := sendErr(api.ErrorCodeInvalidRequest, errors.New("invalid message")); err != nil {
+					return
+				}
+				continue
+			}
+
+			turn := &models.Turn{
+				AppID:   app.ID,
+				ConvID:  conv.ID,
+				BotID:   conv.BotID,
+				Request: msg.Content,
+				Status:  api.TurnStatusInit,
+			}
+			if _, err := h.enqueueTurn(ctx, app, conv, turn, nil); err != nil {
+				var rerr *turnRejectedError
+				if errors.As(err, &rerr) {
+					err = sendErr(rerr.code, rerr.err)
+				} else {
+					h.logger.Error("failed to enqueue turn", zap.Error(err), zap.String("conv_id", conv.ID.String()))
+					err = sendErr(api.ErrorCodeInternal, errors.New("failed to create turn"))
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case v, ok := <-events:
+			if !ok {
+				// the client can reconnect and get the turns it missed
+				sendErr(api.ErrorCodeInternal, errEventsClosed)
+				return
+			}
+			if err := send(v.(*api.ConvEvent)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package httpd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebsocketToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		upgrade   string
+		protocols []string
+		want      string
+		ok        bool
+	}{
+		{"subprotocol", "/ws", "websocket", []string{"botastic, botastic.token.id.secret"}, "id:secret", true},
+		{"subprotocol headers", "/ws", "WebSocket", []string{"botastic", "botastic.token.id.secret"}, "id:secret", true},
+		{"not a websocket", "/ws", "", []string{"botastic.token.id.secret"}, "", false},
+		{"no token", "/ws", "websocket", []string{"botastic"}, "", false},
+		{"query", "/ws?token=id:secret", "websocket", []string{"botastic"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.upgrade != "" {
+				r.Header.Set("Upgrade", tt.upgrade)
+			}
+			for _, p := range tt.protocols {
+				r.Header.Add("Sec-WebSocket-Protocol", p)
+			}
+			got, ok := websocketToken(r)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("websocketToken() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -42,7 +42,16 @@ func (s *Server) initRoutes() {
 	})
 
 	s.engine.GET("/hc", s.h.HealthCheck)
-	v1 := s.engine.Group("/api/v1")
+	s.engine.GET("/api/v1/openapi.json", s.OpenAPI)
+
+	// OpenAI compatible API, the model is the bot name
+	openai := s.engine.Group("/v1", h.Auth)
+	{
+		openai.POST("/chat/completions", h.OpenAIChatCompletions)
+		openai.GET("/models", h.OpenAIListModels)
+	}
+
+	v1 := s.engine.Group("/api/v1", h.Auth)
 	{
 		v1.GET("/models", h.ListModels)
 		v1.GET("/middlewares", h.ListMiddlewares)
@@ -50,10 +59,14 @@ func (s *Server) initRoutes() {
 		convs := v1.Group("/conversations")
 		{
 			convs.POST("/", h.CreateConv)
+			convs.GET("/", h.ListConvs)
 			convs.GET("/:conv_id", h.GetConv)
 			convs.PUT("/:conv_id", h.UpdateConv)
 			convs.DELETE("/:conv_id", h.DeleteConv)
 			convs.POST("/:conv_id", h.CreateTurn)
+			convs.GET("/:conv_id/turns", h.ListTurns)
+			convs.GET("/:conv_id/export", h.ExportConv)
+			convs.GET("/:conv_id/ws", h.ConvWebsocket)
 			convs.POST("/oneway", h.CreateTurnOneway)  // legacy, use POST /turns instead
 			convs.GET("/:conv_id/:turn_id", h.GetTurn) // legacy, use GET /turns/:turn_id instead
 		}
@@ -62,6 +75,8 @@ func (s *Server) initRoutes() {
 		{
 			turns.POST("/", h.CreateTurnOneway)
 			turns.GET("/:turn_id", h.GetTurn)
+			turns.POST("/:turn_id/feedback", h.CreateFeedback)
+			turns.GET("/:turn_id/feedback", h.GetFeedback)
 		}
 
 		bots := v1.Group("/bots")
@@ -70,7 +85,30 @@ func (s *Server) initRoutes() {
 			bots.GET("/:bot_id", h.GetBot)
 			bots.GET("/", h.GetBots)
 			bots.PUT("/:bot_id", h.UpdateBot)
+			bots.PATCH("/:bot_id", h.PatchBot)
 			bots.DELETE("/:bot_id", h.DeleteBot)
+			bots.POST("/:bot_id/preview", h.PreviewBot)
+			bots.GET("/:bot_id/export", h.ExportBot)
+			bots.GET("/:bot_id/versions", h.ListBotVersions)
+			bots.GET("/:bot_id/versions/:version", h.GetBotVersion)
+			bots.POST("/:bot_id/versions/:version/publish", h.PublishBotVersion)
+			bots.GET("/:bot_id/diff", h.DiffBotVersions)
+			bots.POST("/:bot_id/rollback", h.RollbackBot)
+			bots.GET("/:bot_id/feedback", h.ListBotFeedback)
+			bots.GET("/:bot_id/feedback/summary", h.GetBotFeedbackSummary)
+		}
+
+		// declarative bot manifests, see api.Manifest
+		v1.GET("/manifest", h.ExportManifest)
+		v1.POST("/manifest", h.ApplyManifest)
+
+		experiments := v1.Group("/experiments")
+		{
+			experiments.POST("/", h.CreateExperiment)
+			experiments.GET("/", h.ListExperiments)
+			experiments.GET("/:experiment_id", h.GetExperiment)
+			experiments.POST("/:experiment_id/stop", h.StopExperiment)
+			experiments.GET("/:experiment_id/metrics", h.GetExperimentMetrics)
 		}
 
 		indexes := v1.Group("/indexes")
@@ -0,0 +1,155 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pandodao/botastic/client"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/internal/experiment"
+	"github.com/pandodao/botastic/internal/export"
+	"github.com/pandodao/botastic/internal/manifest"
+	"github.com/pandodao/botastic/internal/quota"
+	"github.com/pandodao/botastic/internal/webhook"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/chanhub"
+	"github.com/pandodao/botastic/pkg/llms"
+	"github.com/pandodao/botastic/pkg/middleware"
+	"github.com/pandodao/botastic/state"
+	"github.com/pandodao/botastic/storage"
+	"go.uber.org/zap"
+)
+
+// TestMain runs the tests from the root of the repository, where the server
+// loads its templates from.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testChatModel is the chat model of the test server, it answers every
+// request with testAnswer.
+const (
+	testChatModel = "test:gpt-3.5-turbo"
+	testAnswer    = "hello"
+)
+
+type testServer struct {
+	*httptest.Server
+	sh     *storage.Handler
+	app    *models.App
+	secret string
+	client *client.Client
+}
+
+// do sends a request with a JSON body authenticated as the app of the
+// server.
+func (s *testServer) do(t *testing.T, method, path, body string) *http.Response {
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerAppID, s.app.AppID.String())
+	req.Header.Set(headerAppSecret, s.secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// newTestServer starts the server with an in-memory database, turns are
+// processed by a state handler and a client is authenticated as a new app.
+func newTestServer(t *testing.T, qcfg config.QuotaConfig) *testServer {
+	llmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			data, _ := json.Marshal(map[string]any{
+				"choices": []map[string]any{{
+					"delta": map[string]string{"content": testAnswer},
+				}},
+			})
+			fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message": map[string]string{"role": "assistant", "content": testAnswer},
+			}},
+			"usage": map[string]int{"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5},
+		})
+	}))
+	t.Cleanup(llmSrv.Close)
+	llmsh := llms.New(config.LLMsConfig{
+		Enabled: []string{"test"},
+		Items: map[string]config.LLMConfig{
+			"test": {
+				Provider: config.LLMProviderOpenAI,
+				OpenAI: &config.OpenAIConfig{
+					Key:        "key",
+					BaseURL:    llmSrv.URL,
+					ChatModels: []string{"gpt-3.5-turbo"},
+				},
+			},
+		},
+	})
+
+	sh, err := storage.Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zap.NewNop()
+	hub := chanhub.New()
+	mh := middleware.New(sh, llmsh, nil, nil)
+	d := webhook.New(config.WebhookConfig{MaxAttempts: 1, TimeoutSeconds: 1, WorkerCount: 1}, sh, logger)
+	stateh := state.New(config.StateConfig{WorkerCount: 1}, logger, sh, llmsh, hub, mh, d)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stateh.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	h := NewHandler(sh, llmsh, hub, stateh, stateh, logger, mh, nil, quota.New(qcfg, sh),
+		export.New(sh), experiment.New(sh), manifest.New(sh, llmsh, mh))
+	srv := httptest.NewServer(New(config.HttpdConfig{}, h, logger).engine)
+	t.Cleanup(srv.Close)
+
+	app, secret, err := models.NewApp("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.CreateApp(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{
+		Server: srv,
+		sh:     sh,
+		app:    app,
+		secret: secret,
+		client: client.New(srv.URL, app.AppID.String(), secret),
+	}
+}
@@ -0,0 +1,387 @@
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+)
+
+// routeDoc describes a route for the OpenAPI document. Query and Body are
+// the request types bound from the query string and the JSON body, Resp is
+// the type of the data field of the response envelope.
+type routeDoc struct {
+	Summary string
+	Query   any
+	Body    any
+	Resp    any
+	// Raw means Resp is the whole response body instead of the data field of
+	// api.Response, as in the OpenAI compatible routes.
+	Raw bool
+	// ContentTypes overrides the content types of the success response.
+	ContentTypes []string
+	Status       int
+	Public       bool
+}
+
+var routeDocs = map[string]routeDoc{
+	"GET /hc":                  {Summary: "Health check", Status: http.StatusNoContent, Public: true},
+	"GET /api/v1/openapi.json": {Summary: "OpenAPI document of this API", Raw: true, Resp: map[string]any{}, Public: true},
+
+	"POST /v1/chat/completions": {Summary: "OpenAI compatible chat completion, the model is the bot name", Body: api.OpenAIChatCompletionRequest{}, Resp: api.OpenAIChatCompletionResponse{}, Raw: true, ContentTypes: []string{"application/json", "text/event-stream"}},
+	"GET /v1/models":            {Summary: "List bots as OpenAI models", Resp: api.OpenAIListModelsResponse{}, Raw: true},
+
+	"GET /api/v1/models":      {Summary: "List chat and embedding models", Resp: api.ListModelsResponse{}},
+	"GET /api/v1/middlewares": {Summary: "List middlewares", Resp: api.ListMiddlewaresResponse{}},
+
+	"POST /api/v1/conversations/":                 {Summary: "Create a conversation", Body: api.CreateConvRequest{}, Resp: api.CreateConvResponse{}},
+	"GET /api/v1/conversations/":                  {Summary: "List conversations", Query: api.ListConvsRequest{}, Resp: api.ListConvsResponse{}},
+	"GET /api/v1/conversations/:conv_id":          {Summary: "Get a conversation", Resp: api.GetConvResponse{}},
+	"PUT /api/v1/conversations/:conv_id":          {Summary: "Update a conversation", Body: api.UpdateConvRequest{}, Resp: api.GetConvResponse{}},
+	"DELETE /api/v1/conversations/:conv_id":       {Summary: "Delete a conversation"},
+	"POST /api/v1/conversations/:conv_id":         {Summary: "Create a turn in a conversation", Body: api.CreateTurnRequest{}, Resp: api.CreateTurnResponse{}},
+	"GET /api/v1/conversations/:conv_id/turns":    {Summary: "List turns of a conversation", Query: api.ListTurnsRequest{}, Resp: api.ListTurnsResponse{}},
+	"GET /api/v1/conversations/:conv_id/export":   {Summary: "Export a conversation", Query: api.ExportRequest{}, Resp: api.Export{}, Raw: true, ContentTypes: exportContentTypes},
+	"GET /api/v1/conversations/:conv_id/ws":       {Summary: "Websocket of a conversation, receiving api.ConvMessage and sending api.ConvEvent. Clients without headers authenticate by a botastic.token.<app_id>.<app_secret> subprotocol", Status: http.StatusSwitchingProtocols},
+	"POST /api/v1/conversations/oneway":           {Summary: "Create a turn, deprecated, use POST /api/v1/turns/", Body: api.CreateTurnOnewayRequest{}, Resp: api.CreateTurnOnewayResponse{}},
+	"GET /api/v1/conversations/:conv_id/:turn_id": {Summary: "Get a turn, deprecated, use GET /api/v1/turns/{turn_id}", Query: api.GetTurnRequest{}, Resp: api.GetTurnResponse{}},
+
+	"POST /api/v1/turns/":                  {Summary: "Create a turn, creating the conversation if needed", Body: api.CreateTurnOnewayRequest{}, Resp: api.CreateTurnOnewayResponse{}},
+	"GET /api/v1/turns/:turn_id":           {Summary: "Get a turn, optionally blocking until it is processed", Query: api.GetTurnRequest{}, Resp: api.GetTurnResponse{}},
+	"POST /api/v1/turns/:turn_id/feedback": {Summary: "Rate a turn, replacing its previous feedback", Body: api.CreateFeedbackRequest{}, Resp: api.CreateFeedbackResponse{}},
+	"GET /api/v1/turns/:turn_id/feedback":  {Summary: "Get the feedback of a turn", Resp: api.GetFeedbackResponse{}},
+
+	"POST /api/v1/bots/":                {Summary: "Create a bot", Body: api.CreateBotRequest{}, Resp: api.CreateBotResponse{}},
+	"GET /api/v1/bots/:bot_id":          {Summary: "Get a bot", Resp: api.GetBotResponse{}},
+	"GET /api/v1/bots/":                 {Summary: "List bots", Resp: api.GetBotsResponse{}},
+	"PUT /api/v1/bots/:bot_id":          {Summary: "Update a bot, storing its chat settings as a new version", Body: api.UpdateBotRequest{}, Resp: api.UpdateBotResponse{}},
+	"PATCH /api/v1/bots/:bot_id":        {Summary: "Update fields of a bot with a JSON merge patch, conditional on If-Match or updated_at", Query: api.PatchBotRequest{}, Body: api.BotPatch{}, Resp: api.PatchBotResponse{}},
+	"DELETE /api/v1/bots/:bot_id":       {Summary: "Delete a bot"},
+	"POST /api/v1/bots/:bot_id/preview": {Summary: "Preview the prompt of a bot", Body: api.PreviewBotRequest{}, Resp: api.PreviewBotResponse{}},
+	"GET /api/v1/bots/:bot_id/export":   {Summary: "Export the conversations of a bot", Query: api.ExportRequest{}, Resp: api.Export{}, Raw: true, ContentTypes: exportContentTypes},
+
+	"GET /api/v1/bots/:bot_id/versions":                   {Summary: "List the versions of a bot, latest first", Resp: api.GetBotVersionsResponse{}},
+	"GET /api/v1/bots/:bot_id/versions/:version":          {Summary: "Get a version of a bot", Resp: api.GetBotVersionResponse{}},
+	"POST /api/v1/bots/:bot_id/versions/:version/publish": {Summary: "Publish a version of a bot", Resp: api.GetBotResponse{}},
+	"GET /api/v1/bots/:bot_id/diff":                       {Summary: "Diff two versions of a bot", Query: api.DiffBotVersionsRequest{}, Resp: api.DiffBotVersionsResponse{}},
+	"POST /api/v1/bots/:bot_id/rollback":                  {Summary: "Publish the version published before the current one", Resp: api.GetBotResponse{}},
+	"GET /api/v1/bots/:bot_id/feedback":                   {Summary: "List the feedback of a bot", Query: api.ListFeedbackRequest{}, Resp: api.ListFeedbackResponse{}},
+	"GET /api/v1/bots/:bot_id/feedback/summary":           {Summary: "Aggregate the feedback of a bot", Resp: api.FeedbackSummary{}},
+
+	"GET /api/v1/manifest":  {Summary: "Export the manifest of bots, as a YAML file with format=yaml", Query: api.ExportManifestRequest{}, Resp: api.Manifest{}, ContentTypes: manifestContentTypes},
+	"POST /api/v1/manifest": {Summary: "Create or update the bots of a manifest by name", Query: api.ApplyManifestRequest{}, Body: api.Manifest{}, Resp: api.ApplyManifestResponse{}},
+
+	"POST /api/v1/experiments/":                      {Summary: "Start an experiment across versions of a bot", Body: api.CreateExperimentRequest{}, Resp: api.CreateExperimentResponse{}},
+	"GET /api/v1/experiments/":                       {Summary: "List experiments", Query: api.ListExperimentsRequest{}, Resp: api.ListExperimentsResponse{}},
+	"GET /api/v1/experiments/:experiment_id":         {Summary: "Get an experiment", Resp: api.GetExperimentResponse{}},
+	"POST /api/v1/experiments/:experiment_id/stop":   {Summary: "Stop an experiment", Resp: api.GetExperimentResponse{}},
+	"GET /api/v1/experiments/:experiment_id/metrics": {Summary: "Get the metrics of each variant of an experiment", Resp: api.ExperimentMetrics{}},
+
+	"POST /api/v1/indexes/":      {Summary: "Upsert indexes", Body: api.UpsertIndexesRequest{}, Resp: api.UpsertIndexesResponse{}},
+	"GET /api/v1/indexes/search": {Summary: "Search indexes", Query: api.SearchIndexesRequest{}, Resp: api.SearchIndexesResponse{}},
+}
+
+var manifestContentTypes = []string{"application/json", "application/x-yaml"}
+
+var exportContentTypes = []string{"application/json", "text/markdown", "application/x-ndjson"}
+
+var pathParamRegexp = regexp.MustCompile(`:(\w+)`)
+
+// openAPISpec generates the OpenAPI document of the routes of the engine.
+func (s *Server) openAPISpec() (map[string]any, error) {
+	g := &schemaGenerator{schemas: map[string]any{}}
+	paths := map[string]map[string]any{}
+	for _, r := range s.engine.Routes() {
+		if r.Path == "/" {
+			continue
+		}
+		doc, ok := routeDocs[r.Method+" "+r.Path]
+		if !ok {
+			return nil, fmt.Errorf("route %s %s is not documented", r.Method, r.Path)
+		}
+
+		path := pathParamRegexp.ReplaceAllString(r.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(r.Method)] = g.operation(r.Method, r.Path, doc)
+	}
+
+	g.schemas["Response"] = g.schema(reflect.TypeOf(api.Response{}))
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Botastic API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"appID":     map[string]any{"type": "apiKey", "in": "header", "name": headerAppID},
+				"appSecret": map[string]any{"type": "apiKey", "in": "header", "name": headerAppSecret},
+				"bearer":    map[string]any{"type": "http", "scheme": "bearer", "description": "app_id:app_secret"},
+			},
+		},
+		"security": []any{
+			map[string]any{"appID": []string{}, "appSecret": []string{}},
+			map[string]any{"bearer": []string{}},
+		},
+	}, nil
+}
+
+// OpenAPI serves the OpenAPI document generated from the routes.
+func (s *Server) OpenAPI(c *gin.Context) {
+	spec, err := s.openAPISpec()
+	if err != nil {
+		s.h.respErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, spec)
+}
+
+func (g *schemaGenerator) operation(method, path string, doc routeDoc) map[string]any {
+	op := map[string]any{
+		"summary":     doc.Summary,
+		"operationId": operationID(method, path),
+	}
+	if doc.Public {
+		op["security"] = []any{}
+	}
+
+	var params []any
+	for _, m := range pathParamRegexp.FindAllStringSubmatch(path, -1) {
+		schema := map[string]any{"type": "integer"}
+		if m[1] == "conv_id" {
+			schema = map[string]any{"type": "string", "format": "uuid"}
+		}
+		params = append(params, map[string]any{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	if doc.Query != nil {
+		params = append(params, g.queryParams(reflect.TypeOf(doc.Query))...)
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if doc.Body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(doc.Body))},
+			},
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if status == http.StatusOK {
+		var schema map[string]any
+		switch {
+		case doc.Raw:
+			schema = g.schema(reflect.TypeOf(doc.Resp))
+		default:
+			data := map[string]any{}
+			if doc.Resp != nil {
+				data = g.schema(reflect.TypeOf(doc.Resp))
+			}
+			schema = map[string]any{
+				"allOf": []any{
+					map[string]any{"$ref": "#/components/schemas/Response"},
+					map[string]any{"type": "object", "properties": map[string]any{"data": data}},
+				},
+			}
+		}
+
+		contentTypes := doc.ContentTypes
+		if contentTypes == nil {
+			contentTypes = []string{"application/json"}
+		}
+		content := map[string]any{}
+		for _, ct := range contentTypes {
+			content[ct] = map[string]any{"schema": schema}
+		}
+		success["content"] = content
+	}
+
+	errSchema := map[string]any{"$ref": "#/components/schemas/Response"}
+	if doc.Raw && strings.HasPrefix(path, "/v1/") {
+		errSchema = g.schema(reflect.TypeOf(api.OpenAIErrorResponse{}))
+	}
+	op["responses"] = map[string]any{
+		fmt.Sprint(status): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": errSchema},
+			},
+		},
+	}
+	return op
+}
+
+// operationID converts a route to a camel case id, e.g. GET /api/v1/bots/:bot_id
+// to getBotsBotId and GET /v1/models to getOpenAIModels.
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	if p, ok := strings.CutPrefix(path, "/api/v1"); ok {
+		path = p
+	} else if p, ok := strings.CutPrefix(path, "/v1"); ok {
+		path = p
+		b.WriteString("OpenAI")
+	}
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '_' || r == '.' || r == '-'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// schema returns the schema of t, named struct types of the api package are
+// added to the components and referenced.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" || t.PkgPath() != reflect.TypeOf(api.Response{}).PkgPath() {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// placeholder for recursive types
+			g.schemas[t.Name()] = map[string]any{}
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	g.structFields(t, "json", func(name string, f reflect.StructField) {
+		s := g.schema(f.Type)
+		if enum := bindingEnum(f); enum != nil {
+			s["enum"] = enum
+		}
+		properties[name] = s
+		if bindingRequired(f) {
+			required = append(required, name)
+		}
+	})
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *schemaGenerator) queryParams(t reflect.Type) []any {
+	var params []any
+	g.structFields(t, "form", func(name string, f reflect.StructField) {
+		s := g.schema(f.Type)
+		if enum := bindingEnum(f); enum != nil {
+			s["enum"] = enum
+		}
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "query",
+			"required": bindingRequired(f),
+			"schema":   s,
+		})
+	})
+	return params
+}
+
+// structFields calls fn with the exported fields of t named by the given tag,
+// flattening embedded structs like encoding/json does.
+func (g *schemaGenerator) structFields(t reflect.Type, tag string, fn func(string, reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.structFields(f.Type, tag, fn)
+			continue
+		}
+		if !f.IsExported() || name == "" {
+			continue
+		}
+		fn(name, f)
+	}
+}
+
+func bindingRequired(f reflect.StructField) bool {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func bindingEnum(f reflect.StructField) []string {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		if values, ok := strings.CutPrefix(rule, "oneof="); ok {
+			return strings.Fields(values)
+		}
+	}
+	return nil
+}
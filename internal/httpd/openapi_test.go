@@ -0,0 +1,58 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pandodao/botastic/config"
+	"go.uber.org/zap"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	s := New(config.HttpdConfig{}, &Handler{}, zap.NewNop())
+	spec, err := s.openAPISpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := json.Marshal(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := map[string]bool{}
+	for _, r := range s.engine.Routes() {
+		routes[r.Method+" "+r.Path] = true
+	}
+	for route := range routeDocs {
+		if !routes[route] {
+			t.Errorf("%s is documented but not routed", route)
+		}
+	}
+
+	paths := spec["paths"].(map[string]map[string]any)
+	for route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if path == "/" {
+			continue
+		}
+		path = pathParamRegexp.ReplaceAllString(path, "{$1}")
+		if _, ok := paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("%s %s is not in the document", method, path)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := newTestServer(t, config.QuotaConfig{})
+
+	spec, err := s.client.OpenAPI(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := spec["paths"].(map[string]any)
+	bot, _ := paths["/api/v1/bots/{bot_id}"].(map[string]any)
+	if _, ok := bot["patch"]; !ok {
+		t.Errorf("paths = %v, want the bot routes", paths)
+	}
+}
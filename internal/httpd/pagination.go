@@ -0,0 +1,52 @@
+package httpd
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func pageLimit(req api.PaginationRequest) int {
+	switch {
+	case req.Limit <= 0:
+		return defaultPageLimit
+	case req.Limit > maxPageLimit:
+		return maxPageLimit
+	default:
+		return req.Limit
+	}
+}
+
+// encodeCursor returns an opaque cursor pointing after the record created at
+// t with the given id.
+func encodeCursor(t time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(t.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+
+	ts, id, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return time.Time{}, "", errInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+
+	return t, id, nil
+}
@@ -0,0 +1,121 @@
+package httpd
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+)
+
+func TestCursor(t *testing.T) {
+	ts := time.Date(2023, 5, 6, 7, 8, 9, 123456789, time.FixedZone("UTC+8", 8*3600))
+	for _, id := range []string{"42", uuid.NewString(), ""} {
+		cursor := encodeCursor(ts, id)
+		gotTime, gotID, err := decodeCursor(cursor)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", cursor, err)
+		}
+		if !gotTime.Equal(ts) || gotID != id {
+			t.Errorf("decodeCursor(encodeCursor(%v, %q)) = %v, %q", ts, id, gotTime, gotID)
+		}
+	}
+
+	for _, cursor := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("no separator")),
+		base64.RawURLEncoding.EncodeToString([]byte("yesterday|42")),
+		// padded base64 is not accepted
+		base64.URLEncoding.EncodeToString([]byte("2023-05-06T07:08:09Z|4")),
+	} {
+		if _, _, err := decodeCursor(cursor); err != errInvalidCursor {
+			t.Errorf("decodeCursor(%q) = %v, want errInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	for _, c := range []struct {
+		limit, want int
+	}{
+		{0, defaultPageLimit},
+		{-1, defaultPageLimit},
+		{5, 5},
+		{maxPageLimit, maxPageLimit},
+		{maxPageLimit + 1, maxPageLimit},
+	} {
+		if got := pageLimit(api.PaginationRequest{Limit: c.limit}); got != c.want {
+			t.Errorf("pageLimit(%d) = %d, want %d", c.limit, got, c.want)
+		}
+	}
+}
+
+// TestConvCursorPages pages through conversations created at the same time
+// with the cursors of the conversation listing.
+func TestConvCursorPages(t *testing.T) {
+	ctx := context.Background()
+	sh, err := storage.Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Now().Add(-time.Hour)
+	want := map[uuid.UUID]bool{}
+	for i := 0; i < 5; i++ {
+		conv := &models.Conv{ID: uuid.New(), AppID: 1, BotID: 1, CreatedAt: created}
+		if i == 4 {
+			conv.CreatedAt = created.Add(time.Second)
+		}
+		if err := sh.CreateConv(ctx, conv); err != nil {
+			t.Fatal(err)
+		}
+		want[conv.ID] = true
+	}
+
+	for _, desc := range []bool{false, true} {
+		seen := map[uuid.UUID]bool{}
+		var last time.Time
+		params := storage.ListConvsParams{AppID: 1, Limit: 2, Desc: desc}
+		for page := 0; ; page++ {
+			if page > 5 {
+				t.Fatal("the pages do not end")
+			}
+			convs, err := sh.ListConvs(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, conv := range convs {
+				if seen[conv.ID] {
+					t.Fatalf("conversation %s is listed twice", conv.ID)
+				}
+				if !last.IsZero() && (conv.CreatedAt.Before(last) != desc && !conv.CreatedAt.Equal(last)) {
+					t.Fatalf("conversation %s is out of order", conv.ID)
+				}
+				seen[conv.ID] = true
+				last = conv.CreatedAt
+			}
+			if len(convs) < params.Limit {
+				break
+			}
+
+			lastConv := convs[len(convs)-1]
+			cursorTime, id, err := decodeCursor(encodeCursor(lastConv.CreatedAt, lastConv.ID.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			params.AfterCreatedAt = cursorTime
+			params.AfterID = uuid.MustParse(id)
+		}
+		if len(seen) != len(want) {
+			t.Errorf("desc %v: %d conversations listed, want %d", desc, len(seen), len(want))
+		}
+	}
+}
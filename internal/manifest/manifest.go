@@ -0,0 +1,321 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/llms"
+	"github.com/pandodao/botastic/storage"
+)
+
+// searchMiddleware is the middleware searching the indexes of a group.
+const searchMiddleware = "botastic-search"
+
+type MiddlewareValidator interface {
+	ValidateConfig(*api.MiddlewareConfig) error
+}
+
+// BotNotFoundError is returned when exporting a bot that does not exist.
+type BotNotFoundError struct {
+	Name string
+}
+
+func (e *BotNotFoundError) Error() string {
+	return fmt.Sprintf("bot not found: %s", e.Name)
+}
+
+// InvalidError is returned when applying an invalid manifest, nothing is
+// applied then.
+type InvalidError struct {
+	Err error
+}
+
+func (e *InvalidError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+type Handler struct {
+	sh   *storage.Handler
+	llms *llms.Handler
+	mv   MiddlewareValidator
+}
+
+func New(sh *storage.Handler, llms *llms.Handler, mv MiddlewareValidator) *Handler {
+	return &Handler{
+		sh:   sh,
+		llms: llms,
+		mv:   mv,
+	}
+}
+
+// Export returns the manifest of the named bots of the app, or of all of its
+// bots if no name is given.
+func (h *Handler) Export(ctx context.Context, appID uint, names []string) (*api.Manifest, error) {
+	var bots []*models.Bot
+	if len(names) == 0 {
+		var err error
+		if bots, err = h.sh.GetBots(ctx, appID); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		bot, err := h.sh.GetBotByName(ctx, appID, name)
+		if err != nil {
+			return nil, err
+		}
+		if bot == nil {
+			return nil, &BotNotFoundError{Name: name}
+		}
+		bots = append(bots, bot)
+	}
+
+	m := &api.Manifest{
+		Bots: make([]*api.BotManifest, 0, len(bots)),
+	}
+	for _, bot := range bots {
+		m.Bots = append(m.Bots, botManifest(bot))
+	}
+	return m, nil
+}
+
+func botManifest(bot *models.Bot) *api.BotManifest {
+	bm := &api.BotManifest{
+		Name:             bot.Name,
+		ChatModel:        bot.ChatModel,
+		Prompt:           bot.Prompt,
+		BoundaryPrompt:   bot.BoundaryPrompt,
+		ContextTurnCount: bot.ContextTurnCount,
+		Temperature:      bot.Temperature,
+		TimeoutSeconds:   bot.TimeoutSeconds,
+		WebhookURL:       bot.WebhookURL,
+	}
+	if mc := normalizeMiddlewares(bot.Middlewares); mc != nil {
+		v := api.MiddlewareConfig(*mc)
+		bm.Middlewares = &v
+		bm.IndexGroups = indexGroups(bm)
+	}
+	return bm
+}
+
+// Apply creates the bots of the manifest missing in the app and updates the
+// others, matched by name. Changed chat settings are published as a new
+// version of the bot. Bots of the app missing in the manifest are left as
+// they are.
+func (h *Handler) Apply(ctx context.Context, appID uint, m *api.Manifest, dryRun bool) (*api.ApplyManifestResponse, error) {
+	if err := h.validate(m); err != nil {
+		return nil, &InvalidError{Err: err}
+	}
+
+	resp := &api.ApplyManifestResponse{
+		DryRun: dryRun,
+		Bots:   make([]*api.BotManifestResult, 0, len(m.Bots)),
+	}
+	for _, bm := range m.Bots {
+		r, err := h.apply(ctx, appID, bm, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("apply bot %s: %w", bm.Name, err)
+		}
+		resp.Bots = append(resp.Bots, r)
+	}
+	return resp, nil
+}
+
+// validate checks the manifest with the binding rules of its fields, as the
+// HTTP API binds it, and against the models and middlewares.
+func (h *Handler) validate(m *api.Manifest) error {
+	if err := binding.Validator.ValidateStruct(m); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(m.Bots))
+	for _, bm := range m.Bots {
+		if bm.Name == "" {
+			return errors.New("bot name is required")
+		}
+		if names[bm.Name] {
+			return fmt.Errorf("duplicate bot name: %s", bm.Name)
+		}
+		names[bm.Name] = true
+
+		if _, err := h.llms.GetChatModel(bm.ChatModel); err != nil {
+			return fmt.Errorf("bot %s: chat model does not exist: %s", bm.Name, bm.ChatModel)
+		}
+		if bm.Middlewares != nil {
+			if err := h.mv.ValidateConfig(bm.Middlewares); err != nil {
+				return fmt.Errorf("bot %s: %w", bm.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (h *Handler) apply(ctx context.Context, appID uint, bm *api.BotManifest, dryRun bool) (*api.BotManifestResult, error) {
+	r := &api.BotManifestResult{
+		Name: bm.Name,
+	}
+	warnings, err := h.checkIndexGroups(ctx, appID, bm)
+	if err != nil {
+		return nil, err
+	}
+	r.Warnings = warnings
+
+	bot, err := h.sh.GetBotByName(ctx, appID, bm.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if bot == nil {
+		r.Action = api.ManifestActionCreate
+		if dryRun {
+			return r, nil
+		}
+
+		bot = &models.Bot{
+			AppID:      appID,
+			Name:       bm.Name,
+			WebhookURL: bm.WebhookURL,
+		}
+		botVersion(bot, bm).Apply(bot)
+		if err := h.sh.CreateBot(ctx, bot); err != nil {
+			return nil, err
+		}
+		r.BotID, r.Version = bot.ID, bot.PublishedVersion
+		return r, nil
+	}
+
+	r.BotID, r.Version = bot.ID, bot.PublishedVersion
+	current := models.NewBotVersion(bot)
+	current.Middlewares = normalizeMiddlewares(current.Middlewares)
+	v := botVersion(bot, bm)
+	r.Changes = current.Diff(*v)
+	if bot.WebhookURL != bm.WebhookURL {
+		r.Changes = append(r.Changes, &api.BotVersionChange{Field: "webhook_url", From: bot.WebhookURL, To: bm.WebhookURL})
+	}
+
+	switch {
+	case len(r.Changes) == 0:
+		r.Action = api.ManifestActionUnchanged
+		return r, nil
+	case dryRun:
+		r.Action = api.ManifestActionUpdate
+		return r, nil
+	}
+
+	r.Action = api.ManifestActionUpdate
+	m := map[string]any{"webhook_url": bm.WebhookURL}
+	// the webhook is not versioned, the chat settings are
+	if len(r.Changes) == 1 && bot.WebhookURL != bm.WebhookURL {
+		v = nil
+	}
+	if _, err := h.sh.UpdateBotVersion(ctx, appID, bot.ID, bot.UpdatedAt, m, v, true); err != nil {
+		return nil, err
+	}
+	if v != nil {
+		r.Version = v.Version
+	}
+	return r, nil
+}
+
+// botVersion returns the chat settings of the manifest as a version of the
+// bot.
+func botVersion(bot *models.Bot, bm *api.BotManifest) *models.BotVersion {
+	v := models.NewBotVersion(bot)
+	v.ChatModel = bm.ChatModel
+	v.Prompt = bm.Prompt
+	v.BoundaryPrompt = bm.BoundaryPrompt
+	v.ContextTurnCount = bm.ContextTurnCount
+	v.Temperature = bm.Temperature
+	v.TimeoutSeconds = bm.TimeoutSeconds
+	v.Middlewares = nil
+	if bm.Middlewares != nil {
+		mc := models.MiddlewareConfig(*bm.Middlewares)
+		v.Middlewares = normalizeMiddlewares(&mc)
+	}
+	return v
+}
+
+// checkIndexGroups warns about the index groups of the bot, declared or
+// searched by its middlewares, that have no indexes in the app.
+func (h *Handler) checkIndexGroups(ctx context.Context, appID uint, bm *api.BotManifest) ([]string, error) {
+	groups := append(indexGroups(bm), bm.IndexGroups...)
+	sort.Strings(groups)
+
+	var warnings []string
+	for i, group := range groups {
+		if i > 0 && groups[i-1] == group {
+			continue
+		}
+		count, err := h.sh.CountIndexesByGroupKey(ctx, appID, group)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			warnings = append(warnings, fmt.Sprintf("index group %s has no indexes", group))
+		}
+	}
+	return warnings, nil
+}
+
+// indexGroups returns the sorted group keys searched by the middlewares of
+// the bot.
+func indexGroups(bm *api.BotManifest) []string {
+	if bm.Middlewares == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var groups []string
+	for _, item := range bm.Middlewares.Items {
+		if item.Name != searchMiddleware {
+			continue
+		}
+		if group := item.Options["group_key"]; group != "" && !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// normalizeMiddlewares drops empty middleware configs and options, which are
+// not stored, for configs to compare equal after being stored.
+func normalizeMiddlewares(mc *models.MiddlewareConfig) *models.MiddlewareConfig {
+	if mc == nil || (len(mc.Items) == 0 && len(mc.ResponseItems) == 0) {
+		return nil
+	}
+
+	return &models.MiddlewareConfig{
+		Items:         normalizeItems(mc.Items),
+		ResponseItems: normalizeItems(mc.ResponseItems),
+		Router:        mc.Router,
+	}
+}
+
+func normalizeItems(items []*api.Middleware) []*api.Middleware {
+	if len(items) == 0 {
+		return nil
+	}
+
+	r := make([]*api.Middleware, 0, len(items))
+	for _, item := range items {
+		v := *item
+		if len(v.Options) == 0 {
+			v.Options = nil
+		}
+		if len(v.DependsOn) == 0 {
+			v.DependsOn = nil
+		}
+		r = append(r, &v)
+	}
+	return r
+}
@@ -0,0 +1,197 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/pkg/llms"
+	"github.com/pandodao/botastic/storage"
+)
+
+func changedFields(r *api.BotManifestResult) []string {
+	fields := make([]string, 0, len(r.Changes))
+	for _, c := range r.Changes {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+func TestApplyDiff(t *testing.T) {
+	ctx := context.Background()
+	sh, err := storage.Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(sh, nil, nil)
+
+	bm := &api.BotManifest{
+		Name:        "helper",
+		ChatModel:   "openai:gpt-3.5-turbo",
+		Prompt:      "You are helpful.",
+		Temperature: 1,
+		Middlewares: &api.MiddlewareConfig{
+			Items: []*api.Middleware{
+				{ID: "search", Name: searchMiddleware, Options: map[string]string{"group_key": "docs"}, DependsOn: []string{}},
+				{ID: "redact", Name: "redact", Options: map[string]string{}},
+			},
+			ResponseItems: []*api.Middleware{},
+		},
+	}
+
+	r, err := h.apply(ctx, 1, bm, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Action != api.ManifestActionCreate || r.BotID != 0 {
+		t.Fatalf("dry run = %+v, want a bot to create", r)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0] != "index group docs has no indexes" {
+		t.Errorf("warnings = %v", r.Warnings)
+	}
+	if bot, _ := sh.GetBotByName(ctx, 1, bm.Name); bot != nil {
+		t.Fatal("the dry run created the bot")
+	}
+
+	if r, err = h.apply(ctx, 1, bm, false); err != nil {
+		t.Fatal(err)
+	}
+	if r.Action != api.ManifestActionCreate || r.BotID == 0 || r.Version != 1 {
+		t.Fatalf("apply = %+v, want the bot created", r)
+	}
+
+	// the empty options, dependencies and response items are not stored and
+	// do not count as changes, neither does exporting and applying the bot
+	bot, err := sh.GetBotByName(ctx, 1, bm.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*api.BotManifest{bm, botManifest(bot)} {
+		if r, err = h.apply(ctx, 1, m, false); err != nil {
+			t.Fatal(err)
+		}
+		if r.Action != api.ManifestActionUnchanged || len(r.Changes) != 0 {
+			t.Fatalf("apply = %+v, changes %v, want the bot unchanged", r, changedFields(r))
+		}
+	}
+
+	changed := *bm
+	changed.Prompt = "You are very helpful."
+	changed.WebhookURL = "https://example.com/hook"
+	if r, err = h.apply(ctx, 1, &changed, true); err != nil {
+		t.Fatal(err)
+	}
+	if fields := changedFields(r); r.Action != api.ManifestActionUpdate || len(fields) != 2 || fields[0] != "prompt" || fields[1] != "webhook_url" {
+		t.Fatalf("dry run = %+v, changes %v, want prompt and webhook_url", r, fields)
+	}
+	if r.Changes[0].From != bm.Prompt || r.Changes[0].To != changed.Prompt {
+		t.Errorf("prompt change = %+v", r.Changes[0])
+	}
+
+	// the webhook is not versioned
+	webhook := *bm
+	webhook.WebhookURL = changed.WebhookURL
+	if r, err = h.apply(ctx, 1, &webhook, false); err != nil {
+		t.Fatal(err)
+	}
+	if r.Action != api.ManifestActionUpdate || r.Version != 1 {
+		t.Fatalf("apply = %+v, want the webhook updated without a new version", r)
+	}
+
+	if r, err = h.apply(ctx, 1, &changed, false); err != nil {
+		t.Fatal(err)
+	}
+	if fields := changedFields(r); r.Action != api.ManifestActionUpdate || r.Version != 2 || len(fields) != 1 || fields[0] != "prompt" {
+		t.Fatalf("apply = %+v, changes %v, want version 2 with the prompt changed", r, fields)
+	}
+	if bot, err = sh.GetBotByName(ctx, 1, bm.Name); err != nil {
+		t.Fatal(err)
+	}
+	if bot.Prompt != changed.Prompt || bot.WebhookURL != changed.WebhookURL || bot.PublishedVersion != 2 {
+		t.Errorf("bot = %+v, want the manifest applied and published", bot)
+	}
+
+	// middlewares are compared in order
+	reordered := changed
+	mc := *changed.Middlewares
+	mc.Items = []*api.Middleware{mc.Items[1], mc.Items[0]}
+	reordered.Middlewares = &mc
+	if r, err = h.apply(ctx, 1, &reordered, true); err != nil {
+		t.Fatal(err)
+	}
+	if fields := changedFields(r); len(fields) != 1 || fields[0] != "middlewares" {
+		t.Errorf("changes = %v, want middlewares", fields)
+	}
+}
+
+func TestIndexGroups(t *testing.T) {
+	bm := &api.BotManifest{
+		Middlewares: &api.MiddlewareConfig{
+			Items: []*api.Middleware{
+				{ID: "a", Name: searchMiddleware, Options: map[string]string{"group_key": "web"}},
+				{ID: "b", Name: searchMiddleware, Options: map[string]string{"group_key": "docs"}},
+				{ID: "c", Name: searchMiddleware, Options: map[string]string{"group_key": "web"}},
+				{ID: "d", Name: searchMiddleware},
+				{ID: "e", Name: "fetch", Options: map[string]string{"group_key": "other"}},
+			},
+		},
+	}
+	if groups := indexGroups(bm); len(groups) != 2 || groups[0] != "docs" || groups[1] != "web" {
+		t.Errorf("indexGroups = %v, want [docs web]", groups)
+	}
+	if groups := indexGroups(&api.BotManifest{}); groups != nil {
+		t.Errorf("indexGroups without middlewares = %v", groups)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	h := New(nil, llms.New(config.LLMsConfig{
+		Enabled: []string{"openai"},
+		Items: map[string]config.LLMConfig{
+			"openai": {
+				Provider: config.LLMProviderOpenAI,
+				OpenAI:   &config.OpenAIConfig{Key: "key", ChatModels: []string{"gpt-3.5-turbo"}},
+			},
+		},
+	}), nil)
+	valid := func() *api.BotManifest {
+		return &api.BotManifest{Name: "helper", ChatModel: "openai:gpt-3.5-turbo", WebhookURL: "https://example.com/hook"}
+	}
+
+	if err := h.validate(&api.Manifest{Bots: []*api.BotManifest{valid()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		m    *api.Manifest
+		// binding is set for the errors of the binding rules of the fields
+		binding bool
+	}{
+		{"no bots", &api.Manifest{}, true},
+		{"null bot", &api.Manifest{Bots: []*api.BotManifest{nil}}, true},
+		{"no name", &api.Manifest{Bots: []*api.BotManifest{func() *api.BotManifest { b := valid(); b.Name = ""; return b }()}}, true},
+		{"invalid webhook url", &api.Manifest{Bots: []*api.BotManifest{func() *api.BotManifest { b := valid(); b.WebhookURL = "hook"; return b }()}}, true},
+		{"unknown chat model", &api.Manifest{Bots: []*api.BotManifest{func() *api.BotManifest { b := valid(); b.ChatModel = "openai:gpt-5"; return b }()}}, false},
+		{"duplicate names", &api.Manifest{Bots: []*api.BotManifest{valid(), valid()}}, false},
+	} {
+		_, err := h.Apply(context.Background(), 1, c.m, true)
+		var (
+			ierr *InvalidError
+			verr validator.ValidationErrors
+		)
+		if !errors.As(err, &ierr) {
+			t.Errorf("%s: err = %v, want an InvalidError", c.name, err)
+			continue
+		}
+		if errors.As(err, &verr) != c.binding {
+			t.Errorf("%s: err = %v, binding error %v", c.name, err, c.binding)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+)
+
+// ExceededError is returned by Handler.Check when a limit is reached.
+type ExceededError struct {
+	Code  api.ErrorCode
+	Scope string
+	Limit int64
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Code {
+	case api.ErrorCodeRateLimitExceeded:
+		return fmt.Sprintf("%s rate limit exceeded: %d requests per minute", e.Scope, e.Limit)
+	default:
+		return fmt.Sprintf("%s monthly token quota exceeded: %d tokens", e.Scope, e.Limit)
+	}
+}
+
+// Usage is the tightest limit that applied to a request, Limit is 0 if
+// nothing was limited.
+type Usage struct {
+	Limit     int64
+	Remaining int64
+}
+
+func (u *Usage) update(limit, remaining int64) {
+	if limit <= 0 {
+		return
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	if u.Limit == 0 || remaining < u.Remaining {
+		u.Limit, u.Remaining = limit, remaining
+	}
+}
+
+type Result struct {
+	Requests Usage
+	Tokens   Usage
+}
+
+type Handler struct {
+	cfg config.QuotaConfig
+	sh  *storage.Handler
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func New(cfg config.QuotaConfig, sh *storage.Handler) *Handler {
+	return &Handler{
+		cfg:     cfg,
+		sh:      sh,
+		windows: map[string]*window{},
+	}
+}
+
+// Check counts a new turn request of the user against the rate limits and
+// verifies the monthly token quotas of the app and the user. A rejected
+// request is not counted against any rate limit.
+func (h *Handler) Check(ctx context.Context, app *models.App, userIdentity string) (*Result, error) {
+	r := &Result{}
+	now := time.Now()
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	appTokens := limit(app.MonthlyTokenQuota, h.cfg.AppMonthlyTokens)
+	if appTokens > 0 {
+		used, err := h.sh.SumTurnTokens(ctx, app.ID, "", monthStart)
+		if err != nil {
+			return r, err
+		}
+		r.Tokens.update(appTokens, appTokens-used)
+		if used >= appTokens {
+			return r, &ExceededError{Code: api.ErrorCodeTokenQuotaExceeded, Scope: "app", Limit: appTokens}
+		}
+	}
+	if userIdentity != "" && h.cfg.UserMonthlyTokens > 0 {
+		used, err := h.sh.SumTurnTokens(ctx, app.ID, userIdentity, monthStart)
+		if err != nil {
+			return r, err
+		}
+		r.Tokens.update(h.cfg.UserMonthlyTokens, h.cfg.UserMonthlyTokens-used)
+		if used >= h.cfg.UserMonthlyTokens {
+			return r, &ExceededError{Code: api.ErrorCodeTokenQuotaExceeded, Scope: "user", Limit: h.cfg.UserMonthlyTokens}
+		}
+	}
+
+	var rates []rate
+	if appRate := limit(app.RequestsPerMinute, h.cfg.AppRequestsPerMinute); appRate > 0 {
+		rates = append(rates, rate{key: fmt.Sprintf("app:%d", app.ID), scope: "app", limit: appRate})
+	}
+	if userIdentity != "" && h.cfg.UserRequestsPerMinute > 0 {
+		rates = append(rates, rate{key: fmt.Sprintf("user:%d:%s", app.ID, userIdentity), scope: "user", limit: h.cfg.UserRequestsPerMinute})
+	}
+	remaining, exceeded := h.take(now, rates...)
+	for i, rt := range rates {
+		r.Requests.update(int64(rt.limit), int64(remaining[i]))
+	}
+	if exceeded >= 0 {
+		rt := rates[exceeded]
+		return r, &ExceededError{Code: api.ErrorCodeRateLimitExceeded, Scope: rt.scope, Limit: int64(rt.limit)}
+	}
+
+	return r, nil
+}
+
+// rate is a limit of requests per minute.
+type rate struct {
+	key   string
+	scope string
+	limit int
+}
+
+// take counts a request in the current one minute windows of the rates if
+// none of them is exceeded, and returns their remaining requests. The index
+// of the first exceeded rate is returned, -1 if the request is counted.
+func (h *Handler) take(now time.Time, rates ...rate) ([]int, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now.Sub(h.lastSweep) > time.Minute {
+		for k, w := range h.windows {
+			if now.Sub(w.start) >= time.Minute {
+				delete(h.windows, k)
+			}
+		}
+		h.lastSweep = now
+	}
+
+	windows := make([]*window, len(rates))
+	remaining := make([]int, len(rates))
+	exceeded := -1
+	for i, rt := range rates {
+		w, ok := h.windows[rt.key]
+		if !ok || now.Sub(w.start) >= time.Minute {
+			w = &window{start: now}
+			h.windows[rt.key] = w
+		}
+		windows[i] = w
+		remaining[i] = rt.limit - w.count
+		if remaining[i] <= 0 {
+			remaining[i] = 0
+			if exceeded < 0 {
+				exceeded = i
+			}
+		}
+	}
+	if exceeded >= 0 {
+		return remaining, exceeded
+	}
+
+	for i, w := range windows {
+		w.count++
+		remaining[i]--
+	}
+	return remaining, -1
+}
+
+// limit returns the app override v if set, otherwise the default value.
+func limit[T int | int64](v, def T) T {
+	switch {
+	case v < 0:
+		return 0
+	case v > 0:
+		return v
+	default:
+		return def
+	}
+}
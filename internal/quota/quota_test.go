@@ -0,0 +1,191 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+	"gorm.io/gorm"
+)
+
+func TestTake(t *testing.T) {
+	h := New(config.QuotaConfig{}, nil)
+	start := time.Now()
+	a := rate{key: "a", scope: "app", limit: 3}
+
+	for i := 0; i < 3; i++ {
+		remaining, exceeded := h.take(start.Add(time.Duration(i)*time.Second), a)
+		if exceeded != -1 || remaining[0] != 2-i {
+			t.Fatalf("take = %v, %d, want [%d], -1", remaining, exceeded, 2-i)
+		}
+	}
+	if _, exceeded := h.take(start.Add(59*time.Second), a); exceeded != 0 {
+		t.Fatal("the limit is not applied in the window")
+	}
+	if remaining, exceeded := h.take(start.Add(59*time.Second), rate{key: "b", limit: 3}); exceeded != -1 || remaining[0] != 2 {
+		t.Fatalf("the windows of other keys are shared: %v, %d", remaining, exceeded)
+	}
+
+	// the window starts with its first request and lasts a minute
+	if remaining, exceeded := h.take(start.Add(time.Minute), a); exceeded != -1 || remaining[0] != 2 {
+		t.Fatalf("take in the next window = %v, %d, want [2], -1", remaining, exceeded)
+	}
+}
+
+func TestTakeAllOrNone(t *testing.T) {
+	h := New(config.QuotaConfig{}, nil)
+	now := time.Now()
+	app := rate{key: "app", scope: "app", limit: 3}
+	user := rate{key: "user", scope: "user", limit: 1}
+
+	if remaining, exceeded := h.take(now, app, user); exceeded != -1 || remaining[0] != 2 || remaining[1] != 0 {
+		t.Fatalf("take = %v, %d, want [2 0], -1", remaining, exceeded)
+	}
+	if remaining, exceeded := h.take(now, app, user); exceeded != 1 || remaining[0] != 2 || remaining[1] != 0 {
+		t.Fatalf("take = %v, %d, want [2 0], 1", remaining, exceeded)
+	}
+	if w := h.windows["app"]; w.count != 1 {
+		t.Errorf("the rejected request is counted by the app, count = %d", w.count)
+	}
+}
+
+func TestTakeSweepsWindows(t *testing.T) {
+	h := New(config.QuotaConfig{}, nil)
+	start := time.Now()
+
+	h.take(start, rate{key: "a", limit: 1})
+	h.take(start.Add(30*time.Second), rate{key: "b", limit: 1})
+	h.take(start.Add(2*time.Minute), rate{key: "c", limit: 1})
+	if _, ok := h.windows["a"]; ok {
+		t.Error("the ended window of a is not swept")
+	}
+	if _, ok := h.windows["b"]; ok {
+		t.Error("the ended window of b is not swept")
+	}
+	if _, ok := h.windows["c"]; !ok {
+		t.Error("the window of c is swept")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	for _, c := range []struct {
+		v, def, want int
+	}{
+		{0, 10, 10},
+		{5, 10, 5},
+		{20, 10, 20},
+		// negative overrides disable the limit
+		{-1, 10, 0},
+		{0, 0, 0},
+	} {
+		if got := limit(c.v, c.def); got != c.want {
+			t.Errorf("limit(%d, %d) = %d, want %d", c.v, c.def, got, c.want)
+		}
+	}
+}
+
+func TestUsageUpdate(t *testing.T) {
+	var u Usage
+	u.update(0, 5)
+	if u.Limit != 0 {
+		t.Fatalf("usage = %+v, want no limit", u)
+	}
+	u.update(100, 50)
+	u.update(10, 20)
+	if u.Limit != 10 || u.Remaining != 20 {
+		t.Fatalf("usage = %+v, want the tightest limit", u)
+	}
+	u.update(1000, 10)
+	if u.Limit != 1000 || u.Remaining != 10 {
+		t.Fatalf("usage = %+v, want the limit with the least remaining", u)
+	}
+	u.update(5, -3)
+	if u.Limit != 5 || u.Remaining != 0 {
+		t.Fatalf("usage = %+v, want remaining 0", u)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	sh, err := storage.Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &models.App{Model: gorm.Model{ID: 1}, RequestsPerMinute: 3}
+	conv := &models.Conv{ID: uuid.New(), AppID: app.ID, BotID: 1, UserIdentity: "alice"}
+	if err := sh.CreateConv(ctx, conv); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if err := sh.CreateTurns(ctx, []*models.Turn{
+		{AppID: app.ID, ConvID: conv.ID, TotalTokens: 60},
+		{AppID: app.ID, ConvID: uuid.New(), TotalTokens: 30},
+		// last month
+		{Model: gorm.Model{CreatedAt: monthStart.Add(-time.Second)}, AppID: app.ID, ConvID: conv.ID, TotalTokens: 1000},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(config.QuotaConfig{
+		AppRequestsPerMinute:  100,
+		UserRequestsPerMinute: 2,
+		AppMonthlyTokens:      100,
+		UserMonthlyTokens:     80,
+	}, sh)
+
+	r, err := h.Check(ctx, app, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Requests.Limit != 2 || r.Requests.Remaining != 1 {
+		t.Errorf("requests = %+v, want the user limit with 1 remaining", r.Requests)
+	}
+	if r.Tokens.Limit != 100 || r.Tokens.Remaining != 10 {
+		t.Errorf("tokens = %+v, want the app quota with 10 remaining", r.Tokens)
+	}
+
+	var e *ExceededError
+	if _, err := h.Check(ctx, app, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Check(ctx, app, "alice"); !errors.As(err, &e) || e.Code != api.ErrorCodeRateLimitExceeded || e.Scope != "user" {
+		t.Fatalf("err = %v, want the user rate limit exceeded", err)
+	}
+	// the rejected request of alice is not counted by the app
+	r, err = h.Check(ctx, app, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Requests.Limit != 3 || r.Requests.Remaining != 0 {
+		t.Errorf("requests = %+v, want the app limit with none remaining", r.Requests)
+	}
+	if _, err := h.Check(ctx, app, "bob"); !errors.As(err, &e) || e.Code != api.ErrorCodeRateLimitExceeded || e.Scope != "app" {
+		t.Fatalf("err = %v, want the app rate limit exceeded", err)
+	}
+
+	h = New(config.QuotaConfig{AppMonthlyTokens: 100, UserMonthlyTokens: 50}, sh)
+	if _, err := h.Check(ctx, app, "alice"); !errors.As(err, &e) || e.Code != api.ErrorCodeTokenQuotaExceeded || e.Scope != "user" {
+		t.Fatalf("err = %v, want the user token quota exceeded", err)
+	}
+	if _, err := h.Check(ctx, app, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if w := h.windows["app:1"]; w == nil || w.count != 1 {
+		t.Errorf("the app rate counts %+v, want only the accepted request", w)
+	}
+	app.MonthlyTokenQuota = 90
+	if _, err := h.Check(ctx, app, "bob"); !errors.As(err, &e) || e.Code != api.ErrorCodeTokenQuotaExceeded || e.Scope != "app" || e.Limit != 90 {
+		t.Fatalf("err = %v, want the app token quota exceeded", err)
+	}
+}
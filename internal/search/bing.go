@@ -0,0 +1,69 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pandodao/botastic/config"
+)
+
+// bing uses the web search API of bing.
+type bing struct {
+	baseURL string
+	apiKey  string
+}
+
+func newBing(cfg config.SearchProviderConfig) *bing {
+	return &bing{
+		baseURL: baseURL(cfg, "https://api.bing.microsoft.com"),
+		apiKey:  cfg.APIKey,
+	}
+}
+
+type bingResponse struct {
+	WebPages struct {
+		Value []struct {
+			Name    string `json:"name"`
+			URL     string `json:"url"`
+			Snippet string `json:"snippet"`
+		} `json:"value"`
+	} `json:"webPages"`
+}
+
+func (p *bing) Search(ctx context.Context, q string, opts Options) ([]*Item, error) {
+	params := url.Values{
+		"q":     {q},
+		"count": {strconv.Itoa(opts.Count)},
+	}
+	switch opts.SafeSearch {
+	case SafeSearchOff:
+		params.Set("safeSearch", "Off")
+	case SafeSearchModerate:
+		params.Set("safeSearch", "Moderate")
+	case SafeSearchStrict:
+		params.Set("safeSearch", "Strict")
+	}
+	if opts.Region != "" {
+		params.Set("mkt", opts.Region)
+	}
+
+	var resp bingResponse
+	header := http.Header{
+		"Ocp-Apim-Subscription-Key": {p.apiKey},
+	}
+	if err := getJSON(ctx, p.baseURL+"/v7.0/search?"+params.Encode(), header, &resp); err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(resp.WebPages.Value))
+	for _, r := range resp.WebPages.Value {
+		items = append(items, &Item{
+			Title:   r.Name,
+			Snippet: r.Snippet,
+			URL:     r.URL,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/pkg/htmltext"
+)
+
+// brave uses the web search API of brave.
+type brave struct {
+	baseURL string
+	apiKey  string
+}
+
+func newBrave(cfg config.SearchProviderConfig) *brave {
+	return &brave{
+		baseURL: baseURL(cfg, "https://api.search.brave.com"),
+		apiKey:  cfg.APIKey,
+	}
+}
+
+type braveResponse struct {
+	Web struct {
+		Results []struct {
+			Title       string `json:"title"`
+			URL         string `json:"url"`
+			Description string `json:"description"`
+		} `json:"results"`
+	} `json:"web"`
+}
+
+func (p *brave) Search(ctx context.Context, q string, opts Options) ([]*Item, error) {
+	params := url.Values{
+		"q":     {q},
+		"count": {strconv.Itoa(opts.Count)},
+	}
+	if opts.SafeSearch != "" {
+		params.Set("safesearch", string(opts.SafeSearch))
+	}
+	if opts.Region != "" {
+		params.Set("country", opts.Region)
+	}
+
+	var resp braveResponse
+	header := http.Header{
+		"Accept":               {"application/json"},
+		"X-Subscription-Token": {p.apiKey},
+	}
+	if err := getJSON(ctx, p.baseURL+"/res/v1/web/search?"+params.Encode(), header, &resp); err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(resp.Web.Results))
+	for _, r := range resp.Web.Results {
+		// the descriptions highlight the query with strong tags
+		snippet, err := htmltext.Text(strings.NewReader(r.Description), "")
+		if err != nil {
+			snippet = r.Description
+		}
+		items = append(items, &Item{
+			Title:   r.Title,
+			Snippet: snippet,
+			URL:     r.URL,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pandodao/botastic/config"
+)
+
+// duckDuckGo scrapes the html version of duckduckgo, which needs no key.
+type duckDuckGo struct {
+	baseURL string
+}
+
+func newDuckDuckGo(cfg config.SearchProviderConfig) *duckDuckGo {
+	return &duckDuckGo{
+		baseURL: baseURL(cfg, "https://html.duckduckgo.com"),
+	}
+}
+
+func (p *duckDuckGo) Search(ctx context.Context, q string, opts Options) ([]*Item, error) {
+	params := url.Values{"q": {q}}
+	switch opts.SafeSearch {
+	case SafeSearchOff:
+		params.Set("kp", "-2")
+	case SafeSearchStrict:
+		params.Set("kp", "1")
+	}
+	if opts.Region != "" {
+		params.Set("kl", opts.Region)
+	}
+
+	data, err := get(ctx, p.baseURL+"/html/?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*Item
+	doc.Find("div.result").Not(".result--ad").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		a := s.Find("a.result__a")
+		items = append(items, &Item{
+			Title:   strings.TrimSpace(a.Text()),
+			Snippet: strings.TrimSpace(s.Find(".result__snippet").Text()),
+			URL:     resultURL(a.AttrOr("href", "")),
+		})
+		return len(items) < opts.Count
+	})
+	return items, nil
+}
+
+// resultURL returns the target of the redirect links of the results.
+func resultURL(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	if target := u.Query().Get("uddg"); target != "" {
+		return target
+	}
+	if u.Scheme == "" && strings.HasPrefix(href, "//") {
+		return "https:" + href
+	}
+	return href
+}
@@ -0,0 +1,243 @@
+// Package search searches the web with the providers of the config.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/pkg/htmltext"
+)
+
+const (
+	// DefaultProvider is the name of the duckduckgo provider added if the
+	// config has no provider of that name.
+	DefaultProvider = "duckduckgo"
+
+	defaultMaxConcurrency = 10
+	maxBodySize           = 4 << 20
+	userAgent             = "Mozilla/5.0 (X11; Linux x86_64; rv:60.0) Gecko/20100101 Firefox/60.0"
+)
+
+type Item struct {
+	Index   int
+	Title   string
+	Snippet string
+	URL     string
+	// Content is the text of the page, set by FetchPages.
+	Content string
+}
+
+type SafeSearch string
+
+const (
+	SafeSearchOff      SafeSearch = "off"
+	SafeSearchModerate SafeSearch = "moderate"
+	SafeSearchStrict   SafeSearch = "strict"
+)
+
+type Options struct {
+	// Count is the maximum number of results, there are none if it is not
+	// positive.
+	Count      int
+	SafeSearch SafeSearch
+	// Region is passed to the provider as it is, e.g. us-en for duckduckgo,
+	// en-US for bing, us for brave or en for searxng.
+	Region string
+}
+
+// Provider is a web search backend.
+type Provider interface {
+	Search(ctx context.Context, q string, opts Options) ([]*Item, error)
+}
+
+// limited limits the concurrent searches of a provider.
+type limited struct {
+	Provider
+	sem chan struct{}
+}
+
+func (p *limited) Search(ctx context.Context, q string, opts Options) ([]*Item, error) {
+	if opts.Count <= 0 {
+		return nil, nil
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	items, err := p.Provider.Search(ctx, q, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > opts.Count {
+		items = items[:opts.Count]
+	}
+	for i, item := range items {
+		item.Index = i + 1
+	}
+	return items, nil
+}
+
+type Handler struct {
+	providers map[string]Provider
+}
+
+func New(cfg config.SearchConfig) *Handler {
+	h := &Handler{
+		providers: make(map[string]Provider, len(cfg.Providers)+1),
+	}
+
+	providers := cfg.Providers
+	if _, ok := providers[DefaultProvider]; !ok {
+		providers = make(map[string]config.SearchProviderConfig, len(cfg.Providers)+1)
+		for name, p := range cfg.Providers {
+			providers[name] = p
+		}
+		providers[DefaultProvider] = config.SearchProviderConfig{Type: config.SearchProviderDuckDuckGo}
+	}
+
+	for name, p := range providers {
+		var provider Provider
+		switch p.Type {
+		case config.SearchProviderDuckDuckGo:
+			provider = newDuckDuckGo(p)
+		case config.SearchProviderSearxNG:
+			provider = newSearxNG(p)
+		case config.SearchProviderBrave:
+			provider = newBrave(p)
+		case config.SearchProviderBing:
+			provider = newBing(p)
+		}
+
+		n := p.MaxConcurrency
+		if n == 0 {
+			n = defaultMaxConcurrency
+		}
+		h.providers[name] = &limited{
+			Provider: provider,
+			sem:      make(chan struct{}, n),
+		}
+	}
+	return h
+}
+
+// Providers returns the names of the providers, sorted.
+func (h *Handler) Providers() []string {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetProvider returns the provider of the given name.
+func (h *Handler) GetProvider(name string) (Provider, error) {
+	p, ok := h.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("search provider %s not found", name)
+	}
+	return p, nil
+}
+
+// FetchPages sets the content of the items to the text of their pages, cut
+// to maxLength characters. The pages failing to load keep an empty content.
+func FetchPages(ctx context.Context, items []*Item, maxLength int) {
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go func(item *Item) {
+			defer wg.Done()
+
+			text, err := fetchPage(ctx, item.URL)
+			if err != nil {
+				return
+			}
+			if r := []rune(text); len(r) > maxLength {
+				text = strings.TrimSpace(string(r[:maxLength]))
+			}
+			item.Content = text
+		}(item)
+	}
+	wg.Wait()
+}
+
+func fetchPage(ctx context.Context, u string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("failed to fetch page: %s, status code: %d", u, resp.StatusCode)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		return string(data), err
+	}
+	return htmltext.Text(io.LimitReader(resp.Body, maxBodySize), "")
+}
+
+// get sends a GET request and returns the response body, failing on non 2xx
+// status codes.
+func get(ctx context.Context, u string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("search failed: %s, status code: %d", req.URL.Redacted(), resp.StatusCode)
+	}
+	return data, nil
+}
+
+func getJSON(ctx context.Context, u string, header http.Header, v any) error {
+	data, err := get(ctx, u, header)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// baseURL returns the base url of the config, or the url of the public
+// service.
+func baseURL(cfg config.SearchProviderConfig, public string) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return public
+}
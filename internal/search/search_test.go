@@ -0,0 +1,287 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pandodao/botastic/config"
+)
+
+const testQuery = `go & "c++" 100%`
+
+const ddgFixture = `<html><body>
+<div class="result results_links result--ad"><h2><a class="result__a" href="https://ads.example.com">Ad</a></h2><a class="result__snippet">Buy now</a></div>
+<div class="result results_links"><h2><a class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fgo.dev%2F&amp;rut=abc">The Go Programming Language</a></h2><a class="result__snippet">Go is an <b>open source</b> language</a></div>
+<div class="result results_links"><h2><a class="result__a" href="https://example.com/cpp">C++</a></h2><a class="result__snippet">C++ reference</a></div>
+<div class="result results_links"><h2><a class="result__a" href="https://example.com/third">Third</a></h2><a class="result__snippet">third</a></div>
+</body></html>`
+
+const searxNGFixture = `{"results": [
+	{"title": "The Go Programming Language", "url": "https://go.dev/", "content": "Go is an open source language"},
+	{"title": "C++", "url": "https://example.com/cpp", "content": "C++ reference"},
+	{"title": "Third", "url": "https://example.com/third", "content": "third"}
+]}`
+
+const braveFixture = `{"web": {"results": [
+	{"title": "The Go Programming Language", "url": "https://go.dev/", "description": "Go is an <strong>open source</strong> language"},
+	{"title": "C++", "url": "https://example.com/cpp", "description": "C++ reference"},
+	{"title": "Third", "url": "https://example.com/third", "description": "third"}
+]}}`
+
+const bingFixture = `{"webPages": {"value": [
+	{"name": "The Go Programming Language", "url": "https://go.dev/", "snippet": "Go is an open source language"},
+	{"name": "C++", "url": "https://example.com/cpp", "snippet": "C++ reference"},
+	{"name": "Third", "url": "https://example.com/third", "snippet": "third"}
+]}}`
+
+func TestProviders(t *testing.T) {
+	want := []*Item{
+		{Index: 1, Title: "The Go Programming Language", Snippet: "Go is an open source language", URL: "https://go.dev/"},
+		{Index: 2, Title: "C++", Snippet: "C++ reference", URL: "https://example.com/cpp"},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.SearchProviderConfig
+		opts    Options
+		path    string
+		fixture string
+		params  url.Values
+		absent  []string
+		header  http.Header
+	}{
+		{
+			name:    "duckduckgo",
+			cfg:     config.SearchProviderConfig{Type: config.SearchProviderDuckDuckGo},
+			opts:    Options{Count: 2, SafeSearch: SafeSearchStrict, Region: "us-en"},
+			path:    "/html/",
+			fixture: ddgFixture,
+			params:  url.Values{"q": {testQuery}, "kp": {"1"}, "kl": {"us-en"}},
+		},
+		{
+			name:    "duckduckgo safe search off",
+			cfg:     config.SearchProviderConfig{Type: config.SearchProviderDuckDuckGo},
+			opts:    Options{Count: 2, SafeSearch: SafeSearchOff},
+			path:    "/html/",
+			fixture: ddgFixture,
+			params:  url.Values{"q": {testQuery}, "kp": {"-2"}},
+			absent:  []string{"kl"},
+		},
+		{
+			name:    "duckduckgo moderate is the default",
+			cfg:     config.SearchProviderConfig{Type: config.SearchProviderDuckDuckGo},
+			opts:    Options{Count: 2, SafeSearch: SafeSearchModerate},
+			path:    "/html/",
+			fixture: ddgFixture,
+			params:  url.Values{"q": {testQuery}},
+			absent:  []string{"kp", "kl"},
+		},
+		{
+			name:    "searxng",
+			cfg:     config.SearchProviderConfig{Type: config.SearchProviderSearxNG},
+			opts:    Options{Count: 2, SafeSearch: SafeSearchOff, Region: "en"},
+			path:    "/search",
+			fixture: searxNGFixture,
+			params:  url.Values{"q": {testQuery}, "format": {"json"}, "safesearch": {"0"}, "language": {"en"}},
+		},
+		{
+			name:    "searxng strict",
+			cfg:     config.SearchProviderConfig{Type: config.SearchProviderSearxNG},
+			opts:    Options{Count: 2, SafeSearch: SafeSearchStrict},
+			path:    "/search",
+			fixture: searxNGFixture,
+			params:  url.Values{"q": {testQuery}, "format": {"json"}, "safesearch": {"2"}},
+			absent:  []string{"language"},
+		},
+		{
+			name:    "brave",
+			cfg:     config.SearchProviderConfig{Type: config.SearchProviderBrave, APIKey: "brave-key"},
+			opts:    Options{Count: 2, SafeSearch: SafeSearchStrict, Region: "us"},
+			path:    "/res/v1/web/search",
+			fixture: braveFixture,
+			params:  url.Values{"q": {testQuery}, "count": {"2"}, "safesearch": {"strict"}, "country": {"us"}},
+			header:  http.Header{"X-Subscription-Token": {"brave-key"}, "Accept": {"application/json"}},
+		},
+		{
+			name:    "bing",
+			cfg:     config.SearchProviderConfig{Type: config.SearchProviderBing, APIKey: "bing-key"},
+			opts:    Options{Count: 2, SafeSearch: SafeSearchModerate, Region: "en-US"},
+			path:    "/v7.0/search",
+			fixture: bingFixture,
+			params:  url.Values{"q": {testQuery}, "count": {"2"}, "safeSearch": {"Moderate"}, "mkt": {"en-US"}},
+			header:  http.Header{"Ocp-Apim-Subscription-Key": {"bing-key"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("path = %s, want %s", r.URL.Path, tt.path)
+				}
+				if strings.Contains(r.URL.RawQuery, `"`) || strings.Contains(r.URL.RawQuery, " ") {
+					t.Errorf("query is not escaped: %s", r.URL.RawQuery)
+				}
+				q := r.URL.Query()
+				for k, v := range tt.params {
+					if !reflect.DeepEqual(q[k], v) {
+						t.Errorf("param %s = %q, want %q", k, q[k], v)
+					}
+				}
+				for _, k := range tt.absent {
+					if q.Has(k) {
+						t.Errorf("param %s = %q, want none", k, q.Get(k))
+					}
+				}
+				for k := range tt.header {
+					if got := r.Header.Get(k); got != tt.header.Get(k) {
+						t.Errorf("header %s = %q, want %q", k, got, tt.header.Get(k))
+					}
+				}
+				w.Write([]byte(tt.fixture))
+			}))
+			defer srv.Close()
+
+			cfg := tt.cfg
+			cfg.BaseURL = srv.URL + "/"
+			h := New(config.SearchConfig{Providers: map[string]config.SearchProviderConfig{"p": cfg}})
+			p, err := h.GetProvider("p")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			items, err := p.Search(context.Background(), testQuery, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(items, want) {
+				t.Errorf("items = %s, want %s", itemsString(items), itemsString(want))
+			}
+		})
+	}
+}
+
+func TestProviderErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	types := []config.SearchProviderType{
+		config.SearchProviderDuckDuckGo,
+		config.SearchProviderSearxNG,
+		config.SearchProviderBrave,
+		config.SearchProviderBing,
+	}
+	for _, typ := range types {
+		t.Run(string(typ), func(t *testing.T) {
+			h := New(config.SearchConfig{Providers: map[string]config.SearchProviderConfig{
+				"p": {Type: typ, BaseURL: srv.URL, APIKey: "secret"},
+			}})
+			p, _ := h.GetProvider("p")
+			_, err := p.Search(context.Background(), "q", Options{Count: 3})
+			if err == nil {
+				t.Fatal("want error on non 2xx status")
+			}
+			if !strings.Contains(err.Error(), "429") {
+				t.Errorf("error %q does not mention the status code", err)
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(searxNGFixture))
+	}))
+	defer srv.Close()
+
+	h := New(config.SearchConfig{Providers: map[string]config.SearchProviderConfig{
+		"p": {Type: config.SearchProviderSearxNG, BaseURL: srv.URL},
+	}})
+	p, _ := h.GetProvider("p")
+
+	for _, tt := range []struct {
+		count int
+		want  int
+	}{
+		{count: -1, want: 0},
+		{count: 0, want: 0},
+		{count: 1, want: 1},
+		{count: 10, want: 3},
+	} {
+		items, err := p.Search(context.Background(), "q", Options{Count: tt.count})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != tt.want {
+			t.Errorf("count %d: got %d items, want %d", tt.count, len(items), tt.want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("provider called %d times, want 2", calls)
+	}
+}
+
+func TestDefaultProvider(t *testing.T) {
+	h := New(config.SearchConfig{Providers: map[string]config.SearchProviderConfig{
+		"searx": {Type: config.SearchProviderSearxNG, BaseURL: "http://localhost"},
+	}})
+	if got, want := h.Providers(), []string{DefaultProvider, "searx"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("providers = %v, want %v", got, want)
+	}
+	if _, err := h.GetProvider("bing"); err == nil {
+		t.Error("want error for unknown provider")
+	}
+}
+
+func TestFetchPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>t</title></head><body><script>var x;</script><p>Hello   wörld,</p><p>bye</p></body></html>`))
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("plain text page"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	items := []*Item{
+		{URL: srv.URL + "/html"},
+		{URL: srv.URL + "/text"},
+		{URL: srv.URL + "/missing"},
+	}
+	FetchPages(context.Background(), items, 11)
+
+	want := []string{"Hello wörld", "plain text", ""}
+	for i, item := range items {
+		if item.Content != want[i] {
+			t.Errorf("content of %s = %q, want %q", item.URL, item.Content, want[i])
+		}
+	}
+
+	FetchPages(context.Background(), items[:1], 100)
+	if want := "Hello wörld,\nbye"; items[0].Content != want {
+		t.Errorf("content = %q, want %q", items[0].Content, want)
+	}
+}
+
+func itemsString(items []*Item) string {
+	var b strings.Builder
+	for _, item := range items {
+		b.WriteString("\n")
+		b.WriteString(strings.Join([]string{item.Title, item.Snippet, item.URL}, " | "))
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pandodao/botastic/config"
+)
+
+// searxNG uses the JSON format of a searxng instance, which must enable it in
+// its search.formats setting.
+type searxNG struct {
+	baseURL string
+}
+
+func newSearxNG(cfg config.SearchProviderConfig) *searxNG {
+	return &searxNG{
+		baseURL: baseURL(cfg, ""),
+	}
+}
+
+type searxNGResponse struct {
+	Results []struct {
+		Title   string `json:"title"`
+		URL     string `json:"url"`
+		Content string `json:"content"`
+	} `json:"results"`
+}
+
+func (p *searxNG) Search(ctx context.Context, q string, opts Options) ([]*Item, error) {
+	params := url.Values{
+		"q":      {q},
+		"format": {"json"},
+	}
+	switch opts.SafeSearch {
+	case SafeSearchOff:
+		params.Set("safesearch", "0")
+	case SafeSearchModerate:
+		params.Set("safesearch", "1")
+	case SafeSearchStrict:
+		params.Set("safesearch", "2")
+	}
+	if opts.Region != "" {
+		params.Set("language", opts.Region)
+	}
+
+	var resp searxNGResponse
+	if err := getJSON(ctx, p.baseURL+"/search?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		items = append(items, &Item{
+			Title:   r.Title,
+			Snippet: r.Content,
+			URL:     r.URL,
+		})
+	}
+	return items, nil
+}
@@ -38,7 +38,12 @@ func (e *IndexNotFoundError) Error() string {
 	return fmt.Sprintf("index with id %d not found", e.ID)
 }
 
-func (h *IndexHandler) SearchIndexes(ctx context.Context, embeddingModel string, keyword string, groupKey string, limit int) ([]*api.Index, error) {
+// vectorGroupKey scopes a group key to an app in the vector storage.
+func vectorGroupKey(appID uint, groupKey string) string {
+	return fmt.Sprintf("%d:%s", appID, groupKey)
+}
+
+func (h *IndexHandler) SearchIndexes(ctx context.Context, appID uint, embeddingModel string, keyword string, groupKey string, limit int) ([]*api.Index, error) {
 	m, err := h.llmsh.GetEmbeddingModel(embeddingModel)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get embedding model %s: %w", embeddingModel, err)
@@ -55,32 +60,25 @@ func (h *IndexHandler) SearchIndexes(ctx context.Context, embeddingModel string,
 
 	result := make([]*api.Index, 0, limit)
 	if h.vs == nil {
-		indexes, err := h.sh.GetIndexesByGroupKey(ctx, groupKey)
+		indexes, err := h.sh.GetIndexesByGroupKey(ctx, appID, groupKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get indexes by group key: %w", err)
 		}
-		scoreMap := make(map[float64]*models.Index, len(indexes))
-		scores := make([]float64, 0, len(indexes))
 		for _, index := range indexes {
-			score := utils.CosineSimilarity(embeddingData, index.Vector)
-			scores = append(scores, score)
-			index.Score = score
-			scoreMap[score] = index
+			index.Score = utils.CosineSimilarity(embeddingData, index.Vector)
 		}
-		sort.Slice(scores, func(i, j int) bool {
-			return scores[i] > scores[j]
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return indexes[i].Score > indexes[j].Score
 		})
 
-		var result []*api.Index
-		if limit > len(scores) {
-			limit = len(scores)
+		if limit > len(indexes) {
+			limit = len(indexes)
 		}
-		for _, score := range scores[:limit] {
-			index := scoreMap[score]
+		for _, index := range indexes[:limit] {
 			result = append(result, index.API())
 		}
 	} else {
-		vs, err := h.vs.Search(ctx, groupKey, embeddingData, limit)
+		vs, err := h.vs.Search(ctx, vectorGroupKey(appID, groupKey), embeddingData, limit)
 		if err != nil {
 			return nil, fmt.Errorf("failed to search vector: %w", err)
 		}
@@ -97,7 +95,10 @@ func (h *IndexHandler) SearchIndexes(ctx context.Context, embeddingModel string,
 			indexesMap[index.ID] = index
 		}
 		for _, v := range vs {
-			index := indexesMap[v.IndexID]
+			index, ok := indexesMap[v.IndexID]
+			if !ok {
+				continue
+			}
 			index.Score = v.Score
 			result = append(result, index.API())
 		}
@@ -106,7 +107,7 @@ func (h *IndexHandler) SearchIndexes(ctx context.Context, embeddingModel string,
 	return result, nil
 }
 
-func (h *IndexHandler) UpsertIndexes(ctx context.Context, req api.UpsertIndexesRequest) ([]*api.Index, error) {
+func (h *IndexHandler) UpsertIndexes(ctx context.Context, appID uint, req api.UpsertIndexesRequest) ([]*api.Index, error) {
 	m, err := h.llmsh.GetEmbeddingModel(req.EmbeddingModel)
 	if err != nil {
 		return nil, err
@@ -125,7 +126,7 @@ func (h *IndexHandler) UpsertIndexes(ctx context.Context, req api.UpsertIndexesR
 			if err != nil {
 				return nil, fmt.Errorf("failed to get index %d: %w", item.ID, err)
 			}
-			if index == nil {
+			if index == nil || index.AppID != appID {
 				return nil, &IndexNotFoundError{ID: item.ID}
 			}
 		}
@@ -134,6 +135,7 @@ func (h *IndexHandler) UpsertIndexes(ctx context.Context, req api.UpsertIndexesR
 		if index == nil {
 			createEmbedding = true
 			index = &models.Index{
+				AppID:      appID,
 				GroupKey:   req.GroupKey,
 				Data:       item.Data,
 				Properties: models.IndexProperties(item.Properties),
@@ -182,7 +184,7 @@ func (h *IndexHandler) UpsertIndexes(ctx context.Context, req api.UpsertIndexesR
 	}
 
 	if h.vs != nil && len(vs) > 0 {
-		if err := h.vs.Upsert(ctx, req.GroupKey, vs); err != nil {
+		if err := h.vs.Upsert(ctx, vectorGroupKey(appID, req.GroupKey), vs); err != nil {
 			if len(newIndexesIDs) > 0 {
 				if err := h.sh.DeleteIndexes(ctx, newIndexesIDs); err != nil {
 					h.logger.With(zap.Error(err), zap.Any("ids", newIndexesIDs)).Error("rollback error: failed to delete indexes")
@@ -2,14 +2,25 @@ package vector
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/storage"
 )
 
-func Init(ctx context.Context, cfg config.VectorStorageConfig) (Storage, error) {
+// Init initializes the configured vector storage, the indexes of sh tell the
+// apps of the vectors stored before the indexes belonged to apps.
+func Init(ctx context.Context, cfg config.VectorStorageConfig, sh *storage.Handler) (Storage, error) {
 	switch cfg.Driver {
 	case config.VectorStorageRedis:
-		return initRedisStore(ctx, cfg.Redis)
+		s, err := initRedisStore(ctx, cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.migrateLegacyKeys(ctx, sh); err != nil {
+			return nil, fmt.Errorf("failed to migrate the vector keys: %w", err)
+		}
+		return s, nil
 	default:
 		return nil, nil
 	}
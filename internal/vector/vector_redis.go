@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pandodao/botastic/config"
 	"github.com/pandodao/botastic/internal/utils"
+	"github.com/pandodao/botastic/storage"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -100,6 +103,81 @@ func (s *redisStore) Search(ctx context.Context, groupKey string, vd []float32,
 	return items, nil
 }
 
+// legacyKeysMigratedSuffix makes the key marking that migrateLegacyKeys ran,
+// which is out of the keys of the groups.
+const legacyKeysMigratedSuffix = "#legacy_keys_migrated"
+
+// migrateLegacyKeys moves the vectors stored before the indexes belonged to
+// apps, whose keys have no app id, to the keys of the apps the database
+// migration moved their indexes to. It only runs once.
+func (s *redisStore) migrateLegacyKeys(ctx context.Context, sh *storage.Handler) error {
+	marker := s.cfg.KeyPrefix + legacyKeysMigratedSuffix
+	if n, err := s.client.Exists(ctx, marker).Result(); err != nil || n > 0 {
+		return err
+	}
+
+	prefix := s.cfg.KeyPrefix + ":"
+	var keys []string
+	iter := s.client.Scan(ctx, 0, prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		// the index of any vector of the key tells its app and group, the
+		// keys of apps have the app id before the group key
+		fields := s.client.HScan(ctx, key, 0, "*", 10).Iterator()
+		if !fields.Next(ctx) {
+			if err := fields.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		id, err := strconv.ParseUint(fields.Val(), 10, 64)
+		if err != nil {
+			continue
+		}
+		index, err := sh.GetIndex(ctx, uint(id))
+		if err != nil {
+			return err
+		}
+		groupKey := strings.TrimPrefix(key, prefix)
+		if index == nil || index.GroupKey != groupKey {
+			continue
+		}
+
+		if err := s.moveKey(ctx, key, s.getkey(vectorGroupKey(index.AppID, groupKey))); err != nil {
+			return err
+		}
+	}
+
+	return s.client.Set(ctx, marker, time.Now().Unix(), 0).Err()
+}
+
+// moveKey renames the hash key to newKey, or merges it into newKey if that
+// already exists.
+func (s *redisStore) moveKey(ctx context.Context, key, newKey string) error {
+	renamed, err := s.client.RenameNX(ctx, key, newKey).Result()
+	if err != nil || renamed {
+		return err
+	}
+
+	values, err := s.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	pipeline := s.client.TxPipeline()
+	if len(values) > 0 {
+		pipeline.HSet(ctx, newKey, values)
+	}
+	pipeline.Del(ctx, key)
+	_, err = pipeline.Exec(ctx)
+	return err
+}
+
 func (s *redisStore) getkey(groupKey string) string {
 	return s.cfg.KeyPrefix + ":" + groupKey
 }
@@ -0,0 +1,282 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	EventTurnProcessed = "turn.processed"
+
+	HeaderEvent     = "X-BOTASTIC-EVENT"
+	HeaderTimestamp = "X-BOTASTIC-TIMESTAMP"
+	HeaderSignature = "X-BOTASTIC-SIGNATURE"
+
+	batchSize    = 50
+	pollInterval = 5 * time.Second
+	minBackoff   = 10 * time.Second
+	maxBackoff   = time.Hour
+)
+
+// Sign returns the signature of a webhook request, which is the hex encoded
+// HMAC-SHA256 of "timestamp.body" keyed by the webhook secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers the webhook calls stored in the outbox, retrying
+// failed deliveries with exponential backoff. The urls are delivered to in
+// parallel, each by its own worker, so that a slow or failing url does not
+// hold the others back.
+type Dispatcher struct {
+	cfg    config.WebhookConfig
+	sh     *storage.Handler
+	logger *zap.Logger
+	client *http.Client
+	notify chan struct{}
+
+	mu   sync.Mutex
+	busy map[string]bool
+	wg   sync.WaitGroup
+}
+
+func New(cfg config.WebhookConfig, sh *storage.Handler, logger *zap.Logger) *Dispatcher {
+	return &Dispatcher{
+		cfg:    cfg,
+		sh:     sh,
+		logger: logger.Named("webhook"),
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		notify: make(chan struct{}, 1),
+		busy:   make(map[string]bool),
+	}
+}
+
+// TurnProcessedDelivery returns the delivery of the turn to the webhook of
+// its conversation, or of its bot if the conversation has none. It is to be
+// created with the final status of the turn, see Notify.
+func (d *Dispatcher) TurnProcessedDelivery(ctx context.Context, turn *models.Turn) (*models.WebhookDelivery, error) {
+	conv, err := d.sh.GetConv(ctx, turn.ConvID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, nil
+	}
+
+	url, secret := conv.WebhookURL, conv.WebhookSecret
+	if url == "" {
+		bot, err := d.sh.GetBot(ctx, turn.BotID)
+		if err != nil {
+			return nil, err
+		}
+		if bot == nil || bot.WebhookURL == "" {
+			return nil, nil
+		}
+		url, secret = bot.WebhookURL, bot.WebhookSecret
+	}
+
+	// the turn is sent as it is once updated
+	t := *turn
+	t.UpdatedAt = time.Now()
+	payload, err := json.Marshal(t.API())
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookDelivery{
+		AppID:         turn.AppID,
+		TurnID:        turn.ID,
+		Event:         EventTurnProcessed,
+		URL:           url,
+		Secret:        secret,
+		Payload:       string(payload),
+		Status:        models.WebhookDeliveryStatusPending,
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// Notify wakes up the dispatcher to deliver the deliveries created since it
+// last looked for due ones.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	defer d.wg.Wait()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-d.notify:
+		}
+	}
+}
+
+// deliverDue starts a worker for each url with due deliveries, except the
+// urls already being delivered to, up to cfg.WorkerCount workers.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		d.mu.Lock()
+		if len(d.busy) >= d.cfg.WorkerCount {
+			d.mu.Unlock()
+			return
+		}
+		busy := make([]string, 0, len(d.busy))
+		for url := range d.busy {
+			busy = append(busy, url)
+		}
+		d.mu.Unlock()
+
+		ds, err := d.sh.GetDueWebhookDeliveries(ctx, time.Now(), batchSize, busy)
+		if err != nil {
+			d.logger.Error("failed to get due webhook deliveries", zap.Error(err))
+			return
+		}
+
+		var urls []string
+		byURL := make(map[string][]*models.WebhookDelivery)
+		for _, delivery := range ds {
+			if _, ok := byURL[delivery.URL]; !ok {
+				urls = append(urls, delivery.URL)
+			}
+			byURL[delivery.URL] = append(byURL[delivery.URL], delivery)
+		}
+
+		d.mu.Lock()
+		for _, url := range urls {
+			if len(d.busy) >= d.cfg.WorkerCount {
+				break
+			}
+			d.busy[url] = true
+			d.wg.Add(1)
+			go d.work(ctx, url, byURL[url])
+		}
+		d.mu.Unlock()
+
+		if len(ds) < batchSize {
+			return
+		}
+	}
+}
+
+// work delivers the deliveries to url in order. It stops at the first
+// failure, the url is likely down, the next ones are left to the next rounds.
+func (d *Dispatcher) work(ctx context.Context, url string, ds []*models.WebhookDelivery) {
+	defer d.wg.Done()
+
+	delivered := true
+	for _, delivery := range ds {
+		if delivered = d.deliver(ctx, delivery); !delivered {
+			break
+		}
+	}
+
+	d.mu.Lock()
+	delete(d.busy, url)
+	d.mu.Unlock()
+	if delivered {
+		// more deliveries to url may have come due meanwhile
+		d.Notify()
+	}
+}
+
+// deliver sends the delivery and records the attempt, it reports whether the
+// delivery succeeded.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) bool {
+	attempts := delivery.Attempts + 1
+	err := d.post(ctx, delivery)
+	if ctx.Err() != nil {
+		return false
+	}
+
+	m := map[string]any{
+		"attempts": attempts,
+	}
+	switch {
+	case err == nil:
+		m["status"] = int(models.WebhookDeliveryStatusDelivered)
+		m["last_error"] = ""
+	case attempts >= d.cfg.MaxAttempts:
+		m["status"] = int(models.WebhookDeliveryStatusFailed)
+		m["last_error"] = err.Error()
+	default:
+		m["last_error"] = err.Error()
+		m["next_attempt_at"] = time.Now().Add(backoff(attempts))
+	}
+	if err != nil {
+		d.logger.Info("webhook delivery failed", zap.Error(err), zap.Uint("delivery_id", delivery.ID), zap.Int("attempts", attempts))
+	}
+
+	if err := d.sh.UpdateWebhookDelivery(ctx, delivery.ID, m); err != nil {
+		d.logger.Error("failed to update webhook delivery", zap.Error(err), zap.Uint("delivery_id", delivery.ID))
+		return false
+	}
+	return err == nil
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *models.WebhookDelivery) error {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if delivery.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func backoff(attempts int) time.Duration {
+	b := minBackoff
+	for i := 1; i < attempts && b < maxBackoff; i++ {
+		b *= 2
+	}
+	if b > maxBackoff {
+		b = maxBackoff
+	}
+	return b
+}
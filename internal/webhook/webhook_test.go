@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+	"go.uber.org/zap"
+)
+
+func newTestStorage(t *testing.T) *storage.Handler {
+	sh, err := storage.Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sh
+}
+
+// processTurn creates a processed turn of a conversation notifying url, the
+// way the state does.
+func processTurn(t *testing.T, sh *storage.Handler, d *Dispatcher, url string) *models.Turn {
+	ctx := context.Background()
+	conv := &models.Conv{ID: uuid.New(), AppID: 1, BotID: 1, WebhookURL: url, WebhookSecret: "secret"}
+	if err := sh.CreateConv(ctx, conv); err != nil {
+		t.Fatal(err)
+	}
+	turn := &models.Turn{AppID: 1, ConvID: conv.ID, BotID: 1, Request: "hi", Status: api.TurnStatusProcessing}
+	if err := sh.CreateTurn(ctx, turn); err != nil {
+		t.Fatal(err)
+	}
+
+	turn.Response = "hello"
+	turn.Status = api.TurnStatusSuccess
+	delivery, err := d.TurnProcessedDelivery(ctx, turn)
+	if err != nil || delivery == nil {
+		t.Fatalf("delivery = %v, err = %v", delivery, err)
+	}
+	if err := sh.UpdateTurnToSuccess(ctx, turn.ID, turn.Response, 0, 0, 0, nil, delivery); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.ID == 0 {
+		t.Fatal("delivery is not created with the turn")
+	}
+	return turn
+}
+
+func TestDispatcherIsolatesURLs(t *testing.T) {
+	sh := newTestStorage(t)
+	d := New(config.WebhookConfig{MaxAttempts: 3, TimeoutSeconds: 10, WorkerCount: 2}, sh, zap.NewNop())
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer fast.Close()
+
+	processTurn(t, sh, d, slow.URL)
+	turn := processTurn(t, sh, d, fast.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Start(ctx)
+	}()
+	defer func() {
+		close(release)
+		cancel()
+		<-done
+	}()
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fast url waits for the slow one")
+	}
+	body := <-bodies
+
+	if r.Header.Get(HeaderEvent) != EventTurnProcessed {
+		t.Errorf("event = %q", r.Header.Get(HeaderEvent))
+	}
+	if got, want := r.Header.Get(HeaderSignature), Sign("secret", r.Header.Get(HeaderTimestamp), body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	var v api.Turn
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != turn.ID || v.Status != api.TurnStatusSuccess || v.Response != "hello" {
+		t.Errorf("payload = %+v", v)
+	}
+}
+
+func TestGetDueWebhookDeliveriesExceptURLs(t *testing.T) {
+	sh := newTestStorage(t)
+	d := New(config.WebhookConfig{MaxAttempts: 3, TimeoutSeconds: 10, WorkerCount: 2}, sh, zap.NewNop())
+	processTurn(t, sh, d, "http://a")
+	processTurn(t, sh, d, "http://b")
+	processTurn(t, sh, d, "http://a")
+
+	ds, err := sh.GetDueWebhookDeliveries(context.Background(), time.Now(), 10, []string{"http://a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].URL != "http://b" {
+		t.Errorf("deliveries = %+v", ds)
+	}
+}
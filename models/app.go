@@ -0,0 +1,72 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"gorm.io/gorm"
+)
+
+type App struct {
+	gorm.Model
+	AppID      uuid.UUID `gorm:"type:char(36);uniqueIndex"`
+	Name       string    `gorm:"type:varchar(128)"`
+	SecretHash string    `gorm:"type:varchar(64)"`
+
+	// RequestsPerMinute and MonthlyTokenQuota override the configured app
+	// limits when not 0, a negative value means unlimited.
+	RequestsPerMinute int
+	MonthlyTokenQuota int64
+}
+
+// NewApp creates an app with a random app id and secret. The plain secret is
+// only returned here, the app itself keeps its hash.
+func NewApp(name string) (*App, string, error) {
+	app := &App{
+		AppID: uuid.New(),
+		Name:  name,
+	}
+	secret, err := app.ResetSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	return app, secret, nil
+}
+
+// ResetSecret replaces the secret of the app with a random one, which is only
+// returned here.
+func (a *App) ResetSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	secret := hex.EncodeToString(b)
+	a.SecretHash = hashAppSecret(secret)
+	return secret, nil
+}
+
+func (a App) VerifySecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(a.SecretHash), []byte(hashAppSecret(secret))) == 1
+}
+
+func (a App) API() api.App {
+	return api.App{
+		ID:                a.ID,
+		AppID:             a.AppID,
+		Name:              a.Name,
+		RequestsPerMinute: a.RequestsPerMinute,
+		MonthlyTokenQuota: a.MonthlyTokenQuota,
+		CreatedAt:         a.CreatedAt,
+		UpdatedAt:         a.UpdatedAt,
+	}
+}
+
+func hashAppSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
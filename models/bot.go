@@ -11,14 +11,20 @@ import (
 
 type Bot struct {
 	gorm.Model
+	AppID            uint   `gorm:"uniqueIndex:idx_bots_app_id_name"`
 	ChatModel        string `gorm:"type:varchar(128)"`
-	Name             string `gorm:"type:varchar(128);unique"`
+	Name             string `gorm:"type:varchar(128);uniqueIndex:idx_bots_app_id_name"`
 	Prompt           string `gorm:"type:text"`
 	BoundaryPrompt   string `gorm:"type:text"`
 	ContextTurnCount int
 	Temperature      float32
 	TimeoutSeconds   int
 	Middlewares      *MiddlewareConfig `gorm:"type:json"`
+	WebhookURL       string            `gorm:"type:varchar(1024)"`
+	WebhookSecret    string            `gorm:"type:varchar(255)"`
+	// PublishedVersion is the version whose chat settings the bot has, see
+	// BotVersion.
+	PublishedVersion int
 }
 
 func (b Bot) API() api.Bot {
@@ -31,6 +37,8 @@ func (b Bot) API() api.Bot {
 		ContextTurnCount: b.ContextTurnCount,
 		Temperature:      b.Temperature,
 		TimeoutSeconds:   b.TimeoutSeconds,
+		WebhookURL:       b.WebhookURL,
+		PublishedVersion: b.PublishedVersion,
 		CreatedAt:        b.CreatedAt,
 		UpdatedAt:        b.UpdatedAt,
 	}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+	"gorm.io/gorm"
+)
+
+// BotVersion is an immutable snapshot of the chat settings of a bot, the
+// published version is copied to the bot.
+type BotVersion struct {
+	gorm.Model
+	AppID            uint   `gorm:"index"`
+	BotID            uint   `gorm:"uniqueIndex:idx_bot_versions_bot_id_version"`
+	Version          int    `gorm:"uniqueIndex:idx_bot_versions_bot_id_version"`
+	ChatModel        string `gorm:"type:varchar(128)"`
+	Prompt           string `gorm:"type:text"`
+	BoundaryPrompt   string `gorm:"type:text"`
+	ContextTurnCount int
+	Temperature      float32
+	TimeoutSeconds   int
+	Middlewares      *MiddlewareConfig `gorm:"type:json"`
+	// PublishedAt is the last time the version was published.
+	PublishedAt *time.Time
+}
+
+// NewBotVersion snapshots the chat settings of the bot.
+func NewBotVersion(b *Bot) *BotVersion {
+	return &BotVersion{
+		AppID:            b.AppID,
+		BotID:            b.ID,
+		ChatModel:        b.ChatModel,
+		Prompt:           b.Prompt,
+		BoundaryPrompt:   b.BoundaryPrompt,
+		ContextTurnCount: b.ContextTurnCount,
+		Temperature:      b.Temperature,
+		TimeoutSeconds:   b.TimeoutSeconds,
+		Middlewares:      b.Middlewares,
+	}
+}
+
+// Apply sets the chat settings of the version to the bot.
+func (v BotVersion) Apply(b *Bot) {
+	b.ChatModel = v.ChatModel
+	b.Prompt = v.Prompt
+	b.BoundaryPrompt = v.BoundaryPrompt
+	b.ContextTurnCount = v.ContextTurnCount
+	b.Temperature = v.Temperature
+	b.TimeoutSeconds = v.TimeoutSeconds
+	b.Middlewares = v.Middlewares
+}
+
+// Columns are the bot columns updated when the version is published.
+func (v BotVersion) Columns() map[string]any {
+	return map[string]any{
+		"chat_model":         v.ChatModel,
+		"prompt":             v.Prompt,
+		"boundary_prompt":    v.BoundaryPrompt,
+		"context_turn_count": v.ContextTurnCount,
+		"temperature":        v.Temperature,
+		"timeout_seconds":    v.TimeoutSeconds,
+		"middlewares":        v.Middlewares,
+		"published_version":  v.Version,
+	}
+}
+
+func (v BotVersion) API(publishedVersion int) api.BotVersion {
+	r := api.BotVersion{
+		Version:          v.Version,
+		ChatModel:        v.ChatModel,
+		Prompt:           v.Prompt,
+		BoundaryPrompt:   v.BoundaryPrompt,
+		ContextTurnCount: v.ContextTurnCount,
+		Temperature:      v.Temperature,
+		TimeoutSeconds:   v.TimeoutSeconds,
+		Published:        v.Version == publishedVersion,
+		PublishedAt:      v.PublishedAt,
+		CreatedAt:        v.CreatedAt,
+	}
+	if v.Middlewares != nil {
+		m := api.MiddlewareConfig(*v.Middlewares)
+		r.Middlewares = &m
+	}
+	return r
+}
+
+// Diff lists the chat settings changed from v to other.
+func (v BotVersion) Diff(other BotVersion) []*api.BotVersionChange {
+	from, to := v.API(0), other.API(0)
+	var changes []*api.BotVersionChange
+	add := func(field string, a, b any, changed bool) {
+		if changed {
+			changes = append(changes, &api.BotVersionChange{Field: field, From: a, To: b})
+		}
+	}
+	add("chat_model", from.ChatModel, to.ChatModel, from.ChatModel != to.ChatModel)
+	add("prompt", from.Prompt, to.Prompt, from.Prompt != to.Prompt)
+	add("boundary_prompt", from.BoundaryPrompt, to.BoundaryPrompt, from.BoundaryPrompt != to.BoundaryPrompt)
+	add("context_turn_count", from.ContextTurnCount, to.ContextTurnCount, from.ContextTurnCount != to.ContextTurnCount)
+	add("temperature", from.Temperature, to.Temperature, from.Temperature != to.Temperature)
+	add("timeout_seconds", from.TimeoutSeconds, to.TimeoutSeconds, from.TimeoutSeconds != to.TimeoutSeconds)
+	add("middlewares", from.Middlewares, to.Middlewares, !reflect.DeepEqual(from.Middlewares, to.Middlewares))
+	return changes
+}
@@ -10,18 +10,33 @@ import (
 
 type Conv struct {
 	ID           uuid.UUID `gorm:"type:char(36);primaryKey"`
+	AppID        uint      `gorm:"index"`
 	BotID        uint      `gorm:"index"`
 	UserIdentity string    `gorm:"type:varchar(255)"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	// BotVersion pins the version of the bot, 0 follows the published one.
+	BotVersion int
+	// ExperimentID and Variant are the experiment variant the conversation
+	// is assigned to, which pins its BotVersion.
+	ExperimentID uint   `gorm:"index"`
+	Variant      string `gorm:"type:varchar(128)"`
+	// WebhookURL and WebhookSecret override the webhook of the bot.
+	WebhookURL    string `gorm:"type:varchar(1024)"`
+	WebhookSecret string `gorm:"type:varchar(255)"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
 }
 
 func (c Conv) API() api.Conv {
 	return api.Conv{
-		ID:        c.ID,
-		BotID:     c.BotID,
-		CreatedAt: c.CreatedAt,
-		UpdatedAt: c.UpdatedAt,
+		ID:           c.ID,
+		BotID:        c.BotID,
+		UserIdentity: c.UserIdentity,
+		BotVersion:   c.BotVersion,
+		ExperimentID: c.ExperimentID,
+		Variant:      c.Variant,
+		WebhookURL:   c.WebhookURL,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
 	}
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+	"gorm.io/gorm"
+)
+
+// Experiment splits the new conversations of a bot across variants, each
+// answered by a version of the bot.
+type Experiment struct {
+	gorm.Model
+	AppID     uint               `gorm:"index"`
+	BotID     uint               `gorm:"index"`
+	Name      string             `gorm:"type:varchar(128)"`
+	Variants  ExperimentVariants `gorm:"type:json"`
+	StoppedAt *time.Time
+}
+
+func (e Experiment) Running() bool {
+	return e.StoppedAt == nil
+}
+
+func (e Experiment) API() api.Experiment {
+	r := api.Experiment{
+		ID:        e.ID,
+		BotID:     e.BotID,
+		Name:      e.Name,
+		Variants:  []*api.ExperimentVariant(e.Variants),
+		Status:    api.ExperimentStatusRunning,
+		CreatedAt: e.CreatedAt,
+		StoppedAt: e.StoppedAt,
+	}
+	if !e.Running() {
+		r.Status = api.ExperimentStatusStopped
+	}
+	return r
+}
+
+type ExperimentVariants []*api.ExperimentVariant
+
+func (v ExperimentVariants) Value() (driver.Value, error) {
+	return json.Marshal(v)
+}
+
+func (v *ExperimentVariants) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, v)
+}
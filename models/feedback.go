@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"gorm.io/gorm"
+)
+
+// Feedback is the rating of a turn given by its user, a turn has at most one
+// feedback which is replaced when given again.
+type Feedback struct {
+	gorm.Model
+	AppID      uint      `gorm:"index"`
+	BotID      uint      `gorm:"index"`
+	ConvID     uuid.UUID `gorm:"index"`
+	TurnID     uint      `gorm:"uniqueIndex"`
+	Rating     api.FeedbackRating
+	Tags       FeedbackTags `gorm:"type:json"`
+	Correction string       `gorm:"type:text"`
+}
+
+func (f Feedback) API() api.Feedback {
+	tags := []string(f.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return api.Feedback{
+		ID:             f.ID,
+		TurnID:         f.TurnID,
+		ConversationID: f.ConvID,
+		BotID:          f.BotID,
+		Rating:         f.Rating,
+		Tags:           tags,
+		Correction:     f.Correction,
+		CreatedAt:      f.CreatedAt,
+		UpdatedAt:      f.UpdatedAt,
+	}
+}
+
+type FeedbackTags []string
+
+func (t FeedbackTags) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+func (t *FeedbackTags) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, t)
+}
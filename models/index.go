@@ -12,6 +12,7 @@ import (
 
 type Index struct {
 	ID         uint `gorm:"primarykey"`
+	AppID      uint `gorm:"index"`
 	GroupKey   string
 	Data       string
 	Vector     Vector
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pandodao/botastic/api"
@@ -13,32 +16,89 @@ import (
 
 type Turn struct {
 	gorm.Model
-	ConvID            uuid.UUID `gorm:"index"`
-	BotID             uint      `gorm:"index"`
-	Request           string    `gorm:"type:text"`
-	Response          string    `gorm:"type:text"`
+	AppID  uint      `gorm:"index"`
+	ConvID uuid.UUID `gorm:"index"`
+	BotID  uint      `gorm:"index"`
+	// BotVersion is the version of the bot answering the turn, 0 for turns
+	// created before bots had versions.
+	BotVersion        int
+	Request           string `gorm:"type:text"`
+	RewrittenRequest  string `gorm:"type:text"` // the request sent to the chat model, if middlewares rewrote it
+	Response          string `gorm:"type:text"`
 	PromptTokens      int
 	CompletionTokens  int
 	TotalTokens       int
 	Status            api.TurnStatus    `gorm:"index"`
 	MiddlewareResults MiddlewareResults `gorm:"type:json"`
 	Error             *TurnError        `gorm:"type:json"`
+	// ProcessingStartedAt and ProcessedAt are the times the processing of the
+	// turn started and ended, nil for turns created before they were stored.
+	ProcessingStartedAt *time.Time
+	ProcessedAt         *time.Time
+
+	// History is the text of the earlier turns of the conversation sent to
+	// the chat model with the turn, set while the turn is processed.
+	History []string `gorm:"-"`
+	// Redaction is set by the redact middleware while the turn is processed,
+	// it is not persisted.
+	Redaction *Redaction `gorm:"-"`
+}
+
+// Redaction holds the personal data the redact middleware replaced with
+// placeholders in the request of a turn and its history.
+type Redaction struct {
+	// Values maps the placeholders to the values they replace.
+	Values map[string]string
+	// Persist stores the redacted request and response of the turn instead
+	// of the original ones.
+	Persist bool
+}
+
+// Restore replaces the placeholders in s with their values.
+func (r *Redaction) Restore(s string) string {
+	pairs := make([]string, 0, len(r.Values)*2)
+	for placeholder, v := range r.Values {
+		pairs = append(pairs, placeholder, v)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// Redact replaces the values in s with their placeholders, the longer values
+// first.
+func (r *Redaction) Redact(s string) string {
+	placeholders := make([]string, 0, len(r.Values))
+	for placeholder := range r.Values {
+		placeholders = append(placeholders, placeholder)
+	}
+	sort.Slice(placeholders, func(i, j int) bool {
+		return len(r.Values[placeholders[i]]) > len(r.Values[placeholders[j]])
+	})
+
+	pairs := make([]string, 0, len(placeholders)*2)
+	for _, placeholder := range placeholders {
+		pairs = append(pairs, r.Values[placeholder], placeholder)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
 }
 
 func (t Turn) API() api.Turn {
 	r := api.Turn{
-		ID:                t.ID,
-		ConversationID:    t.ConvID,
-		BotID:             t.BotID,
-		Request:           t.Request,
-		Response:          t.Response,
-		PromptTokens:      t.PromptTokens,
-		CompletionTokens:  t.CompletionTokens,
-		TotalTokens:       t.TotalTokens,
-		Status:            t.Status,
-		MiddlewareResults: []*api.MiddlewareResult(t.MiddlewareResults),
-		CreatedAt:         t.CreatedAt,
-		UpdatedAt:         t.UpdatedAt,
+		ID:                  t.ID,
+		ConversationID:      t.ConvID,
+		BotID:               t.BotID,
+		BotVersion:          t.BotVersion,
+		Request:             t.Request,
+		RewrittenRequest:    t.RewrittenRequest,
+		Response:            t.Response,
+		PromptTokens:        t.PromptTokens,
+		CompletionTokens:    t.CompletionTokens,
+		TotalTokens:         t.TotalTokens,
+		Status:              t.Status,
+		MiddlewareResults:   []*api.MiddlewareResult(t.MiddlewareResults),
+		ProcessingStartedAt: t.ProcessingStartedAt,
+		ProcessedAt:         t.ProcessedAt,
+		CreatedAt:           t.CreatedAt,
+		UpdatedAt:           t.UpdatedAt,
 	}
 	if t.Error != nil {
 		v := api.TurnError(*t.Error)
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookDeliveryStatus int
+
+const (
+	WebhookDeliveryStatusPending WebhookDeliveryStatus = iota
+	WebhookDeliveryStatusDelivered
+	WebhookDeliveryStatusFailed
+)
+
+// WebhookDelivery is an outbox entry of a webhook call, it is kept until it
+// is delivered or runs out of attempts.
+type WebhookDelivery struct {
+	gorm.Model
+	AppID         uint                  `gorm:"index"`
+	TurnID        uint                  `gorm:"index"`
+	Event         string                `gorm:"type:varchar(64)"`
+	URL           string                `gorm:"type:varchar(1024)"`
+	Secret        string                `gorm:"type:varchar(255)"`
+	Payload       string                `gorm:"type:text"`
+	Status        WebhookDeliveryStatus `gorm:"index"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string    `gorm:"type:text"`
+}
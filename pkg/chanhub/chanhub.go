@@ -7,12 +7,72 @@ import (
 
 type Hub struct {
 	sync.Mutex
-	m map[any][]chan any
+	m    map[any][]chan any
+	subs map[any]map[chan any]struct{}
 }
 
 func New() *Hub {
 	return &Hub{
-		m: make(map[any][]chan any),
+		m:    make(map[any][]chan any),
+		subs: make(map[any]map[chan any]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving every value published to key until
+// the returned cancel function is called. The channel is closed if its buffer
+// of the given size is full when a value is published, see Publish.
+func (h *Hub) Subscribe(key any, size int) (<-chan any, func()) {
+	h.Lock()
+	defer h.Unlock()
+
+	ch := make(chan any, size)
+	if h.subs[key] == nil {
+		h.subs[key] = make(map[chan any]struct{})
+	}
+	h.subs[key][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.Lock()
+			defer h.Unlock()
+
+			if _, ok := h.subs[key][ch]; !ok {
+				// closed by Publish
+				return
+			}
+			delete(h.subs[key], ch)
+			if len(h.subs[key]) == 0 {
+				delete(h.subs, key)
+			}
+		})
+	}
+}
+
+func (h *Hub) HasSubscribers(key any) bool {
+	h.Lock()
+	defer h.Unlock()
+
+	return len(h.subs[key]) > 0
+}
+
+// Publish sends v to the subscribers of key without blocking. Subscribers
+// whose buffer is full are too slow to keep up, their channel is closed and
+// they are unsubscribed rather than missing the value.
+func (h *Hub) Publish(key any, v any) {
+	h.Lock()
+	defer h.Unlock()
+
+	for ch := range h.subs[key] {
+		select {
+		case ch <- v:
+		default:
+			close(ch)
+			delete(h.subs[key], ch)
+		}
+	}
+	if len(h.subs[key]) == 0 {
+		delete(h.subs, key)
 	}
 }
 
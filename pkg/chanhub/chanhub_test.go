@@ -0,0 +1,37 @@
+package chanhub
+
+import "testing"
+
+func TestPublishClosesSlowSubscribers(t *testing.T) {
+	h := New()
+	slow, unsubscribeSlow := h.Subscribe("k", 1)
+	fast, unsubscribeFast := h.Subscribe("k", 2)
+	defer unsubscribeFast()
+
+	h.Publish("k", 1)
+	h.Publish("k", 2)
+
+	if v, ok := <-slow; !ok || v != 1 {
+		t.Fatalf("slow got %v, %v", v, ok)
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("slow subscriber is not closed")
+	}
+	unsubscribeSlow()
+
+	for _, want := range []int{1, 2} {
+		if v := <-fast; v != want {
+			t.Fatalf("fast got %v, want %d", v, want)
+		}
+	}
+	if !h.HasSubscribers("k") {
+		t.Fatal("fast subscriber is unsubscribed")
+	}
+
+	h.Publish("k", 3)
+	h.Publish("k", 4)
+	h.Publish("k", 5)
+	if h.HasSubscribers("k") {
+		t.Fatal("slow subscribers are still subscribed")
+	}
+}
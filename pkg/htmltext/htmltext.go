@@ -0,0 +1,97 @@
+// Package htmltext converts HTML pages to the readable text to put into
+// prompts.
+package htmltext
+
+import (
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// hidden are the elements whose content is not shown.
+const hidden = "head, script, style, noscript, template, svg, iframe, object"
+
+var blocks = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"tr": true, "ul": true,
+}
+
+// Text returns the text of the HTML document read from r, or of the elements
+// matching the CSS selector if not empty, with a line per block element and
+// the whitespace collapsed.
+func Text(r io.Reader, selector string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", err
+	}
+	doc.Find(hidden).Remove()
+
+	sel := doc.Selection
+	if selector != "" {
+		sel = doc.Find(selector)
+	}
+
+	var b strings.Builder
+	for _, n := range sel.Nodes {
+		writeText(&b, n)
+		b.WriteByte('\n')
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	text := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			text = append(text, line)
+		}
+	}
+	return strings.Join(text, "\n"), nil
+}
+
+var newlines = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func inPre(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == "pre" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if inPre(n) {
+			b.WriteString(n.Data)
+		} else {
+			// line breaks in the source are spaces, lines come from blocks
+			b.WriteString(newlines.Replace(n.Data))
+		}
+		return
+	case html.ElementNode:
+		if n.Data == "br" {
+			b.WriteByte('\n')
+			return
+		}
+		if blocks[n.Data] {
+			b.WriteByte('\n')
+			if n.Data == "li" {
+				b.WriteString("- ")
+			}
+			defer b.WriteByte('\n')
+		} else if n.Data == "td" || n.Data == "th" {
+			defer b.WriteByte(' ')
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c)
+	}
+}
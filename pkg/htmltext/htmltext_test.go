@@ -0,0 +1,92 @@
+package htmltext
+
+import (
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head><title>Title</title><style>p { color: red }</style></head>
+<body>
+	<nav><a href="/">Home</a> | <a href="/about">About</a></nav>
+	<main>
+		<h1>Heading</h1>
+		<p>First   paragraph
+		with <b>bold</b> and <a href="#">a link</a>.</p>
+		<script>console.log("hidden")</script>
+		<noscript>enable js</noscript>
+		<ul><li>one</li><li>two</li></ul>
+		<p>line<br>break</p>
+		<pre>pre
+  kept</pre>
+		<table><tr><th>k</th><th>v</th></tr><tr><td>a</td><td>1</td></tr></table>
+		<div class="note">Note <span>one</span></div>
+		<div class="note">Note two</div>
+	</main>
+</body>
+</html>`
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		want     string
+	}{
+		{
+			name: "whole page",
+			want: strings.Join([]string{
+				"Home | About",
+				"Heading",
+				"First paragraph with bold and a link.",
+				"- one",
+				"- two",
+				"line",
+				"break",
+				"pre",
+				"kept",
+				"k v",
+				"a 1",
+				"Note one",
+				"Note two",
+			}, "\n"),
+		},
+		{
+			name:     "selector",
+			selector: "div.note",
+			want:     "Note one\nNote two",
+		},
+		{
+			name:     "hidden elements of the selection",
+			selector: "main h1, main script",
+			want:     "Heading",
+		},
+		{
+			name:     "no match",
+			selector: "article",
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Text(strings.NewReader(page), tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextFragment(t *testing.T) {
+	got, err := Text(strings.NewReader("plain <strong>text</strong> &amp; entities"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "plain text & entities"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+// Package jsonpath implements the subset of JSONPath selecting fields of
+// decoded JSON values: the root $, child names as .name or ['name'], array
+// indexes as [0] or [-1] counting from the end, and wildcards as .* or [*],
+// which select the fields of objects in key order.
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type stepKind int
+
+const (
+	stepName stepKind = iota
+	stepIndex
+	stepWildcard
+)
+
+type step struct {
+	kind  stepKind
+	name  string
+	index int
+}
+
+// Path is a parsed JSONPath expression.
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// Parse parses a JSONPath expression, which must start with $.
+func Parse(expr string) (*Path, error) {
+	p := &Path{expr: expr}
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", expr)
+	}
+	s = s[1:]
+
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			if strings.HasPrefix(s, ".") {
+				return nil, fmt.Errorf("jsonpath %q: recursive descent is not supported", expr)
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("jsonpath %q: empty name", expr)
+			case "*":
+				p.steps = append(p.steps, step{kind: stepWildcard})
+			default:
+				p.steps = append(p.steps, step{kind: stepName, name: name})
+			}
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: missing ]", expr)
+			}
+			v := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			switch {
+			case v == "*":
+				p.steps = append(p.steps, step{kind: stepWildcard})
+			case len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0]:
+				p.steps = append(p.steps, step{kind: stepName, name: v[1 : len(v)-1]})
+			default:
+				i, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath %q: invalid index %s", expr, v)
+				}
+				p.steps = append(p.steps, step{kind: stepIndex, index: i})
+			}
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", expr, s[0])
+		}
+	}
+	return p, nil
+}
+
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Get returns the values the path selects in v, a value decoded by
+// encoding/json into any. Missing fields and indexes select nothing.
+func (p *Path) Get(v any) []any {
+	values := []any{v}
+	for _, st := range p.steps {
+		var next []any
+		for _, v := range values {
+			switch st.kind {
+			case stepName:
+				if m, ok := v.(map[string]any); ok {
+					if c, ok := m[st.name]; ok {
+						next = append(next, c)
+					}
+				}
+			case stepIndex:
+				if a, ok := v.([]any); ok {
+					i := st.index
+					if i < 0 {
+						i += len(a)
+					}
+					if i >= 0 && i < len(a) {
+						next = append(next, a[i])
+					}
+				}
+			case stepWildcard:
+				switch c := v.(type) {
+				case []any:
+					next = append(next, c...)
+				case map[string]any:
+					keys := make([]string, 0, len(c))
+					for k := range c {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, c[k])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
@@ -0,0 +1,93 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const doc = `{
+	"store": {
+		"name": "corner",
+		"odd key": {"x.y": 1},
+		"books": [
+			{"title": "A", "price": 8},
+			{"title": "B", "price": 12},
+			{"title": "C", "tags": ["new", "sale"]}
+		]
+	},
+	"z": 3,
+	"a": 1,
+	"m": 2
+}`
+
+func TestGet(t *testing.T) {
+	var v any
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want []any
+	}{
+		{"$", []any{v}},
+		{"$.store.name", []any{"corner"}},
+		{"$['store']['name']", []any{"corner"}},
+		{`$["store"].name`, []any{"corner"}},
+		{"$.store['odd key']['x.y']", []any{float64(1)}},
+		{"$.store.books[0].title", []any{"A"}},
+		{"$.store.books[-1].title", []any{"C"}},
+		{"$.store.books[-3].title", []any{"A"}},
+		{"$.store.books[ 1 ].price", []any{float64(12)}},
+		{"$.store.books[*].title", []any{"A", "B", "C"}},
+		{"$.store.books.*.price", []any{float64(8), float64(12)}},
+		{"$.store.books[*].tags[*]", []any{"new", "sale"}},
+		{"$[*]", nil},
+		{"$.*", nil},
+		{"$.store.books[3]", nil},
+		{"$.store.books[-4]", nil},
+		{"$.store.missing", nil},
+		{"$.store.name[0]", nil},
+		{"$.store.name.x", nil},
+	}
+	// wildcards on objects select the fields in key order
+	root := v.(map[string]any)
+	tests[12].want = []any{root["a"], root["m"], root["store"], root["z"]}
+	tests[13].want = tests[12].want
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.String() != tt.expr {
+				t.Errorf("String() = %q", p.String())
+			}
+			if got := p.Get(v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"store.name",
+		"$..name",
+		"$.",
+		"$.store.",
+		"$.a..b",
+		"$[0",
+		"$[x]",
+		"$['unterminated]",
+		"$[]",
+		"$ name",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -10,6 +10,22 @@ var (
 	ErrTooManyRequestTokens = errors.New("too many request tokens")
 )
 
+// CallError is returned when the request to the model provider fails.
+type CallError struct {
+	// StatusCode is the http status of the provider response, 0 if the
+	// request did not get a response.
+	StatusCode int
+	Err        error
+}
+
+func (e *CallError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
 type Usage struct {
 	PromptTokens     int
 	CompletionTokens int
@@ -24,6 +40,11 @@ type ChatRequest struct {
 	Request        string
 }
 
+type ChatMessage struct {
+	Role    string
+	Content string
+}
+
 type ChatResponse struct {
 	Response string
 	Usage    Usage
@@ -43,13 +64,43 @@ type CreateEmbeddingResponse struct {
 	Usage Usage
 }
 
+// Tokenizer counts tokens the same way the underlying model does.
+type Tokenizer interface {
+	CountTokens(texts ...string) (int, error)
+	// TruncateTokens returns the beginning of text having at most maxTokens
+	// tokens.
+	TruncateTokens(text string, maxTokens int) (string, error)
+}
+
 type ChatLLM interface {
+	Tokenizer
 	Name() string
 	Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// ChatMessages returns the exact message list Chat would send for req.
+	ChatMessages(req ChatRequest) []ChatMessage
+	// CountChatTokens returns the number of prompt tokens Chat would send for req.
+	CountChatTokens(req ChatRequest) (int, error)
 	MaxRequestTokens() int // 0 means unlimited
 }
 
+// ChatStreamer is implemented by chat models that can stream their response,
+// onDelta is called with each piece of the response as it is received.
+type ChatStreamer interface {
+	ChatStream(ctx context.Context, req ChatRequest, onDelta func(string)) (*ChatResponse, error)
+}
+
+// ModerationResult scores an input from 0 to 1 in each category.
+type ModerationResult struct {
+	Scores map[string]float64
+}
+
+// Moderator is implemented by the providers classifying inputs as harmful.
+type Moderator interface {
+	Moderate(ctx context.Context, input string) (*ModerationResult, error)
+}
+
 type EmbeddingLLM interface {
+	Tokenizer
 	Name() string
 	CreateEmbedding(ctx context.Context, req CreateEmbeddingRequest) (*CreateEmbeddingResponse, error)
 	MaxRequestTokens() int // 0 means unlimited
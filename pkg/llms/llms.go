@@ -16,6 +16,7 @@ type embeddingLLM struct {
 type Handler struct {
 	chatMap      map[string]api.ChatLLM
 	embeddingMap map[string]api.EmbeddingLLM
+	moderatorMap map[string]api.Moderator
 
 	chatModles      []string
 	embeddingModels []string
@@ -25,6 +26,7 @@ func New(cfg config.LLMsConfig) *Handler {
 	h := &Handler{
 		chatMap:      make(map[string]api.ChatLLM),
 		embeddingMap: make(map[string]api.EmbeddingLLM),
+		moderatorMap: make(map[string]api.Moderator),
 	}
 	for _, name := range cfg.Enabled {
 		item := cfg.Items[name]
@@ -49,6 +51,10 @@ func New(cfg config.LLMsConfig) *Handler {
 				h.embeddingMap[key] = m
 			}
 		}
+
+		if v, ok := r.(api.Moderator); ok {
+			h.moderatorMap[name] = v
+		}
 	}
 
 	return h
@@ -70,6 +76,15 @@ func (h *Handler) GetEmbeddingModel(key string) (api.EmbeddingLLM, error) {
 	return v, nil
 }
 
+// GetModerator returns the moderator of the enabled llm of the given name.
+func (h *Handler) GetModerator(name string) (api.Moderator, error) {
+	v, ok := h.moderatorMap[name]
+	if !ok {
+		return nil, api.ErrModelNotFound
+	}
+	return v, nil
+}
+
 func (h *Handler) ChatModels() []string {
 	return h.chatModles
 }
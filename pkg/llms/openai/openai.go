@@ -2,7 +2,10 @@ package openai
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/pandodao/botastic/config"
 	"github.com/pandodao/botastic/pkg/llms/api"
@@ -16,9 +19,13 @@ type Handler struct {
 }
 
 func Init(cfg *config.OpenAIConfig) *Handler {
+	c := openai.DefaultConfig(cfg.Key)
+	if cfg.BaseURL != "" {
+		c.BaseURL = cfg.BaseURL
+	}
 	return &Handler{
 		cfg:    cfg,
-		client: openai.NewClient(cfg.Key),
+		client: openai.NewClientWithConfig(c),
 	}
 }
 
@@ -51,6 +58,32 @@ func (h *Handler) EmbeddingModels() []api.EmbeddingLLM {
 	return ms
 }
 
+// Moderate classifies the input with the moderation endpoint.
+func (h *Handler) Moderate(ctx context.Context, input string) (*api.ModerationResult, error) {
+	resp, err := h.client.Moderations(ctx, openai.ModerationRequest{
+		Input: input,
+	})
+	if err != nil {
+		return nil, callError(err)
+	}
+	if len(resp.Results) == 0 {
+		return nil, errors.New("no moderation result")
+	}
+
+	scores := resp.Results[0].CategoryScores
+	return &api.ModerationResult{
+		Scores: map[string]float64{
+			"hate":             float64(scores.Hate),
+			"hate/threatening": float64(scores.HateThreatening),
+			"self-harm":        float64(scores.SelfHarm),
+			"sexual":           float64(scores.Sexual),
+			"sexual/minors":    float64(scores.SexualMinors),
+			"violence":         float64(scores.Violence),
+			"violence/graphic": float64(scores.ViolenceGraphic),
+		},
+	}, nil
+}
+
 type HandlerWithModel struct {
 	*Handler
 	model string
@@ -63,7 +96,7 @@ func (h *HandlerWithModel) Name() string {
 }
 
 func (h *HandlerWithModel) Chat(ctx context.Context, req api.ChatRequest) (*api.ChatResponse, error) {
-	tokens, err := h.calChatRequestTokens(ctx, req)
+	tokens, err := h.CountChatTokens(req)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +113,7 @@ func (h *HandlerWithModel) Chat(ctx context.Context, req api.ChatRequest) (*api.
 
 	resp, err := h.client.CreateChatCompletion(ctx, chatReq)
 	if err != nil {
-		return nil, err
+		return nil, callError(err)
 	}
 	return &api.ChatResponse{
 		Response: resp.Choices[0].Message.Content,
@@ -92,7 +125,75 @@ func (h *HandlerWithModel) Chat(ctx context.Context, req api.ChatRequest) (*api.
 	}, nil
 }
 
-func (h *HandlerWithModel) calChatRequestTokens(ctx context.Context, req api.ChatRequest) (int, error) {
+func (h *HandlerWithModel) ChatStream(ctx context.Context, req api.ChatRequest, onDelta func(string)) (*api.ChatResponse, error) {
+	promptTokens, err := h.CountChatTokens(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if promptTokens >= h.MaxRequestTokens() {
+		return nil, api.ErrTooManyRequestTokens
+	}
+
+	stream, err := h.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+		Model:       h.model,
+		Temperature: req.Temperature,
+		Messages:    getMessagesFromRequest(req),
+		Stream:      true,
+	})
+	if err != nil {
+		return nil, callError(err)
+	}
+	defer stream.Close()
+
+	var sb strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, callError(err)
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := resp.Choices[0].Delta.Content
+		sb.WriteString(delta)
+		onDelta(delta)
+	}
+
+	// the stream does not report usage, count it the same way as OpenAI does
+	response := sb.String()
+	completionTokens, err := h.CountTokens(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ChatResponse{
+		Response: response,
+		Usage: api.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}, nil
+}
+
+func (h *HandlerWithModel) ChatMessages(req api.ChatRequest) []api.ChatMessage {
+	messages := getMessagesFromRequest(req)
+	r := make([]api.ChatMessage, len(messages))
+	for i, m := range messages {
+		r[i] = api.ChatMessage{
+			Role:    m.Role,
+			Content: m.Content,
+		}
+	}
+	return r
+}
+
+func (h *HandlerWithModel) CountChatTokens(req api.ChatRequest) (int, error) {
 	tkm, err := tiktoken.EncodingForModel(h.model)
 	if err != nil {
 		return 0, err
@@ -127,7 +228,7 @@ func (h *HandlerWithModel) calChatRequestTokens(ctx context.Context, req api.Cha
 }
 
 func (h *HandlerWithModel) CreateEmbedding(ctx context.Context, req api.CreateEmbeddingRequest) (*api.CreateEmbeddingResponse, error) {
-	tokens, err := h.calEmbeddingRequestTokens(req)
+	tokens, err := h.CountTokens(req.Input...)
 	if err != nil {
 		return nil, err
 	}
@@ -141,7 +242,7 @@ func (h *HandlerWithModel) CreateEmbedding(ctx context.Context, req api.CreateEm
 		Model: h.embeddingModel,
 	})
 	if err != nil {
-		return nil, err
+		return nil, callError(err)
 	}
 
 	embeddings := make([]api.Embedding, len(resp.Data))
@@ -179,20 +280,34 @@ func (h *HandlerWithModel) MaxRequestTokens() int {
 	return 0
 }
 
-func (h *HandlerWithModel) calEmbeddingRequestTokens(req api.CreateEmbeddingRequest) (int, error) {
+func (h *HandlerWithModel) CountTokens(texts ...string) (int, error) {
 	tkm, err := tiktoken.EncodingForModel(h.model)
 	if err != nil {
 		return 0, fmt.Errorf("model %s not supported", h.model)
 	}
 
 	numTokens := 0
-	for _, text := range req.Input {
+	for _, text := range texts {
 		numTokens += len(tkm.Encode(text, nil, nil))
 	}
 
 	return numTokens, nil
 }
 
+func (h *HandlerWithModel) TruncateTokens(text string, maxTokens int) (string, error) {
+	tkm, err := tiktoken.EncodingForModel(h.model)
+	if err != nil {
+		return "", fmt.Errorf("model %s not supported", h.model)
+	}
+
+	tokens := tkm.Encode(text, nil, nil)
+	if len(tokens) <= maxTokens {
+		return text, nil
+	}
+	// the cut can split a multi-byte character
+	return strings.ToValidUTF8(tkm.Decode(tokens[:maxTokens]), ""), nil
+}
+
 func getMessagesFromRequest(req api.ChatRequest) []openai.ChatCompletionMessage {
 	messages := make([]openai.ChatCompletionMessage, 0, len(req.History)+2)
 	if req.Prompt != "" {
@@ -201,7 +316,7 @@ func getMessagesFromRequest(req api.ChatRequest) []openai.ChatCompletionMessage
 			Content: req.Prompt,
 		})
 	}
-	for i := 0; i < len(req.History); i += 2 {
+	for i := 0; i < len(req.History); i++ {
 		role := openai.ChatMessageRoleUser
 		if i%2 == 1 {
 			role = openai.ChatMessageRoleAssistant
@@ -226,3 +341,17 @@ func getMessagesFromRequest(req api.ChatRequest) []openai.ChatCompletionMessage
 
 	return messages
 }
+
+// callError wraps the error of a request to OpenAI with its response status.
+func callError(err error) error {
+	callErr := &api.CallError{Err: err}
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		callErr.StatusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		callErr.StatusCode = reqErr.HTTPStatusCode
+	}
+	return callErr
+}
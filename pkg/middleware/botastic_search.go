@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/pandodao/botastic/api"
 	"github.com/pandodao/botastic/internal/vector"
@@ -12,6 +15,21 @@ import (
 	"github.com/pandodao/botastic/pkg/llms"
 )
 
+const (
+	noResultsSkip     = "skip"
+	noResultsFail     = "fail"
+	noResultsFallback = "fallback"
+
+	// searchFilterFactor is how many more indexes are searched when filtering
+	// by properties, for the filtered results to still fill the limit.
+	searchFilterFactor = 5
+
+	defaultResultTemplate = `{{range $i, $index := .Indexes}}{{if $i}}
+{{end}}{{$i}}. {{$index.Data}}{{end}}`
+)
+
+var errNoResults = errors.New("no results found")
+
 type BotasticSearch struct {
 	vih   *vector.IndexHandler
 	llmsh *llms.Handler
@@ -34,7 +52,14 @@ func (m *BotasticSearch) Desc() *api.MiddlewareDesc {
 				Desc:         "limit is the number of results to return",
 				DefaultValue: "3",
 				ParseValueFunc: func(v string) (any, error) {
-					return strconv.Atoi(v)
+					limit, err := strconv.Atoi(v)
+					if err != nil {
+						return nil, err
+					}
+					if limit <= 0 {
+						return nil, fmt.Errorf("limit must be positive")
+					}
+					return limit, nil
 				},
 			},
 			{
@@ -60,6 +85,49 @@ func (m *BotasticSearch) Desc() *api.MiddlewareDesc {
 					return v, nil
 				},
 			},
+			{
+				Name:         "min_score",
+				Desc:         "results scoring less than min_score are dropped",
+				DefaultValue: "0",
+				ParseValueFunc: func(v string) (any, error) {
+					return strconv.ParseFloat(v, 64)
+				},
+			},
+			{
+				Name: "properties",
+				Desc: "only keep the results whose properties match, e.g. lang=en,type=faq",
+				ParseValueFunc: func(v string) (any, error) {
+					return parsePropertiesFilter(v)
+				},
+			},
+			{
+				Name:         "result_template",
+				Desc:         "go template rendering the result from .Query and .Indexes, each with .Data, .Score and .Properties",
+				DefaultValue: defaultResultTemplate,
+				Raw:          true,
+				ParseValueFunc: func(v string) (any, error) {
+					return template.New("result").Parse(v)
+				},
+			},
+			{
+				Name:         "no_results",
+				Desc:         "what to do if nothing is found: skip with an empty result, fail, or fallback to fallback_text",
+				DefaultValue: noResultsSkip,
+				ParseValueFunc: func(v string) (any, error) {
+					switch v {
+					case noResultsSkip, noResultsFail, noResultsFallback:
+						return v, nil
+					}
+					return nil, fmt.Errorf("invalid value %s, must be one of skip, fail, fallback", v)
+				},
+			},
+			{
+				Name: "fallback_text",
+				Desc: "the result if nothing is found and no_results is fallback",
+				ParseValueFunc: func(v string) (any, error) {
+					return v, nil
+				},
+			},
 		},
 	}
 }
@@ -68,21 +136,80 @@ func (m *BotasticSearch) Process(ctx context.Context, opts map[string]*api.Middl
 	limit := opts["limit"].Value.(int)
 	groupKey := opts["group_key"].Value.(string)
 	embeddingModel := opts["embedding_model"].Value.(string)
+	minScore := opts["min_score"].Value.(float64)
+	properties := opts["properties"].Value.(map[string]string)
 
-	indexes, err := m.vih.SearchIndexes(ctx, embeddingModel, turn.Request, groupKey, limit)
+	query := turnRequest(ctx, turn)
+	searchLimit := limit
+	if len(properties) > 0 {
+		searchLimit *= searchFilterFactor
+	}
+	indexes, err := m.vih.SearchIndexes(ctx, turn.AppID, embeddingModel, query, groupKey, searchLimit)
 	if err != nil {
 		return "", nil, err
 	}
 
-	result := ""
-	for i, index := range indexes {
-		result += fmt.Sprintf("%d. %s", i, index.Data)
-		if i != len(indexes)-1 {
-			result += "\n"
+	filtered := make([]*api.Index, 0, limit)
+	for _, index := range indexes {
+		if len(filtered) == limit {
+			break
+		}
+		if index.Score < minScore || !matchProperties(index.Properties, properties) {
+			continue
+		}
+		filtered = append(filtered, index)
+	}
+
+	extraData := map[string]any{
+		"indexes": filtered,
+	}
+	if len(filtered) == 0 {
+		switch opts["no_results"].Value.(string) {
+		case noResultsFail:
+			return "", nil, errNoResults
+		case noResultsFallback:
+			return opts["fallback_text"].Value.(string), extraData, nil
 		}
 	}
 
-	return result, map[string]any{
-		"indexes": indexes,
-	}, nil
+	var buf bytes.Buffer
+	t := opts["result_template"].Value.(*template.Template)
+	if err := t.Execute(&buf, map[string]any{
+		"Query":   query,
+		"Indexes": filtered,
+	}); err != nil {
+		return "", nil, fmt.Errorf("failed to render result: %w", err)
+	}
+
+	return buf.String(), extraData, nil
+}
+
+// parsePropertiesFilter parses comma separated key=value pairs.
+func parsePropertiesFilter(v string) (map[string]string, error) {
+	r := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid property filter %q, must be key=value", pair)
+		}
+		r[key] = strings.TrimSpace(value)
+	}
+	return r, nil
+}
+
+// matchProperties reports whether the properties have all the filtered
+// values, compared as strings.
+func matchProperties(properties map[string]any, filter map[string]string) bool {
+	for k, v := range filter {
+		p, ok := properties[k]
+		if !ok || fmt.Sprint(p) != v {
+			return false
+		}
+	}
+	return true
 }
@@ -2,43 +2,67 @@ package middleware
 
 import (
 	"context"
-	"strconv"
+	"strings"
+	"text/template"
 
 	"github.com/pandodao/botastic/api"
-	"github.com/pandodao/botastic/internal/ddg"
+	"github.com/pandodao/botastic/internal/search"
 	"github.com/pandodao/botastic/models"
 )
 
-type DDGSearch struct{}
+var ddgSearchTemplate = template.Must(template.New("ddg").Parse(`DDGSearch results:
+{{range .Items}}
+[{{.Index}}] "{{.Snippet}}"
+URL: {{.URL}}
+{{end}}
 
-func NewDDGSearch() *DDGSearch {
-	return &DDGSearch{}
+Current date: {{.Date}}`))
+
+// DDGSearch is the web search of the default duckduckgo provider, kept for the
+// bots configured before web-search.
+type DDGSearch struct {
+	sh *search.Handler
+}
+
+func NewDDGSearch(sh *search.Handler) *DDGSearch {
+	return &DDGSearch{
+		sh: sh,
+	}
 }
 
 func (m *DDGSearch) Desc() *api.MiddlewareDesc {
 	return &api.MiddlewareDesc{
 		Name: "ddg_search",
-		Desc: "search by given query using duckduckgo search engine",
+		Desc: "search by given query using duckduckgo search engine, see web-search for more options",
 		Options: []*api.MiddlewareDescOption{
 			{
-				Name:         "limit",
-				Desc:         "limit number of results",
-				DefaultValue: "3",
-				ParseValueFunc: func(v string) (any, error) {
-					return strconv.Atoi(v)
-				},
+				Name:           "limit",
+				Desc:           "limit number of results",
+				DefaultValue:   "3",
+				ParseValueFunc: parsePositiveInt,
 			},
 		},
 	}
 }
 
 func (m *DDGSearch) Process(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, map[string]any, error) {
-	limit := opts["limit"].Value.(int)
-	r, err := ddg.Search(ctx, turn.Request, limit)
+	p, err := m.sh.GetProvider(search.DefaultProvider)
 	if err != nil {
 		return "", nil, err
 	}
 
-	result, err := r.Text()
+	query := turnRequest(ctx, turn)
+	items, err := p.Search(ctx, query, search.Options{
+		Count: opts["limit"].Value.(int),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	// the template quotes the snippets, which never had quotes of their own
+	for _, item := range items {
+		item.Snippet = strings.ReplaceAll(item.Snippet, `"`, "")
+	}
+
+	result, err := renderSearchResult(ddgSearchTemplate, query, items)
 	return result, nil, err
 }
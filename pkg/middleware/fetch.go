@@ -1,61 +1,311 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
 	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/htmltext"
+	"github.com/pandodao/botastic/pkg/jsonpath"
+	"github.com/pandodao/botastic/pkg/llms"
+	llmapi "github.com/pandodao/botastic/pkg/llms/api"
 )
 
-type Fetch struct{}
+const fetchMaxBodySize = 4 << 20
 
-func NewFetch() *Fetch {
-	return &Fetch{}
+// secretRef matches the references to the secrets of the config in headers.
+var secretRef = regexp.MustCompile(`\$\{(\w+)\}`)
+
+type Fetch struct {
+	cfg   config.MiddlewaresConfig
+	llmsh *llms.Handler
+}
+
+func NewFetch(cfg config.MiddlewaresConfig, llmsh *llms.Handler) *Fetch {
+	return &Fetch{
+		cfg:   cfg,
+		llmsh: llmsh,
+	}
 }
 
 func (m *Fetch) Desc() *api.MiddlewareDesc {
 	return &api.MiddlewareDesc{
 		Name: "fetch",
-		Desc: "fetch middleware will send a GET request to the specified URL and return the response body as string",
+		Desc: "fetch middleware will send a request to the specified URL and return the response body as string, optionally extracting JSON fields or the text of HTML pages",
 		Options: []*api.MiddlewareDescOption{
 			{
 				Name:     "url",
-				Desc:     "URL to fetch",
+				Desc:     "URL to fetch, e.g. https://example.com/search?q={{urlquery .Request}}",
 				Required: true,
 				ParseValueFunc: func(v string) (any, error) {
-					_, err := url.Parse(v)
-					return v, err
+					u, err := url.Parse(v)
+					if err != nil {
+						return nil, err
+					}
+					if u.Scheme != "http" && u.Scheme != "https" {
+						return nil, fmt.Errorf("url must be http or https: %s", v)
+					}
+					return v, nil
+				},
+			},
+			{
+				Name:         "method",
+				Desc:         "HTTP method, one of GET, POST, PUT, PATCH, DELETE",
+				DefaultValue: http.MethodGet,
+				ParseValueFunc: func(v string) (any, error) {
+					switch v = strings.ToUpper(v); v {
+					case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+						return v, nil
+					}
+					return nil, fmt.Errorf("invalid method %s, must be one of GET, POST, PUT, PATCH, DELETE", v)
+				},
+			},
+			{
+				Name: "body",
+				Desc: "JSON request body, e.g. {\"query\": {{json .Request}}}",
+				ParseValueFunc: func(v string) (any, error) {
+					if v != "" && !json.Valid([]byte(v)) {
+						return nil, errors.New("body is not valid JSON")
+					}
+					return v, nil
+				},
+			},
+			{
+				Name:        "headers",
+				Desc:        "request headers, one \"Name: value\" per line, ${NAME} in values refers to the secret NAME of the middlewares config, which is only sent to its hosts",
+				PrepareFunc: m.resolveSecrets,
+				ParseValueFunc: func(v string) (any, error) {
+					return parseHeaders(v)
+				},
+			},
+			{
+				Name: "json_path",
+				Desc: "JSONPath of the fields of a JSON response to return one per line, e.g. $.items[*].title",
+				ParseValueFunc: func(v string) (any, error) {
+					if v == "" {
+						return (*jsonpath.Path)(nil), nil
+					}
+					return jsonpath.Parse(v)
+				},
+			},
+			{
+				Name:         "html_to_text",
+				Desc:         "return the readable text of HTML responses",
+				DefaultValue: "false",
+				ParseValueFunc: func(v string) (any, error) {
+					return strconv.ParseBool(v)
+				},
+			},
+			{
+				Name: "selector",
+				Desc: "CSS selector of the elements of HTML responses to return the text of, the whole page if empty",
+				ParseValueFunc: func(v string) (any, error) {
+					return v, nil
+				},
+			},
+			{
+				Name:         "max_tokens",
+				Desc:         "truncate the result to this number of tokens of chat_model, 0 means unlimited",
+				DefaultValue: "0",
+				ParseValueFunc: func(v string) (any, error) {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						return nil, err
+					}
+					if n < 0 {
+						return nil, errors.New("max_tokens must not be negative")
+					}
+					return n, nil
+				},
+			},
+			{
+				Name: "chat_model",
+				Desc: "the chat model counting the tokens of max_tokens",
+				ParseValueFunc: func(v string) (any, error) {
+					if v == "" {
+						return nil, nil
+					}
+					cm, err := m.llmsh.GetChatModel(v)
+					if err != nil {
+						return nil, fmt.Errorf("chat model %s not found", v)
+					}
+					return cm, nil
 				},
 			},
 		},
 	}
 }
 
+// resolveSecrets replaces the references to the secrets with template
+// strings of their values. It runs on the headers as written in the config,
+// so the request rendered into them can not refer to secrets.
+func (m *Fetch) resolveSecrets(v string) (string, error) {
+	var err error
+	v = secretRef.ReplaceAllStringFunc(v, func(ref string) string {
+		key := secretRef.FindStringSubmatch(ref)[1]
+		secret, ok := m.cfg.Secrets[key]
+		if !ok && err == nil {
+			err = fmt.Errorf("secret %s not found in the middlewares config", key)
+		}
+		return "{{" + strconv.Quote(secret.Value) + "}}"
+	})
+	return v, err
+}
+
+// checkSecretHosts checks that the secrets in the header can be sent to the
+// host of u.
+func (m *Fetch) checkSecretHosts(u *url.URL, header http.Header) error {
+	host := strings.ToLower(u.Hostname())
+	for name, secret := range m.cfg.Secrets {
+		if secret.Value == "" || !headerContains(header, secret.Value) {
+			continue
+		}
+		allowed := false
+		for _, h := range secret.Hosts {
+			if strings.EqualFold(h, host) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("secret %s can not be sent to %s", name, host)
+		}
+	}
+	return nil
+}
+
+func headerContains(header http.Header, s string) bool {
+	for _, values := range header {
+		for _, v := range values {
+			if strings.Contains(v, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseHeaders parses the header lines.
+func parseHeaders(v string) (http.Header, error) {
+	header := http.Header{}
+	for _, line := range strings.Split(v, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q, must be Name: value", line)
+		}
+		header.Add(name, value)
+	}
+	return header, nil
+}
+
 func (m *Fetch) Process(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, map[string]any, error) {
 	u := opts["url"].Value.(string)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	maxTokens := opts["max_tokens"].Value.(int)
+	cm, _ := opts["chat_model"].Value.(llmapi.ChatLLM)
+	if maxTokens > 0 && cm == nil {
+		return "", nil, errors.New("chat_model is required to count max_tokens")
+	}
+
+	var body io.Reader
+	if v := opts["body"].Value.(string); v != "" {
+		body = strings.NewReader(v)
+	}
+	req, err := http.NewRequestWithContext(ctx, opts["method"].Value.(string), u, body)
 	if err != nil {
 		return "", nil, err
 	}
+	req.Header = opts["headers"].Value.(http.Header)
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	if err := m.checkSecretHosts(req.URL, req.Header); err != nil {
+		return "", nil, err
+	}
+	// the headers are sent again on redirects
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return m.checkSecretHosts(req.URL, req.Header)
+		},
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", nil, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, fetchMaxBodySize))
 	if err != nil {
 		return "", nil, err
 	}
 
 	if resp.StatusCode/100 != 2 {
-		return "", nil, fmt.Errorf("failed to fetch url: %s, status code: %d, body: %s", u, resp.StatusCode, string(body))
+		return "", nil, fmt.Errorf("failed to fetch url: %s, status code: %d, body: %s", u, resp.StatusCode, string(data))
 	}
 
-	return string(body), nil, nil
+	extraData := map[string]any{
+		"status_code": resp.StatusCode,
+	}
+	result := string(data)
+	jp := opts["json_path"].Value.(*jsonpath.Path)
+	switch {
+	case jp != nil:
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return "", nil, fmt.Errorf("response is not valid JSON: %w", err)
+		}
+		values := jp.Get(v)
+		if result, err = jsonValuesText(values); err != nil {
+			return "", nil, err
+		}
+		extraData["values"] = values
+	case opts["html_to_text"].Value.(bool) && strings.Contains(resp.Header.Get("Content-Type"), "html"):
+		if result, err = htmltext.Text(bytes.NewReader(data), opts["selector"].Value.(string)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if maxTokens > 0 {
+		if result, err = cm.TruncateTokens(result, maxTokens); err != nil {
+			return "", nil, err
+		}
+	}
+	return result, extraData, nil
+}
+
+// jsonValuesText puts each value on a line, strings as they are and other
+// values as JSON.
+func jsonValuesText(values []any) (string, error) {
+	lines := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			lines = append(lines, s)
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, string(data))
+	}
+	return strings.Join(lines, "\n"), nil
 }
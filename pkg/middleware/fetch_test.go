@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+)
+
+func TestFetchSecrets(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.MiddlewaresConfig{Secrets: map[string]config.SecretConfig{
+		"API_KEY": {Value: `k"{{.Request}}`, Hosts: []string{u.Hostname()}},
+		"OTHER":   {Value: "other-secret", Hosts: []string{u.Hostname()}},
+	}}
+	h := New(nil, nil, []Middleware{NewFetch(cfg, nil)}, nil)
+	mc := api.MiddlewareConfig{Items: []*api.Middleware{{
+		ID:   "f",
+		Name: "fetch",
+		Options: map[string]string{
+			"url":     srv.URL,
+			"headers": "Authorization: Bearer ${API_KEY}\nX-Query: {{.Request}}",
+		},
+	}}}
+	if err := h.ValidateConfig(&mc); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, _ := h.Process(context.Background(), mc, &models.Turn{Request: "${OTHER}"})
+	if rs[0].Code != 0 {
+		t.Fatalf("code = %d, err = %s", rs[0].Code, rs[0].Err)
+	}
+	if v := got.Get("Authorization"); v != `Bearer k"{{.Request}}` {
+		t.Errorf("Authorization = %q", v)
+	}
+	if v := got.Get("X-Query"); v != "${OTHER}" {
+		t.Errorf("X-Query = %q, the request must not resolve secrets", v)
+	}
+
+	mc.Items[0].Options = map[string]string{
+		"url":     srv.URL,
+		"headers": "Authorization: ${MISSING}",
+	}
+	if err := h.ValidateConfig(&mc); err == nil || !strings.Contains(err.Error(), "secret MISSING not found") {
+		t.Errorf("err = %v, want missing secret", err)
+	}
+}
+
+func TestFetchJSONPath(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("method = %s, content type = %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": [{"title": "a"}, {"title": "b", "n": 1}]}`))
+	}))
+	defer srv.Close()
+
+	h := New(nil, nil, []Middleware{NewFetch(config.MiddlewaresConfig{}, nil)}, nil)
+	rs, _ := h.Process(context.Background(), api.MiddlewareConfig{Items: []*api.Middleware{{
+		ID:   "f",
+		Name: "fetch",
+		Options: map[string]string{
+			"url":       srv.URL + "?q={{urlquery .Request}}",
+			"method":    "post",
+			"body":      `{"query": {{json .Request}}}`,
+			"json_path": "$.items[*]",
+		},
+	}}}, &models.Turn{Request: `say "hi"`})
+	if rs[0].Code != 0 {
+		t.Fatalf("code = %d, err = %s", rs[0].Code, rs[0].Err)
+	}
+	if body["query"] != `say "hi"` {
+		t.Errorf("body query = %v", body["query"])
+	}
+	want := "{\"title\":\"a\"}\n{\"n\":1,\"title\":\"b\"}"
+	if got := rs[0].RenderData["MIDDLEWARE_f_RESULT"]; got != want {
+		t.Errorf("result = %q, want %q", got, want)
+	}
+}
+
+func TestFetchSecretHosts(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/redirect" {
+			// the same server under another host
+			http.Redirect(w, r, strings.Replace(r.Host, "127.0.0.1", "http://localhost", 1)+"/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	cfg := config.MiddlewaresConfig{Secrets: map[string]config.SecretConfig{
+		"API_KEY": {Value: "key", Hosts: []string{"127.0.0.1"}},
+	}}
+	h := New(nil, nil, []Middleware{NewFetch(cfg, nil)}, nil)
+	fetch := func(u, headers string) *api.MiddlewareResult {
+		mc := api.MiddlewareConfig{Items: []*api.Middleware{{
+			ID:      "f",
+			Name:    "fetch",
+			Options: map[string]string{"url": u, "headers": headers},
+		}}}
+		rs, _ := h.Process(context.Background(), mc, &models.Turn{Request: "hi"})
+		return rs[0]
+	}
+
+	localhost := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	for _, c := range []struct {
+		url, headers string
+		err          string
+	}{
+		{srv.URL, "X-Key: ${API_KEY}", ""},
+		{localhost, "X-Other: value", ""},
+		{localhost, "X-Key: ${API_KEY}", "secret API_KEY can not be sent to localhost"},
+		{srv.URL + "/redirect", "X-Key: ${API_KEY}", "secret API_KEY can not be sent to localhost"},
+	} {
+		requests = 0
+		r := fetch(c.url, c.headers)
+		switch {
+		case c.err == "" && r.Code != 0:
+			t.Errorf("%s %s: %s", c.url, c.headers, r.Err)
+		case c.err != "" && !strings.Contains(r.Err, c.err):
+			t.Errorf("%s %s: err = %q, want %q", c.url, c.headers, r.Err, c.err)
+		case c.err != "" && requests > 1:
+			t.Errorf("%s %s: the secret is sent to the unlisted host", c.url, c.headers)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+type Format struct{}
+
+func NewFormat() *Format {
+	return &Format{}
+}
+
+func (m *Format) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name: "format",
+		Desc: "replaces the response with a template, e.g. to add the sources of a search as citations",
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name:     "template",
+				Desc:     "go template of the new response, over .Response, .Request, .Conv and the results of the middlewares",
+				Required: true,
+				ParseValueFunc: func(v string) (any, error) {
+					return v, nil
+				},
+			},
+		},
+	}
+}
+
+// ProcessResponse returns the template option, rendered like all the options.
+func (m *Format) ProcessResponse(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn, response string) (string, error) {
+	return opts["template"].Value.(string), nil
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+type JSONValidate struct{}
+
+func NewJSONValidate() *JSONValidate {
+	return &JSONValidate{}
+}
+
+func (m *JSONValidate) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name: "json-validate",
+		Desc: "rejects the response unless it is a JSON object with the required fields",
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name: "required_fields",
+				Desc: "comma separated fields the object must have",
+				ParseValueFunc: func(v string) (any, error) {
+					var fields []string
+					for _, f := range strings.Split(v, ",") {
+						if f = strings.TrimSpace(f); f != "" {
+							fields = append(fields, f)
+						}
+					}
+					return fields, nil
+				},
+			},
+			{
+				Name:         "strip_code_fence",
+				Desc:         "remove the markdown code fence the model may wrap the JSON in",
+				DefaultValue: "true",
+				ParseValueFunc: func(v string) (any, error) {
+					return strconv.ParseBool(v)
+				},
+			},
+		},
+	}
+}
+
+func (m *JSONValidate) ProcessResponse(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn, response string) (string, error) {
+	if opts["strip_code_fence"].Value.(bool) {
+		response = stripCodeFence(response)
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(response), &obj); err != nil {
+		return "", &RejectError{Reason: fmt.Sprintf("response is not a JSON object: %s", err)}
+	}
+	for _, f := range opts["required_fields"].Value.([]string) {
+		if _, ok := obj[f]; !ok {
+			return "", &RejectError{Reason: fmt.Sprintf("response misses field %s", f)}
+		}
+	}
+	return response, nil
+}
+
+// stripCodeFence returns the content of the markdown code block s is wrapped
+// in, or s if it is not.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "```"), "```")
+	// drop the language of the block
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
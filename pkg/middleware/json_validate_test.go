@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+)
+
+func TestJSONValidate(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		opts     map[string]string
+		response string
+		want     string
+		rejected bool
+	}{
+		{"object", nil, `{"a": 1}`, `{"a": 1}`, false},
+		{"required fields", map[string]string{"required_fields": "a, b"}, `{"a": 1, "b": null}`, `{"a": 1, "b": null}`, false},
+		{"missing field", map[string]string{"required_fields": "a,b"}, `{"a": 1}`, "", true},
+		{"not an object", nil, `[1, 2]`, "", true},
+		{"not json", nil, `sure, here it is`, "", true},
+		{"code fence", nil, "```json\n{\"a\": 1}\n```", `{"a": 1}`, false},
+		{"code fence without language", nil, "  ```\n{\"a\": 1}\n```\n", `{"a": 1}`, false},
+		{"code fence kept", map[string]string{"strip_code_fence": "false"}, "```json\n{\"a\": 1}\n```", "", true},
+	} {
+		response, err := processResponse(t, NewJSONValidate(), c.opts, c.response)
+		if c.rejected {
+			if err == nil || err.Code != api.TurnErrorCodeResponseRejected {
+				t.Errorf("%s: err = %v, want the response rejected", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if response != c.want {
+			t.Errorf("%s: response = %q, want %q", c.name, response, c.want)
+		}
+	}
+}
+
+func TestStripCodeFence(t *testing.T) {
+	for s, want := range map[string]string{
+		"{}":               "{}",
+		"```":              "```",
+		"``````":           "",
+		"```\n{}\n```":     "{}",
+		"```js\n{}```":     "{}",
+		"``` {} ```":       "{}",
+		"text\n```\n{}```": "text\n```\n{}```",
+	} {
+		if got := stripCodeFence(s); got != want {
+			t.Errorf("stripCodeFence(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
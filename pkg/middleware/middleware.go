@@ -1,41 +1,129 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pandodao/botastic/api"
 	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/llms"
+	"github.com/pandodao/botastic/storage"
 )
 
 const (
 	generalOptionTimeoutSeconds   = "timeout_seconds"
 	generalOptionTerminateIfError = "terminate_if_error"
+	generalOptionWhen             = "when"
 )
 
+// templateFuncs are available in the option templates.
+var templateFuncs = template.FuncMap{
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"matches": func(pattern, s string) (bool, error) {
+		return regexp.MatchString(pattern, s)
+	},
+	"json": func(v any) (string, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	},
+}
+
+// middlewareIDKey is the context key of the id of the processed middleware in
+// the bot config.
+type middlewareIDKey struct{}
+
+// requestKey is the context key of the request the processed middleware sees,
+// rewritten by the middlewares it depends on.
+type requestKey struct{}
+
+// turnRequest returns the request the processed middleware sees, which is the
+// request of the turn unless the middlewares it depends on rewrote it.
+func turnRequest(ctx context.Context, turn *models.Turn) string {
+	if v, ok := ctx.Value(requestKey{}).(string); ok {
+		return v
+	}
+	return turn.Request
+}
+
+// BlockError is returned by middlewares blocking the request, which ends the
+// flow. The turn responds Response if set, and fails otherwise.
+type BlockError struct {
+	Reason   string
+	Response string
+}
+
+func (e *BlockError) Error() string {
+	return "request blocked: " + e.Reason
+}
+
 type Middleware interface {
 	Desc() *api.MiddlewareDesc
 	Process(context.Context, map[string]*api.MiddlewareDescOption, *models.Turn) (string, map[string]any, error)
 }
 
+// RequestRewriter is implemented by the middlewares rewriting the request,
+// e.g. expanding the query, translating it or correcting its spelling.
+// ProcessRequest is called instead of Process and also returns the new
+// request, empty to keep it, which the middlewares depending on it and the
+// chat model see instead. Their descriptions should set RewritesRequest for
+// the router to see the rewritten request.
+type RequestRewriter interface {
+	Middleware
+	ProcessRequest(context.Context, map[string]*api.MiddlewareDescOption, *models.Turn) (request string, result string, extraData map[string]any, err error)
+}
+
+// OptionsValidator is implemented by the middlewares whose options depend on
+// each other, ValidateOptions checks them once they are parsed. The options
+// holding templates have a nil Value when a config is validated.
+type OptionsValidator interface {
+	ValidateOptions(map[string]*api.MiddlewareDescOption) error
+}
+
 type Handler struct {
-	ms []Middleware
-	mm map[string]Middleware
+	sh    *storage.Handler
+	llmsh *llms.Handler
+	ms    []Middleware
+	mm    map[string]Middleware
+	rms   []ResponseMiddleware
+	rmm   map[string]ResponseMiddleware
 }
 
-func New(ms ...Middleware) *Handler {
+func New(sh *storage.Handler, llmsh *llms.Handler, ms []Middleware, rms []ResponseMiddleware) *Handler {
 	h := &Handler{
-		ms: ms,
-		mm: map[string]Middleware{},
+		sh:    sh,
+		llmsh: llmsh,
+		ms:    ms,
+		mm:    map[string]Middleware{},
+		rms:   rms,
+		rmm:   map[string]ResponseMiddleware{},
 	}
 
 	for _, m := range h.ms {
 		h.mm[m.Desc().Name] = m
 	}
+	for _, m := range h.rms {
+		h.rmm[m.Desc().Name] = m
+	}
 	return h
 }
 
@@ -66,92 +154,471 @@ func (h *Handler) GeneralOptions() []*api.MiddlewareDescOption {
 				return strconv.Atoi(v)
 			},
 		},
+		{
+			Name:         generalOptionWhen,
+			Desc:         "template deciding whether to run the middleware, e.g. {{contains .Request \"weather\"}}, it is skipped if empty, false, 0 or no",
+			DefaultValue: "true",
+			ParseValueFunc: func(v string) (any, error) {
+				switch strings.ToLower(v) {
+				case "", "false", "0", "no":
+					return false, nil
+				}
+				return true, nil
+			},
+		},
 	}
 }
 
+// task is the execution of a middleware item of a config.
+type task struct {
+	index  int
+	item   *api.Middleware
+	result *api.MiddlewareResult
+	done   chan struct{}
+}
+
+// Process runs the middlewares of the config, each as soon as the middlewares
+// it depends on succeeded, so independent middlewares run concurrently. The
+// results are in config order, middlewares which did not start because the
+// flow terminated have none. A middleware sees the request as rewritten by
+// the last middleware in config order it depends on that rewrote it.
+// Middlewares whose when option is false, not selected by the router of the
+// config or depending on a skipped middleware are skipped. The middlewares
+// rewriting the request and their dependencies are not routed, they run
+// before the router, which sees the request they rewrote.
 func (h *Handler) Process(ctx context.Context, mc api.MiddlewareConfig, turn *models.Turn) ([]*api.MiddlewareResult, bool) {
-	rs := []*api.MiddlewareResult{}
-	for _, item := range mc.Items {
-		r := &api.MiddlewareResult{
-			Middleware: *item,
-		}
-		generalOptions, options, err := h.validateMiddleware(item)
-		if err != nil {
-			r.Code = api.MiddlewareErrorCodeConfigInvalid
-			r.Err = err.Error()
+	if err := checkDependencies(mc.Items); err != nil {
+		rs := make([]*api.MiddlewareResult, 0, len(mc.Items))
+		for _, item := range mc.Items {
+			rs = append(rs, &api.MiddlewareResult{
+				Middleware: *item,
+				Code:       api.MiddlewareErrorCodeConfigInvalid,
+				Err:        err.Error(),
+			})
 		}
-		rs = append(rs, r)
+		return rs, false
+	}
 
-		terminateIfError, ok := generalOptions[generalOptionTerminateIfError].Value.(bool)
-		if !ok {
-			terminateIfError = true
-		}
-		if terminateIfError && r.Code != 0 {
-			return rs, false
+	// the results of the dependencies are added per middleware
+	baseData := h.templateData(ctx, turn)
+
+	var (
+		rewriters map[string]bool
+		selected  map[string]bool
+		routed    chan struct{}
+	)
+	if mc.Router != nil {
+		rewriters = h.rewritingItems(mc.Items)
+		routed = make(chan struct{})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tasks := make([]*task, 0, len(mc.Items))
+	taskMap := make(map[string]*task, len(mc.Items))
+	for i, item := range mc.Items {
+		t := &task{
+			index: i,
+			item:  cloneItem(item),
+			done:  make(chan struct{}),
 		}
+		tasks = append(tasks, t)
+		taskMap[item.ID] = t
+	}
 
-		result, extraData, err := func() (string, map[string]any, error) {
-			timeoutSeconds := generalOptions[generalOptionTimeoutSeconds].Value.(int)
-			ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
-			defer cancel()
+	var (
+		wg         sync.WaitGroup
+		terminated atomic.Bool
+	)
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t *task) {
+			defer wg.Done()
+			defer close(t.done)
 
-			return h.mm[item.Name].Process(ctx, options, turn)
-		}()
-		if err != nil {
-			if errors.Is(err, context.DeadlineExceeded) {
-				r.Code = api.MiddlewareErrorCodeTimeout
-			} else {
-				r.Code = api.MiddlewareErrorCodeProcessFailed
+			for _, id := range t.item.DependsOn {
+				select {
+				case <-taskMap[id].done:
+				case <-ctx.Done():
+					return
+				}
 			}
-			r.Err = err.Error()
-			if terminateIfError {
-				return rs, false
+			if ctx.Err() != nil {
+				return
 			}
-		} else {
-			r.RenderData = map[string]any{
-				fmt.Sprintf("MIDDLEWARE_%s_RESULT", item.ID): result,
+
+			if routed != nil && !rewriters[t.item.ID] {
+				select {
+				case <-routed:
+				case <-ctx.Done():
+					return
+				}
+				if !selected[t.item.ID] {
+					t.result = skippedResult(t.item, "not selected by router")
+					return
+				}
+			}
+			if !h.processTask(ctx, t, taskMap, baseData, turn) {
+				terminated.Store(true)
+				cancel()
+			}
+		}(t)
+	}
+	if routed != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			request := turn.Request
+			for _, t := range tasks {
+				if !rewriters[t.item.ID] {
+					continue
+				}
+				select {
+				case <-t.done:
+				case <-ctx.Done():
+					return
+				}
+				if t.result != nil && t.result.Code == 0 && t.result.Request != "" {
+					request = t.result.Request
+				}
 			}
-			for k, v := range extraData {
-				r.RenderData[fmt.Sprintf("MIDDLEWARE_%s_DATA_%s", item.ID, strings.ToUpper(k))] = v
+			if turn.Redaction != nil {
+				request = turn.Redaction.Redact(request)
 			}
+
+			selected = h.route(context.WithValue(ctx, requestKey{}, request), mc, turn, rewriters)
+			close(routed)
+		}()
+	}
+	wg.Wait()
+
+	rs := make([]*api.MiddlewareResult, 0, len(tasks))
+	for _, t := range tasks {
+		if t.result != nil {
+			rs = append(rs, t.result)
+		}
+	}
+	return rs, !terminated.Load()
+}
+
+// processTask runs the middleware of the task once its dependencies are done,
+// and reports whether the flow can go on.
+func (h *Handler) processTask(ctx context.Context, t *task, taskMap map[string]*task, baseData map[string]any, turn *models.Turn) bool {
+	item := t.item
+	r := &api.MiddlewareResult{
+		Middleware: *item,
+	}
+	t.result = r
+
+	for _, id := range item.DependsOn {
+		dep := taskMap[id].result
+		if dep != nil && dep.Code == api.MiddlewareErrorCodeSkipped {
+			t.result = skippedResult(item, fmt.Sprintf("dependency %s skipped", id))
+			return true
+		}
+		if dep == nil || dep.Code != 0 {
+			r.Code = api.MiddlewareErrorCodeDependencyFailed
+			r.Err = fmt.Sprintf("dependency %s failed", id)
+			break
+		}
+	}
+
+	// the options can refer to the results of the dependencies
+	data := make(map[string]any, len(baseData))
+	for k, v := range baseData {
+		data[k] = v
+	}
+	request := turn.Request
+	if r.Code == 0 {
+		dependencyData(item, taskMap, data)
+		if dep := lastRewrite(item, taskMap); dep != nil {
+			request = dep.result.Request
+		}
+	}
+	data["Request"] = request
+
+	generalOptions, options, err := h.parseMiddleware(item, data)
+	if err != nil && r.Code == 0 {
+		r.Code = api.MiddlewareErrorCodeConfigInvalid
+		r.Err = err.Error()
+	}
+
+	terminateIfError := true
+	if opt, ok := generalOptions[generalOptionTerminateIfError]; ok {
+		terminateIfError, _ = opt.Value.(bool)
+	}
+	if r.Code != 0 {
+		return !terminateIfError
+	}
+	if !generalOptions[generalOptionWhen].Value.(bool) {
+		t.result = skippedResult(item, "when is false")
+		return true
+	}
+
+	rewritten, result, extraData, err := func() (string, string, map[string]any, error) {
+		timeoutSeconds := generalOptions[generalOptionTimeoutSeconds].Value.(int)
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+		defer cancel()
+		ctx = context.WithValue(ctx, middlewareIDKey{}, item.ID)
+		ctx = context.WithValue(ctx, requestKey{}, request)
+
+		m := h.mm[item.Name]
+		if rw, ok := m.(RequestRewriter); ok {
+			return rw.ProcessRequest(ctx, options, turn)
+		}
+		result, extraData, err := m.Process(ctx, options, turn)
+		return "", result, extraData, err
+	}()
+	var blockErr *BlockError
+	switch {
+	case errors.As(err, &blockErr):
+		r.Code = api.MiddlewareErrorCodeBlocked
+		r.Err = err.Error()
+		r.Response = blockErr.Response
+		return false
+	case err != nil:
+		if errors.Is(err, context.DeadlineExceeded) {
+			r.Code = api.MiddlewareErrorCodeTimeout
+		} else {
+			r.Code = api.MiddlewareErrorCodeProcessFailed
 		}
+		r.Err = err.Error()
+		return !terminateIfError
 	}
 
-	return rs, true
+	if rewritten != request {
+		r.Request = rewritten
+	}
+	r.RenderData = map[string]any{
+		fmt.Sprintf("MIDDLEWARE_%s_RESULT", item.ID): result,
+	}
+	for k, v := range extraData {
+		r.RenderData[fmt.Sprintf("MIDDLEWARE_%s_DATA_%s", item.ID, strings.ToUpper(k))] = v
+	}
+	return true
+}
+
+// cloneItem copies the item to parse its options, parsing sets the default
+// options and the config can be shared by concurrent turns.
+func cloneItem(item *api.Middleware) *api.Middleware {
+	v := *item
+	v.Options = make(map[string]string, len(item.Options))
+	for k, o := range item.Options {
+		v.Options[k] = o
+	}
+	return &v
+}
+
+// templateData returns the data of the option templates, the request and
+// the conversation of the turn.
+func (h *Handler) templateData(ctx context.Context, turn *models.Turn) map[string]any {
+	data := map[string]any{
+		"Request": turn.Request,
+		"Conv":    api.Conv{},
+	}
+	if turn.ConvID != uuid.Nil {
+		conv, err := h.sh.GetConv(ctx, turn.ConvID)
+		if err == nil && conv != nil {
+			data["Conv"] = conv.API()
+		}
+	}
+	return data
+}
+
+// skippedResult is the result of a skipped middleware, whose result renders
+// empty.
+func skippedResult(item *api.Middleware, reason string) *api.MiddlewareResult {
+	return &api.MiddlewareResult{
+		Middleware: *item,
+		Code:       api.MiddlewareErrorCodeSkipped,
+		Err:        reason,
+		RenderData: map[string]any{
+			fmt.Sprintf("MIDDLEWARE_%s_RESULT", item.ID): "",
+		},
+	}
+}
+
+// dependencyData collects the render data of the direct and indirect
+// dependencies of the item, which are all done.
+func dependencyData(item *api.Middleware, taskMap map[string]*task, data map[string]any) {
+	for _, id := range item.DependsOn {
+		dep := taskMap[id]
+		for k, v := range dep.result.RenderData {
+			data[k] = v
+		}
+		dependencyData(dep.item, taskMap, data)
+	}
+}
+
+// rewritingItems returns the ids of the items whose middlewares rewrite the
+// request, and of the items they depend on.
+func (h *Handler) rewritingItems(items []*api.Middleware) map[string]bool {
+	itemMap := make(map[string]*api.Middleware, len(items))
+	for _, item := range items {
+		itemMap[item.ID] = item
+	}
+
+	ids := map[string]bool{}
+	var add func(item *api.Middleware)
+	add = func(item *api.Middleware) {
+		if ids[item.ID] {
+			return
+		}
+		ids[item.ID] = true
+		for _, id := range item.DependsOn {
+			add(itemMap[id])
+		}
+	}
+	for _, item := range items {
+		if m, ok := h.mm[item.Name]; ok && m.Desc().RewritesRequest {
+			add(item)
+		}
+	}
+	return ids
+}
+
+// lastRewrite returns the last task in config order among the direct and
+// indirect dependencies of the item that rewrote the request, nil if none did.
+func lastRewrite(item *api.Middleware, taskMap map[string]*task) *task {
+	var last *task
+	for _, id := range item.DependsOn {
+		dep := taskMap[id]
+		if dep.result.Request != "" && (last == nil || dep.index > last.index) {
+			last = dep
+		}
+		if t := lastRewrite(dep.item, taskMap); t != nil && (last == nil || t.index > last.index) {
+			last = t
+		}
+	}
+	return last
+}
+
+// checkDependencies checks that the middlewares only depend on other
+// middlewares of the config, without cycles.
+func checkDependencies(items []*api.Middleware) error {
+	itemMap := make(map[string]*api.Middleware, len(items))
+	for _, item := range items {
+		if _, ok := itemMap[item.ID]; ok {
+			return fmt.Errorf("duplicate middleware id: %s", item.ID)
+		}
+		itemMap[item.ID] = item
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(items))
+	var visit func(item *api.Middleware) error
+	visit = func(item *api.Middleware) error {
+		switch state[item.ID] {
+		case visiting:
+			return fmt.Errorf("middleware %s has a dependency cycle", item.ID)
+		case visited:
+			return nil
+		}
+
+		state[item.ID] = visiting
+		for _, id := range item.DependsOn {
+			dep, ok := itemMap[id]
+			if !ok {
+				return fmt.Errorf("middleware %s depends on unknown middleware: %s", item.ID, id)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[item.ID] = visited
+		return nil
+	}
+	for _, item := range items {
+		if err := visit(item); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (h *Handler) ValidateConfig(mc *api.MiddlewareConfig) error {
-	idMap := map[string]bool{}
 	for _, item := range mc.Items {
-		if item.Options == nil {
-			item.Options = map[string]string{}
+		if _, _, err := h.parseMiddleware(item, nil); err != nil {
+			return err
 		}
-
-		if _, _, err := h.validateMiddleware(item); err != nil {
+	}
+	for _, item := range mc.ResponseItems {
+		if _, _, err := h.parseResponseMiddleware(item, nil); err != nil {
 			return err
 		}
+	}
+	if mc.Router != nil {
+		if _, err := h.llmsh.GetChatModel(mc.Router.ChatModel); err != nil {
+			return fmt.Errorf("router chat model does not exist: %s", mc.Router.ChatModel)
+		}
+	}
 
-		if idMap[item.ID] {
-			return fmt.Errorf("duplicate middleware id: %s", item.ID)
+	if err := checkDependencies(mc.Items); err != nil {
+		return err
+	}
+	redacts := 0
+	for _, item := range mc.Items {
+		if item.Name == redactName {
+			redacts++
 		}
-		idMap[item.ID] = true
+	}
+	if redacts > 1 {
+		return fmt.Errorf("only one %s middleware is allowed", redactName)
 	}
 
+	ids := make(map[string]bool, len(mc.Items)+len(mc.ResponseItems))
+	for _, item := range append(mc.Items, mc.ResponseItems...) {
+		if ids[item.ID] {
+			return fmt.Errorf("duplicate middleware id: %s", item.ID)
+		}
+		ids[item.ID] = true
+	}
 	return nil
 }
 
-func (h *Handler) validateMiddleware(item *api.Middleware) (map[string]*api.MiddlewareDescOption, map[string]*api.MiddlewareDescOption, error) {
+// parseMiddleware parses the options of the item. Options holding templates
+// are rendered with data first, or only checked if data is nil.
+func (h *Handler) parseMiddleware(item *api.Middleware, data map[string]any) (map[string]*api.MiddlewareDescOption, map[string]*api.MiddlewareDescOption, error) {
 	m, ok := h.mm[item.Name]
 	if !ok {
 		return nil, nil, fmt.Errorf("unknown middleware: %s", item.Name)
 	}
+	generalOptions, middlewareOptions, err := h.parseItem(item, m.Desc(), data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v, ok := m.(OptionsValidator); ok {
+		if err := v.ValidateOptions(middlewareOptions); err != nil {
+			return nil, nil, fmt.Errorf("invalid options, middleware: %s, err: %w", item.Name, err)
+		}
+	}
+	return generalOptions, middlewareOptions, nil
+}
 
-	generalOptions, err := parseOptions(item.Name, h.GeneralOptions(), item.Options)
+func (h *Handler) parseResponseMiddleware(item *api.Middleware, data map[string]any) (map[string]*api.MiddlewareDescOption, map[string]*api.MiddlewareDescOption, error) {
+	m, ok := h.rmm[item.Name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown response middleware: %s", item.Name)
+	}
+	return h.parseItem(item, m.Desc(), data)
+}
+
+func (h *Handler) parseItem(item *api.Middleware, desc *api.MiddlewareDesc, data map[string]any) (map[string]*api.MiddlewareDescOption, map[string]*api.MiddlewareDescOption, error) {
+	if item.Options == nil {
+		item.Options = map[string]string{}
+	}
+
+	generalOptions, err := parseOptions(item.Name, h.GeneralOptions(), item.Options, data)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to parse general options, middleware: %s, err: %w", item.Name, err)
 	}
 
-	middlewareOptions, err := parseOptions(item.Name, m.Desc().Options, item.Options)
+	middlewareOptions, err := parseOptions(item.Name, desc.Options, item.Options, data)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to parse options, middleware: %s, err: %w", item.Name, err)
 	}
@@ -159,7 +626,7 @@ func (h *Handler) validateMiddleware(item *api.Middleware) (map[string]*api.Midd
 	return generalOptions, middlewareOptions, nil
 }
 
-func parseOptions(name string, descOptions []*api.MiddlewareDescOption, opts map[string]string) (map[string]*api.MiddlewareDescOption, error) {
+func parseOptions(name string, descOptions []*api.MiddlewareDescOption, opts map[string]string, data map[string]any) (map[string]*api.MiddlewareDescOption, error) {
 	result := map[string]*api.MiddlewareDescOption{}
 	for _, opt := range descOptions {
 		opts[opt.Name] = strings.TrimSpace(opts[opt.Name])
@@ -170,12 +637,37 @@ func parseOptions(name string, descOptions []*api.MiddlewareDescOption, opts map
 			opts[opt.Name] = opt.DefaultValue
 		}
 
+		v := opts[opt.Name]
+		if opt.PrepareFunc != nil {
+			pv, err := opt.PrepareFunc(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to prepare option: %s, middleware: %s, err: %w", opt.Name, name, err)
+			}
+			v = pv
+		}
+		if !opt.Raw && strings.Contains(v, "{{") {
+			t, err := template.New(opt.Name).Funcs(templateFuncs).Option("missingkey=error").Parse(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse option template: %s, middleware: %s, err: %w", opt.Name, name, err)
+			}
+			if data == nil {
+				result[opt.Name] = opt
+				continue
+			}
+
+			var buf bytes.Buffer
+			if err := t.Execute(&buf, data); err != nil {
+				return nil, fmt.Errorf("failed to render option template: %s, middleware: %s, err: %w", opt.Name, name, err)
+			}
+			v = strings.TrimSpace(buf.String())
+		}
+
 		if opt.ParseValueFunc != nil {
-			v, err := opt.ParseValueFunc(opts[opt.Name])
+			pv, err := opt.ParseValueFunc(v)
 			if err != nil {
 				return nil, fmt.Errorf("failed to parse option: %s, middleware: %s, err: %w", opt.Name, name, err)
 			}
-			opt.Value = v
+			opt.Value = pv
 		}
 		result[opt.Name] = opt
 	}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	item := func(id string, deps ...string) *api.Middleware {
+		return &api.Middleware{ID: id, Name: "test", DependsOn: deps}
+	}
+	for _, c := range []struct {
+		name  string
+		items []*api.Middleware
+		err   string
+	}{
+		{"empty", nil, ""},
+		{"independent", []*api.Middleware{item("a"), item("b")}, ""},
+		{"diamond", []*api.Middleware{item("d", "b", "c"), item("b", "a"), item("c", "a"), item("a")}, ""},
+		{"duplicate id", []*api.Middleware{item("a"), item("a")}, "duplicate middleware id: a"},
+		{"unknown", []*api.Middleware{item("a", "x")}, "middleware a depends on unknown middleware: x"},
+		{"self", []*api.Middleware{item("a", "a")}, "dependency cycle"},
+		{"cycle", []*api.Middleware{item("a"), item("b", "a", "d"), item("c", "b"), item("d", "c")}, "dependency cycle"},
+	} {
+		err := checkDependencies(c.items)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestLastRewrite(t *testing.T) {
+	// the tasks in config order, with the request they rewrote if any
+	taskMap := map[string]*task{}
+	add := func(id, request string, deps ...string) *api.Middleware {
+		item := &api.Middleware{ID: id, Name: "test", DependsOn: deps}
+		taskMap[id] = &task{
+			index:  len(taskMap),
+			item:   item,
+			result: &api.MiddlewareResult{Middleware: *item, Request: request},
+		}
+		return item
+	}
+	add("redact", "redacted")
+	add("search", "", "redact")
+	add("translate", "translated", "redact")
+	add("plain", "")
+	add("rewrite", "rewritten", "plain")
+	add("summary", "", "translate")
+
+	for _, c := range []struct {
+		item *api.Middleware
+		want string
+	}{
+		{&api.Middleware{ID: "none"}, ""},
+		{&api.Middleware{ID: "x", DependsOn: []string{"plain"}}, ""},
+		{&api.Middleware{ID: "x", DependsOn: []string{"redact"}}, "redact"},
+		// indirect dependencies count
+		{&api.Middleware{ID: "x", DependsOn: []string{"search"}}, "redact"},
+		{&api.Middleware{ID: "x", DependsOn: []string{"summary"}}, "translate"},
+		// the last one in config order wins, whatever the order of depends_on
+		{&api.Middleware{ID: "x", DependsOn: []string{"translate", "redact"}}, "translate"},
+		{&api.Middleware{ID: "x", DependsOn: []string{"rewrite", "summary"}}, "rewrite"},
+		{&api.Middleware{ID: "x", DependsOn: []string{"search", "plain"}}, "redact"},
+	} {
+		got := ""
+		if last := lastRewrite(c.item, taskMap); last != nil {
+			got = last.item.ID
+		}
+		if got != c.want {
+			t.Errorf("lastRewrite(%v) = %q, want %q", c.item.DependsOn, got, c.want)
+		}
+	}
+}
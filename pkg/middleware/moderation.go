@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/llms"
+	llmapi "github.com/pandodao/botastic/pkg/llms/api"
+)
+
+// moderationClassifierRules is the classifier of the local rule set.
+const moderationClassifierRules = "rules"
+
+type Moderation struct {
+	llmsh *llms.Handler
+}
+
+func NewModeration(llmsh *llms.Handler) *Moderation {
+	return &Moderation{
+		llmsh: llmsh,
+	}
+}
+
+func (m *Moderation) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name: "moderation",
+		Desc: "blocks the requests flagged by a classifier, either the moderation endpoint of an llm or a local rule set",
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name:         "classifier",
+				Desc:         "rules, or the name of an enabled llm with a moderation endpoint, e.g. openai-1",
+				DefaultValue: moderationClassifierRules,
+				ParseValueFunc: func(v string) (any, error) {
+					if v == moderationClassifierRules {
+						return v, nil
+					}
+					if _, err := m.llmsh.GetModerator(v); err != nil {
+						return nil, fmt.Errorf("llm %s has no moderation endpoint", v)
+					}
+					return v, nil
+				},
+			},
+			{
+				Name: "rules",
+				Desc: "rules of the rules classifier, one \"category: regular expression\" per line, a match scores 1",
+				ParseValueFunc: func(v string) (any, error) {
+					return parseModerationRules(v)
+				},
+			},
+			{
+				Name: "categories",
+				Desc: "comma separated categories to check, all if empty",
+				ParseValueFunc: func(v string) (any, error) {
+					categories := map[string]bool{}
+					for _, c := range strings.Split(v, ",") {
+						if c = strings.TrimSpace(c); c != "" {
+							categories[c] = true
+						}
+					}
+					return categories, nil
+				},
+			},
+			{
+				Name:         "threshold",
+				Desc:         "the request is flagged if the score of a category reaches the threshold, greater than 0 and at most 1",
+				DefaultValue: "0.5",
+				ParseValueFunc: func(v string) (any, error) {
+					f, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						return nil, err
+					}
+					// every score reaches 0, which would flag all requests
+					if f <= 0 || f > 1 {
+						return nil, fmt.Errorf("threshold must be greater than 0 and at most 1")
+					}
+					return f, nil
+				},
+			},
+			{
+				Name: "response",
+				Desc: "canned response of flagged requests, which fail the turn if empty",
+				ParseValueFunc: func(v string) (any, error) {
+					return v, nil
+				},
+			},
+		},
+	}
+}
+
+// ValidateOptions checks that the rules classifier has rules, it would never
+// flag anything otherwise.
+func (m *Moderation) ValidateOptions(opts map[string]*api.MiddlewareDescOption) error {
+	if opts["classifier"].Value != moderationClassifierRules {
+		return nil
+	}
+	if rules, ok := opts["rules"].Value.([]*moderationRule); ok && len(rules) == 0 {
+		return fmt.Errorf("the %s classifier requires rules", moderationClassifierRules)
+	}
+	return nil
+}
+
+type moderationRule struct {
+	category string
+	re       *regexp.Regexp
+}
+
+func parseModerationRules(v string) ([]*moderationRule, error) {
+	var rules []*moderationRule
+	for _, line := range strings.Split(v, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		category, pattern, ok := strings.Cut(line, ":")
+		category, pattern = strings.TrimSpace(category), strings.TrimSpace(pattern)
+		if !ok || category == "" || pattern == "" {
+			return nil, fmt.Errorf("invalid rule %q, must be category: regular expression", line)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", line, err)
+		}
+		rules = append(rules, &moderationRule{category: category, re: re})
+	}
+	return rules, nil
+}
+
+func (m *Moderation) Process(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, map[string]any, error) {
+	request := turnRequest(ctx, turn)
+	var scores map[string]float64
+	if classifier := opts["classifier"].Value.(string); classifier == moderationClassifierRules {
+		scores = map[string]float64{}
+		for _, rule := range opts["rules"].Value.([]*moderationRule) {
+			if rule.re.MatchString(request) {
+				scores[rule.category] = 1
+			}
+		}
+	} else {
+		moderator, err := m.llmsh.GetModerator(classifier)
+		if err != nil {
+			return "", nil, err
+		}
+		var r *llmapi.ModerationResult
+		if r, err = moderator.Moderate(ctx, request); err != nil {
+			return "", nil, err
+		}
+		scores = r.Scores
+	}
+
+	categories := opts["categories"].Value.(map[string]bool)
+	threshold := opts["threshold"].Value.(float64)
+	var flagged []string
+	for category, score := range scores {
+		if (len(categories) == 0 || categories[category]) && score >= threshold {
+			flagged = append(flagged, category)
+		}
+	}
+	if len(flagged) > 0 {
+		sort.Strings(flagged)
+		return "", nil, &BlockError{
+			Reason:   "flagged as " + strings.Join(flagged, ", "),
+			Response: opts["response"].Value.(string),
+		}
+	}
+
+	return "", map[string]any{
+		"scores": scores,
+	}, nil
+}
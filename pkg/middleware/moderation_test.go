@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+const testModerationRules = `violence: (?i)\bkill\b
+spam: (?i)buy now`
+
+func TestModerationRules(t *testing.T) {
+	h := New(nil, nil, []Middleware{NewModeration(nil)}, nil)
+	for _, c := range []struct {
+		name    string
+		opts    map[string]string
+		request string
+		blocked string
+	}{
+		{"no match", map[string]string{}, "hello", ""},
+		{"match", map[string]string{}, "I will KILL it", "request blocked: flagged as violence"},
+		{"several matches", map[string]string{}, "buy now or I kill", "request blocked: flagged as spam, violence"},
+		{"word boundaries", map[string]string{}, "skills", ""},
+		{"other categories", map[string]string{"categories": "spam"}, "I will kill it", ""},
+		{"checked categories", map[string]string{"categories": "spam, violence"}, "I will kill it", "request blocked: flagged as violence"},
+	} {
+		c.opts["rules"] = testModerationRules
+		rs, ok := h.Process(context.Background(), api.MiddlewareConfig{
+			Items: []*api.Middleware{{ID: "mod", Name: "moderation", Options: c.opts}},
+		}, &models.Turn{Request: c.request})
+		switch {
+		case c.blocked == "" && (!ok || rs[0].Code != 0):
+			t.Errorf("%s: result = %+v, want passed", c.name, rs[0])
+		case c.blocked != "" && (ok || rs[0].Code != api.MiddlewareErrorCodeBlocked || rs[0].Err != c.blocked):
+			t.Errorf("%s: result = %+v, want %q", c.name, rs[0], c.blocked)
+		}
+	}
+}
+
+func TestModerationCannedResponse(t *testing.T) {
+	after := &testMiddleware{name: "after"}
+	h := New(nil, nil, []Middleware{NewModeration(nil), after}, nil)
+	rs, ok := h.Process(context.Background(), api.MiddlewareConfig{
+		Items: []*api.Middleware{
+			{ID: "mod", Name: "moderation", Options: map[string]string{
+				"rules":    testModerationRules,
+				"response": "Let's talk about something else.",
+			}},
+			{ID: "after", Name: "after", DependsOn: []string{"mod"}},
+		},
+	}, &models.Turn{Request: "kill"})
+	if ok {
+		t.Fatal("the request is not blocked")
+	}
+	if rs[0].Code != api.MiddlewareErrorCodeBlocked || rs[0].Response != "Let's talk about something else." {
+		t.Errorf("result = %+v, want the canned response", rs[0])
+	}
+	if seen := after.seen(); len(seen) != 0 {
+		t.Errorf("the blocked request is processed by the next middleware: %v", seen)
+	}
+}
+
+func TestModerationInvalidOptions(t *testing.T) {
+	h := New(nil, nil, []Middleware{NewModeration(nil)}, nil)
+	for _, opts := range []map[string]string{
+		{},
+		{"rules": "\n  \n"},
+		{"rules": "violence"},
+		{"rules": "violence: ("},
+		{"rules": testModerationRules, "threshold": "0"},
+		{"rules": testModerationRules, "threshold": "1.5"},
+	} {
+		err := h.ValidateConfig(&api.MiddlewareConfig{
+			Items: []*api.Middleware{{ID: "mod", Name: "moderation", Options: opts}},
+		})
+		if err == nil {
+			t.Errorf("options %v are valid, want an error", opts)
+		}
+	}
+
+	if err := h.ValidateConfig(&api.MiddlewareConfig{
+		Items: []*api.Middleware{{ID: "mod", Name: "moderation", Options: map[string]string{"rules": testModerationRules, "threshold": "1"}}},
+	}); err != nil {
+		t.Error(err)
+	}
+}
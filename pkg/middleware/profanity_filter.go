@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+const (
+	profanityActionMask   = "mask"
+	profanityActionReject = "reject"
+
+	defaultProfanityWords = "fuck,fucking,shit,bitch,bastard,asshole,cunt,dick,motherfucker"
+)
+
+type ProfanityFilter struct{}
+
+func NewProfanityFilter() *ProfanityFilter {
+	return &ProfanityFilter{}
+}
+
+func (m *ProfanityFilter) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name: "profanity-filter",
+		Desc: "masks the listed words in the response, or rejects the response containing them",
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name:         "words",
+				Desc:         "comma separated words to filter, matched as whole words ignoring case",
+				DefaultValue: defaultProfanityWords,
+				ParseValueFunc: func(v string) (any, error) {
+					var words []string
+					for _, w := range strings.Split(v, ",") {
+						if w = strings.TrimSpace(w); w != "" {
+							words = append(words, regexp.QuoteMeta(w))
+						}
+					}
+					if len(words) == 0 {
+						return nil, fmt.Errorf("words cannot be empty")
+					}
+					return regexp.Compile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+				},
+			},
+			{
+				Name:         "action",
+				Desc:         "mask the words with * or reject the response",
+				DefaultValue: profanityActionMask,
+				ParseValueFunc: func(v string) (any, error) {
+					switch v {
+					case profanityActionMask, profanityActionReject:
+						return v, nil
+					}
+					return nil, fmt.Errorf("invalid value %s, must be one of mask, reject", v)
+				},
+			},
+		},
+	}
+}
+
+func (m *ProfanityFilter) ProcessResponse(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn, response string) (string, error) {
+	re := opts["words"].Value.(*regexp.Regexp)
+	if opts["action"].Value.(string) == profanityActionReject {
+		if re.MatchString(response) {
+			return "", &RejectError{Reason: "response contains profanity"}
+		}
+		return response, nil
+	}
+
+	return re.ReplaceAllStringFunc(response, func(w string) string {
+		return strings.Repeat("*", len([]rune(w)))
+	}), nil
+}
@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+// redactName is the name of the redact middleware, a bot can have only one
+// item of it since it sets the redaction of the turn.
+const redactName = "redact"
+
+type redactPattern struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+// redactTypes are the builtin kinds of personal data, in the order they are
+// redacted, cards before phones since card numbers look like phone numbers.
+var redactTypes = []*redactPattern{
+	{
+		name: "email",
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		name:  "card",
+		re:    regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		valid: luhnValid,
+	},
+	{
+		name: "phone",
+		re:   regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)[\s.-]?|\b\d{2,4}[\s.-])\d{3,4}[\s.-]?\d{3,4}\b|\+\d{8,15}\b`),
+	},
+}
+
+type Redact struct{}
+
+func NewRedact() *Redact {
+	return &Redact{}
+}
+
+func (m *Redact) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name:            redactName,
+		Desc:            "replaces personal data in the request with placeholders before it is sent to the chat model, the unredact response middleware restores them",
+		RewritesRequest: true,
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name:         "types",
+				Desc:         "comma separated kinds of personal data to redact: email, phone, card",
+				DefaultValue: "email,phone,card",
+				ParseValueFunc: func(v string) (any, error) {
+					enabled := map[string]bool{}
+					for _, t := range strings.Split(v, ",") {
+						if t = strings.TrimSpace(t); t == "" {
+							continue
+						}
+						if !isRedactType(t) {
+							return nil, fmt.Errorf("invalid type %s, must be one of email, phone, card", t)
+						}
+						enabled[t] = true
+					}
+
+					var patterns []*redactPattern
+					for _, p := range redactTypes {
+						if enabled[p.name] {
+							patterns = append(patterns, p)
+						}
+					}
+					return patterns, nil
+				},
+			},
+			{
+				Name: "patterns",
+				Desc: "more data to redact, one \"name: regular expression\" per line, the name is used in the placeholders",
+				ParseValueFunc: func(v string) (any, error) {
+					return parseRedactPatterns(v)
+				},
+			},
+			{
+				Name:         "persist_redacted",
+				Desc:         "store the redacted request and response of the turn instead of the original ones",
+				DefaultValue: "false",
+				ParseValueFunc: func(v string) (any, error) {
+					return strconv.ParseBool(v)
+				},
+			},
+		},
+	}
+}
+
+func isRedactType(name string) bool {
+	for _, p := range redactTypes {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRedactPatterns(v string) ([]*redactPattern, error) {
+	var patterns []*redactPattern
+	for _, line := range strings.Split(v, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, pattern, ok := strings.Cut(line, ":")
+		name, pattern = strings.TrimSpace(name), strings.TrimSpace(pattern)
+		if !ok || name == "" || pattern == "" {
+			return nil, fmt.Errorf("invalid pattern %q, must be name: regular expression", line)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+		}
+		patterns = append(patterns, &redactPattern{name: name, re: re})
+	}
+	return patterns, nil
+}
+
+var (
+	placeholderNameReplacer = regexp.MustCompile(`[^A-Z0-9]+`)
+	placeholderPattern      = regexp.MustCompile(`\[([A-Z0-9_]+)_(\d+)\]`)
+)
+
+func (m *Redact) Process(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, map[string]any, error) {
+	_, result, extraData, err := m.ProcessRequest(ctx, opts, turn)
+	return result, extraData, err
+}
+
+// ProcessRequest rewrites the request to the redacted one, which is also the
+// result. The history of the turn is scanned too, so the data in it gets the
+// same placeholders for the whole chat request.
+func (m *Redact) ProcessRequest(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, string, map[string]any, error) {
+	var patterns []*redactPattern
+	patterns = append(patterns, opts["types"].Value.([]*redactPattern)...)
+	patterns = append(patterns, opts["patterns"].Value.([]*redactPattern)...)
+
+	r := newRedactor(patterns)
+	request := turnRequest(ctx, turn)
+	// the placeholders of the turns stored redacted are not reused, they
+	// stand for values which are not known anymore
+	for _, text := range turn.History {
+		r.reserve(text)
+	}
+	r.reserve(request)
+
+	for _, text := range turn.History {
+		r.redact(text)
+	}
+	request = r.redact(request)
+
+	turn.Redaction = &models.Redaction{
+		Values:  r.values,
+		Persist: opts["persist_redacted"].Value.(bool),
+	}
+	return request, request, map[string]any{
+		"counts": r.found,
+	}, nil
+}
+
+// redactor replaces the data matching its patterns with placeholders, the same
+// value always with the same placeholder.
+type redactor struct {
+	patterns     []*redactPattern
+	values       map[string]string
+	placeholders map[string]string
+	// counts are the last numbers of the placeholders by prefix
+	counts map[string]int
+	// found are the numbers of values found by pattern name
+	found map[string]int
+}
+
+func newRedactor(patterns []*redactPattern) *redactor {
+	return &redactor{
+		patterns:     patterns,
+		values:       map[string]string{},
+		placeholders: map[string]string{},
+		counts:       map[string]int{},
+		found:        map[string]int{},
+	}
+}
+
+// reserve makes the numbers of the placeholders already in text unavailable.
+func (r *redactor) reserve(text string) {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if n, _ := strconv.Atoi(match[2]); n > r.counts[match[1]] {
+			r.counts[match[1]] = n
+		}
+	}
+}
+
+func (r *redactor) redact(text string) string {
+	for _, p := range r.patterns {
+		prefix := placeholderNameReplacer.ReplaceAllString(strings.ToUpper(p.name), "_")
+		text = p.re.ReplaceAllStringFunc(text, func(v string) string {
+			if p.valid != nil && !p.valid(v) {
+				return v
+			}
+			if placeholder, ok := r.placeholders[v]; ok {
+				return placeholder
+			}
+			r.counts[prefix]++
+			r.found[p.name]++
+			placeholder := fmt.Sprintf("[%s_%d]", prefix, r.counts[prefix])
+			r.placeholders[v] = placeholder
+			r.values[placeholder] = v
+			return placeholder
+		})
+	}
+	return text
+}
+
+// luhnValid tells if the digits of s pass the Luhn check of card numbers.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+type Unredact struct{}
+
+func NewUnredact() *Unredact {
+	return &Unredact{}
+}
+
+func (m *Unredact) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name:    "unredact",
+		Desc:    "restores the personal data the redact middleware replaced with placeholders in the response",
+		Options: []*api.MiddlewareDescOption{},
+	}
+}
+
+func (m *Unredact) ProcessResponse(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn, response string) (string, error) {
+	if turn.Redaction == nil {
+		return response, nil
+	}
+	return turn.Redaction.Restore(response), nil
+}
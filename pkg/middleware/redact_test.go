@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+func TestLuhnValid(t *testing.T) {
+	tests := map[string]bool{
+		"4111 1111 1111 1111": true,
+		"4111-1111-1111-1111": true,
+		"5500005555555559":    true,
+		"378282246310005":     true,
+		"4111 1111 1111 1112": false,
+		"1234567812345678":    false,
+		"":                    false,
+		"- -":                 false,
+	}
+	for s, want := range tests {
+		if got := luhnValid(s); got != want {
+			t.Errorf("luhnValid(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func redactTurn(t *testing.T, opts map[string]string, turn *models.Turn) *api.MiddlewareResult {
+	t.Helper()
+	h := New(nil, nil, []Middleware{NewRedact()}, []ResponseMiddleware{NewUnredact()})
+	rs, _ := h.Process(context.Background(), api.MiddlewareConfig{
+		Items: []*api.Middleware{{ID: "r", Name: "redact", Options: opts}},
+	}, turn)
+	if rs[0].Code != 0 {
+		t.Fatalf("code = %d, err = %s", rs[0].Code, rs[0].Err)
+	}
+	return rs[0]
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string]string
+		request string
+		want    string
+		values  map[string]string
+	}{
+		{
+			name:    "builtin types",
+			request: "mail a@b.io or c.d@e.org, call +1 415-555-0100, pay with 4111 1111 1111 1111, again a@b.io",
+			want:    "mail [EMAIL_1] or [EMAIL_2], call [PHONE_1], pay with [CARD_1], again [EMAIL_1]",
+			values: map[string]string{
+				"[EMAIL_1]": "a@b.io",
+				"[EMAIL_2]": "c.d@e.org",
+				"[PHONE_1]": "+1 415-555-0100",
+				"[CARD_1]":  "4111 1111 1111 1111",
+			},
+		},
+		{
+			name:    "card numbers failing the luhn check are not cards",
+			opts:    map[string]string{"types": "card"},
+			request: "order 1234 5678 1234 5678",
+			want:    "order 1234 5678 1234 5678",
+			values:  map[string]string{},
+		},
+		{
+			name:    "selected types and patterns",
+			opts:    map[string]string{"types": "email", "patterns": "order id: ORD-\\d+\napi key: sk-[a-z0-9]+"},
+			request: "a@b.io asks about ORD-42 with sk-abc1, call 415-555-0100",
+			want:    "[EMAIL_1] asks about [ORDER_ID_1] with [API_KEY_1], call 415-555-0100",
+			values: map[string]string{
+				"[EMAIL_1]":    "a@b.io",
+				"[ORDER_ID_1]": "ORD-42",
+				"[API_KEY_1]":  "sk-abc1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turn := &models.Turn{Request: tt.request}
+			// the result is the redacted request, which is only set if it changed
+			redacted := redactTurn(t, tt.opts, turn).RenderData["MIDDLEWARE_r_RESULT"].(string)
+			if redacted != tt.want {
+				t.Errorf("request = %q, want %q", redacted, tt.want)
+			}
+			if !reflect.DeepEqual(turn.Redaction.Values, tt.values) {
+				t.Errorf("values = %v, want %v", turn.Redaction.Values, tt.values)
+			}
+			if got := turn.Redaction.Restore(redacted); got != tt.request {
+				t.Errorf("restored = %q, want %q", got, tt.request)
+			}
+		})
+	}
+}
+
+func TestRedactHistory(t *testing.T) {
+	turn := &models.Turn{
+		History: []string{
+			// stored redacted, the value of [EMAIL_1] is not known anymore
+			"I am [EMAIL_1]",
+			"Hello [EMAIL_1]",
+			// stored with the original text
+			"my colleague is bob@example.com",
+			"I will write to bob@example.com",
+		},
+		Request: "forward it to eve@example.com and bob@example.com",
+	}
+	r := redactTurn(t, map[string]string{"types": "email"}, turn)
+
+	if want := "forward it to [EMAIL_3] and [EMAIL_2]"; r.Request != want {
+		t.Errorf("request = %q, want %q", r.Request, want)
+	}
+	want := map[string]string{
+		"[EMAIL_2]": "bob@example.com",
+		"[EMAIL_3]": "eve@example.com",
+	}
+	if !reflect.DeepEqual(turn.Redaction.Values, want) {
+		t.Errorf("values = %v, want %v", turn.Redaction.Values, want)
+	}
+	if got := turn.Redaction.Redact(turn.History[3]); got != "I will write to [EMAIL_2]" {
+		t.Errorf("redacted history = %q", got)
+	}
+
+	// an echoed placeholder of an earlier turn is not filled with the data of
+	// this one
+	if got := turn.Redaction.Restore("[EMAIL_1], [EMAIL_2], [EMAIL_3]"); got != "[EMAIL_1], bob@example.com, eve@example.com" {
+		t.Errorf("restored = %q", got)
+	}
+}
+
+func TestUnredact(t *testing.T) {
+	h := New(nil, nil, []Middleware{NewRedact()}, []ResponseMiddleware{NewUnredact()})
+	mc := api.MiddlewareConfig{
+		Items:         []*api.Middleware{{ID: "r", Name: "redact"}},
+		ResponseItems: []*api.Middleware{{ID: "u", Name: "unredact"}},
+	}
+	turn := &models.Turn{Request: "I am a@b.io"}
+	results, _ := h.Process(context.Background(), mc, turn)
+
+	response, _, err := h.ProcessResponse(context.Background(), mc, turn, "Hi [EMAIL_1]!", results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Hi a@b.io!" {
+		t.Errorf("response = %q", response)
+	}
+
+	turn.Redaction = nil
+	if response, _, _ := h.ProcessResponse(context.Background(), mc, turn, "Hi [EMAIL_1]!", results); response != "Hi [EMAIL_1]!" {
+		t.Errorf("response without redaction = %q", response)
+	}
+}
+
+func TestRedactOptions(t *testing.T) {
+	h := New(nil, nil, []Middleware{NewRedact()}, nil)
+	for _, opts := range []map[string]string{
+		{"types": "email,ssn"},
+		{"patterns": "no separator"},
+		{"patterns": "bad: ("},
+		{"persist_redacted": "maybe"},
+	} {
+		mc := api.MiddlewareConfig{Items: []*api.Middleware{{ID: "r", Name: "redact", Options: opts}}}
+		if err := h.ValidateConfig(&mc); err == nil {
+			t.Errorf("options %v are valid, want error", opts)
+		}
+	}
+
+	mc := api.MiddlewareConfig{Items: []*api.Middleware{
+		{ID: "a", Name: "redact"},
+		{ID: "b", Name: "redact"},
+	}}
+	if err := h.ValidateConfig(&mc); err == nil {
+		t.Error("two redact items are valid, want error")
+	}
+}
+
+func TestRedactionRedact(t *testing.T) {
+	r := &models.Redaction{Values: map[string]string{
+		"[A_1]": "ann",
+		"[A_2]": "ann@x.io",
+	}}
+	if got := r.Redact("ann@x.io and ann"); got != "[A_2] and [A_1]" {
+		t.Errorf("Redact() = %q, the longer values must be replaced first", got)
+	}
+}
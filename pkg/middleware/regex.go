@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+const (
+	regexActionReject  = "reject"
+	regexActionRequire = "require"
+	regexActionReplace = "replace"
+)
+
+type Regex struct{}
+
+func NewRegex() *Regex {
+	return &Regex{}
+}
+
+func (m *Regex) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name: "regex",
+		Desc: "checks the response against a regular expression, rejecting it if it matches or does not match, or replacing the matches",
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name:     "pattern",
+				Desc:     "regular expression in go syntax",
+				Required: true,
+				ParseValueFunc: func(v string) (any, error) {
+					return regexp.Compile(v)
+				},
+			},
+			{
+				Name:         "action",
+				Desc:         "reject if the response matches, require a match, or replace the matches",
+				DefaultValue: regexActionReject,
+				ParseValueFunc: func(v string) (any, error) {
+					switch v {
+					case regexActionReject, regexActionRequire, regexActionReplace:
+						return v, nil
+					}
+					return nil, fmt.Errorf("invalid value %s, must be one of reject, require, replace", v)
+				},
+			},
+			{
+				Name: "replacement",
+				Desc: "the replacement of the matches, $1 expands to the first submatch",
+				ParseValueFunc: func(v string) (any, error) {
+					return v, nil
+				},
+			},
+		},
+	}
+}
+
+func (m *Regex) ProcessResponse(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn, response string) (string, error) {
+	re := opts["pattern"].Value.(*regexp.Regexp)
+	switch opts["action"].Value.(string) {
+	case regexActionReject:
+		if re.MatchString(response) {
+			return "", &RejectError{Reason: fmt.Sprintf("response matches %s", re)}
+		}
+	case regexActionRequire:
+		if !re.MatchString(response) {
+			return "", &RejectError{Reason: fmt.Sprintf("response does not match %s", re)}
+		}
+	case regexActionReplace:
+		return re.ReplaceAllString(response, opts["replacement"].Value.(string)), nil
+	}
+	return response, nil
+}
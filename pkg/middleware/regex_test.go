@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+)
+
+func TestRegex(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		opts     map[string]string
+		response string
+		want     string
+		rejected bool
+	}{
+		{"reject by default", map[string]string{"pattern": `(?i)as an ai`}, "As an AI, I can't", "", true},
+		{"reject without a match", map[string]string{"pattern": `(?i)as an ai`}, "Sure", "Sure", false},
+		{"require", map[string]string{"pattern": `^\d+$`, "action": "require"}, "42", "42", false},
+		{"require without a match", map[string]string{"pattern": `^\d+$`, "action": "require"}, "forty-two", "", true},
+		{"replace", map[string]string{"pattern": `(\d{3})\d{4}(\d{4})`, "action": "replace", "replacement": "$1****$2"}, "call 13812345678", "call 138****5678", false},
+		{"replace with nothing", map[string]string{"pattern": `\s*\[\d+\]`, "action": "replace"}, "see [1] and [2].", "see and.", false},
+	} {
+		response, err := processResponse(t, NewRegex(), c.opts, c.response)
+		if c.rejected {
+			if err == nil || err.Code != api.TurnErrorCodeResponseRejected {
+				t.Errorf("%s: err = %v, want the response rejected", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if response != c.want {
+			t.Errorf("%s: response = %q, want %q", c.name, response, c.want)
+		}
+	}
+}
+
+func TestRegexInvalidOptions(t *testing.T) {
+	for _, opts := range []map[string]string{
+		{},
+		{"pattern": "("},
+		{"pattern": "a", "action": "remove"},
+	} {
+		if _, err := processResponse(t, NewRegex(), opts, "a"); err == nil || err.Code != api.TurnErrorCodeMiddlewareError {
+			t.Errorf("options %v: err = %v, want a middleware error", opts, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/internal/webhook"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	remoteDescribeTimeout = 10 * time.Second
+	// remoteRequestTimeout bounds every request to remote middlewares, the
+	// timeout_seconds option usually ends them earlier.
+	remoteRequestTimeout = time.Minute
+	// remoteMaxBodySize limits the responses read from remote middlewares.
+	remoteMaxBodySize = 4 << 20
+)
+
+// Remote is a middleware served over HTTP. Its description is fetched once
+// from GET <url>/describe, turns are processed by POST <url>/process.
+type Remote struct {
+	cfg    config.RemoteMiddlewareConfig
+	sh     *storage.Handler
+	client *http.Client
+	desc   api.MiddlewareDesc
+}
+
+// NewRemotes fetches the descriptions of the remote middlewares in config at
+// the same time. The remote middlewares failing to describe themselves are
+// skipped with a warning, so that they don't keep botastic from starting.
+func NewRemotes(ctx context.Context, cfg config.MiddlewaresConfig, sh *storage.Handler, logger *zap.Logger) ([]*Remote, error) {
+	client := &http.Client{Timeout: remoteRequestTimeout}
+	ms := make([]*Remote, len(cfg.Remote))
+	errs := make([]error, len(cfg.Remote))
+	var wg sync.WaitGroup
+	for i, c := range cfg.Remote {
+		ms[i] = &Remote{
+			cfg:    c,
+			sh:     sh,
+			client: client,
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ms[i].describe(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	rs := make([]*Remote, 0, len(ms))
+	for i, m := range ms {
+		if errs[i] != nil {
+			logger.Warn("skip remote middleware failing to describe itself", zap.String("url", m.cfg.URL), zap.Error(errs[i]))
+			continue
+		}
+		rs = append(rs, m)
+	}
+	return rs, nil
+}
+
+func (m *Remote) describe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, remoteDescribeTimeout)
+	defer cancel()
+
+	if err := m.call(ctx, http.MethodGet, "/describe", nil, &m.desc); err != nil {
+		return err
+	}
+	if m.desc.Name == "" {
+		return errors.New("name is empty")
+	}
+	for _, opt := range m.desc.Options {
+		if opt == nil || opt.Name == "" {
+			return errors.New("option name is empty")
+		}
+	}
+	return nil
+}
+
+func (m *Remote) Desc() *api.MiddlewareDesc {
+	desc := &api.MiddlewareDesc{
+		Name:            m.desc.Name,
+		Desc:            m.desc.Desc,
+		Options:         make([]*api.MiddlewareDescOption, 0, len(m.desc.Options)),
+		RewritesRequest: m.desc.RewritesRequest,
+	}
+	for _, opt := range m.desc.Options {
+		desc.Options = append(desc.Options, &api.MiddlewareDescOption{
+			Name:         opt.Name,
+			Desc:         opt.Desc,
+			DefaultValue: opt.DefaultValue,
+			Required:     opt.Required,
+			ParseValueFunc: func(v string) (any, error) {
+				return v, nil
+			},
+		})
+	}
+	return desc
+}
+
+func (m *Remote) Process(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, map[string]any, error) {
+	_, result, extraData, err := m.ProcessRequest(ctx, opts, turn)
+	return result, extraData, err
+}
+
+// ProcessRequest sends the turn to the remote middleware. If the middlewares
+// it depends on rewrote the request, e.g. redacted it, the turn is sent with
+// the rewritten request only.
+func (m *Remote) ProcessRequest(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, string, map[string]any, error) {
+	req := api.RemoteMiddlewareProcessRequest{
+		Turn:    turn.API(),
+		Options: make(map[string]string, len(opts)),
+	}
+	if request := turnRequest(ctx, turn); request != turn.Request {
+		req.Turn.Request = request
+		req.Turn.RewrittenRequest = request
+	}
+	if id, ok := ctx.Value(middlewareIDKey{}).(string); ok {
+		req.ID = id
+	}
+	for name, opt := range opts {
+		req.Options[name], _ = opt.Value.(string)
+	}
+	if turn.ConvID != uuid.Nil {
+		conv, err := m.sh.GetConv(ctx, turn.ConvID)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if conv != nil {
+			v := conv.API()
+			req.Conv = &v
+		}
+	}
+
+	var resp api.RemoteMiddlewareProcessResponse
+	if err := m.call(ctx, http.MethodPost, "/process", req, &resp); err != nil {
+		return "", "", nil, err
+	}
+	if resp.Error != "" {
+		return "", "", nil, errors.New(resp.Error)
+	}
+	return resp.Request, resp.Result, resp.RenderData, nil
+}
+
+func (m *Remote) call(ctx context.Context, method, path string, body, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(m.cfg.URL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if m.cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhook.HeaderTimestamp, timestamp)
+		req.Header.Set(webhook.HeaderSignature, webhook.Sign(m.cfg.Secret, timestamp, data))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, remoteMaxBodySize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	return json.Unmarshal(respBody, result)
+}
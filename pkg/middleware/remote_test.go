@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"go.uber.org/zap"
+)
+
+func TestNewRemotesSkipsFailures(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/describe" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name":"remote","desc":"a remote middleware"}`))
+	}))
+	defer ok.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	rs, err := NewRemotes(context.Background(), config.MiddlewaresConfig{
+		Remote: []config.RemoteMiddlewareConfig{
+			{URL: unreachable.URL},
+			{URL: ok.URL},
+			{URL: broken.URL},
+		},
+	}, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].Desc().Name != "remote" {
+		t.Fatalf("remotes = %+v, want only the one describing itself", rs)
+	}
+}
+
+func TestRemoteSendsRewrittenRequest(t *testing.T) {
+	var got api.RemoteMiddlewareProcessRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/describe":
+			w.Write([]byte(`{"name":"remote"}`))
+		case "/process":
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(`{"result":"ok"}`))
+		}
+	}))
+	defer srv.Close()
+
+	rs, err := NewRemotes(context.Background(), config.MiddlewaresConfig{
+		Remote: []config.RemoteMiddlewareConfig{{URL: srv.URL}},
+	}, nil, zap.NewNop())
+	if err != nil || len(rs) != 1 {
+		t.Fatalf("remotes = %v, err = %v", rs, err)
+	}
+	h := New(nil, nil, []Middleware{NewRedact(), rs[0]}, nil)
+
+	for _, c := range []struct {
+		items []*api.Middleware
+		want  string
+	}{
+		{[]*api.Middleware{{ID: "remote", Name: "remote"}}, "mail alice@example.com"},
+		{[]*api.Middleware{
+			{ID: "redact", Name: "redact"},
+			{ID: "remote", Name: "remote", DependsOn: []string{"redact"}},
+		}, "mail [EMAIL_1]"},
+	} {
+		got = api.RemoteMiddlewareProcessRequest{}
+		mc := api.MiddlewareConfig{Items: c.items}
+		if results, ok := h.Process(context.Background(), mc, &models.Turn{Request: "mail alice@example.com"}); !ok {
+			t.Fatalf("results = %+v", results)
+		}
+		if got.Turn.Request != c.want {
+			t.Errorf("request = %q, want %q", got.Turn.Request, c.want)
+		}
+		if c.want != "mail alice@example.com" && strings.Contains(fmt.Sprint(got), "alice@example.com") {
+			t.Errorf("the original request is sent: %+v", got)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+// ResponseMiddleware processes the response of the chat model, returning it
+// transformed, or a *RejectError to fail the turn.
+type ResponseMiddleware interface {
+	Desc() *api.MiddlewareDesc
+	ProcessResponse(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn, response string) (string, error)
+}
+
+// RejectError is returned by response middlewares rejecting the response.
+type RejectError struct {
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return "response rejected: " + e.Reason
+}
+
+func (h *Handler) ResponseMiddlewares() []*api.MiddlewareDesc {
+	rs := make([]*api.MiddlewareDesc, len(h.rms))
+	for i, m := range h.rms {
+		rs[i] = m.Desc()
+	}
+
+	return rs
+}
+
+// ProcessResponse runs the response middlewares of the config one after the
+// other on the response of the chat model, and returns the final response and
+// their results. Their option templates can refer to the current response as
+// .Response besides the request, the conversation and the results of the
+// request middlewares. The returned error is a *models.TurnError.
+func (h *Handler) ProcessResponse(ctx context.Context, mc api.MiddlewareConfig, turn *models.Turn, response string, requestResults []*api.MiddlewareResult) (string, []*api.MiddlewareResult, error) {
+	data := h.templateData(ctx, turn)
+	for _, r := range requestResults {
+		for k, v := range r.RenderData {
+			data[k] = v
+		}
+	}
+
+	rs := make([]*api.MiddlewareResult, 0, len(mc.ResponseItems))
+	for _, item := range mc.ResponseItems {
+		item = cloneItem(item)
+		r := &api.MiddlewareResult{
+			Middleware: *item,
+		}
+		rs = append(rs, r)
+
+		data["Response"] = response
+		generalOptions, options, err := h.parseResponseMiddleware(item, data)
+		if err != nil {
+			r.Code = api.MiddlewareErrorCodeConfigInvalid
+			r.Err = err.Error()
+			if opt, ok := generalOptions[generalOptionTerminateIfError]; !ok || opt.Value.(bool) {
+				return response, rs, models.NewTurnError(api.TurnErrorCodeMiddlewareError, err.Error())
+			}
+			continue
+		}
+		if !generalOptions[generalOptionWhen].Value.(bool) {
+			r.Code = api.MiddlewareErrorCodeSkipped
+			r.Err = "when is false"
+			continue
+		}
+
+		result, err := func() (string, error) {
+			timeoutSeconds := generalOptions[generalOptionTimeoutSeconds].Value.(int)
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+			defer cancel()
+			ctx = context.WithValue(ctx, middlewareIDKey{}, item.ID)
+
+			return h.rmm[item.Name].ProcessResponse(ctx, options, turn, response)
+		}()
+		var rejectErr *RejectError
+		switch {
+		case errors.As(err, &rejectErr):
+			r.Code = api.MiddlewareErrorCodeRejected
+			r.Err = err.Error()
+			return response, rs, models.NewTurnError(api.TurnErrorCodeResponseRejected, rejectErr.Reason)
+		case err != nil:
+			if errors.Is(err, context.DeadlineExceeded) {
+				r.Code = api.MiddlewareErrorCodeTimeout
+			} else {
+				r.Code = api.MiddlewareErrorCodeProcessFailed
+			}
+			r.Err = err.Error()
+			if generalOptions[generalOptionTerminateIfError].Value.(bool) {
+				return response, rs, models.NewTurnError(api.TurnErrorCodeMiddlewareError, err.Error())
+			}
+			continue
+		}
+
+		response = result
+		r.RenderData = map[string]any{
+			fmt.Sprintf("MIDDLEWARE_%s_RESULT", item.ID): result,
+		}
+	}
+
+	return response, rs, nil
+}
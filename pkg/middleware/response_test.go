@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+)
+
+// processResponse runs the response middleware with the options on the
+// response, like the response items of a bot config.
+func processResponse(t *testing.T, m ResponseMiddleware, opts map[string]string, response string) (string, *models.TurnError) {
+	t.Helper()
+	h := New(nil, nil, nil, []ResponseMiddleware{m})
+	mc := api.MiddlewareConfig{
+		ResponseItems: []*api.Middleware{{ID: "m", Name: m.Desc().Name, Options: opts}},
+	}
+	response, _, err := h.ProcessResponse(context.Background(), mc, &models.Turn{Request: "hi"}, response, nil)
+	if err != nil {
+		turnErr, ok := err.(*models.TurnError)
+		if !ok {
+			t.Fatalf("err = %v, want a *models.TurnError", err)
+		}
+		return response, turnErr
+	}
+	return response, nil
+}
+
+func TestProcessResponseChain(t *testing.T) {
+	h := New(nil, nil, nil, []ResponseMiddleware{NewRegex(), NewJSONValidate()})
+	mc := api.MiddlewareConfig{
+		ResponseItems: []*api.Middleware{
+			{ID: "fence", Name: "regex", Options: map[string]string{
+				"pattern":     "(?s)^```json\\s*(.*?)\\s*```$",
+				"action":      "replace",
+				"replacement": "$1",
+			}},
+			{ID: "json", Name: "json-validate", Options: map[string]string{
+				"required_fields":  "answer",
+				"strip_code_fence": "false",
+			}},
+		},
+	}
+	response, rs, err := h.ProcessResponse(context.Background(), mc, &models.Turn{}, "```json\n{\"answer\": 42}\n```", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != `{"answer": 42}` {
+		t.Errorf("response = %q", response)
+	}
+	if len(rs) != 2 || rs[0].RenderData["MIDDLEWARE_fence_RESULT"] != response || rs[1].Code != 0 {
+		t.Errorf("results = %+v", rs)
+	}
+}
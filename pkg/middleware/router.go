@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	llmapi "github.com/pandodao/botastic/pkg/llms/api"
+)
+
+const routerPrompt = `You select the tools to run before answering the user request.
+The tools are, one per line as "id: description":
+%s
+Reply only with the ids of the tools needed to answer the request, separated by commas, or "none" if no tool is needed.`
+
+// route asks the chat model of the router which middlewares to run for the
+// turn, among the ones not in done, which already ran. The middlewares they
+// depend on are selected too. All the middlewares are selected if the chat
+// model fails, routing is an optimization.
+func (h *Handler) route(ctx context.Context, mc api.MiddlewareConfig, turn *models.Turn, done map[string]bool) map[string]bool {
+	all := make(map[string]bool, len(mc.Items))
+	for _, item := range mc.Items {
+		all[item.ID] = true
+	}
+
+	cm, err := h.llmsh.GetChatModel(mc.Router.ChatModel)
+	if err != nil {
+		return all
+	}
+
+	tools := make([]string, 0, len(mc.Items))
+	for _, item := range mc.Items {
+		if done[item.ID] {
+			continue
+		}
+		desc := item.Name
+		if m, ok := h.mm[item.Name]; ok {
+			desc = fmt.Sprintf("%s, %s", item.Name, m.Desc().Desc)
+		}
+		tools = append(tools, fmt.Sprintf("%s: %s", item.ID, desc))
+	}
+	if len(tools) == 0 {
+		return all
+	}
+	prompt := fmt.Sprintf(routerPrompt, strings.Join(tools, "\n"))
+	if mc.Router.Prompt != "" {
+		prompt += "\n" + mc.Router.Prompt
+	}
+
+	resp, err := cm.Chat(ctx, llmapi.ChatRequest{
+		Prompt:  prompt,
+		History: []string{},
+		Request: turnRequest(ctx, turn),
+	})
+	if err != nil {
+		return all
+	}
+
+	itemMap := make(map[string]*api.Middleware, len(mc.Items))
+	for _, item := range mc.Items {
+		itemMap[item.ID] = item
+	}
+	selected := map[string]bool{}
+	var selectItem func(id string)
+	selectItem = func(id string) {
+		item, ok := itemMap[id]
+		if !ok || selected[id] {
+			return
+		}
+		selected[id] = true
+		for _, dep := range item.DependsOn {
+			selectItem(dep)
+		}
+	}
+	for _, id := range strings.FieldsFunc(resp.Response, func(r rune) bool {
+		return r == ',' || r == '\n' || r == ' '
+	}) {
+		selectItem(strings.Trim(id, "\"'`."))
+	}
+	return selected
+}
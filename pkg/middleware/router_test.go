@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/llms"
+)
+
+// testMiddleware records the requests it sees, and rewrites them if rewrite
+// is set.
+type testMiddleware struct {
+	name    string
+	rewrite func(string) string
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (m *testMiddleware) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name:            m.name,
+		Desc:            m.name + " middleware",
+		Options:         []*api.MiddlewareDescOption{},
+		RewritesRequest: m.rewrite != nil,
+	}
+}
+
+func (m *testMiddleware) Process(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, map[string]any, error) {
+	_, result, extraData, err := m.ProcessRequest(ctx, opts, turn)
+	return result, extraData, err
+}
+
+func (m *testMiddleware) ProcessRequest(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, string, map[string]any, error) {
+	request := turnRequest(ctx, turn)
+	m.mu.Lock()
+	m.requests = append(m.requests, request)
+	m.mu.Unlock()
+
+	if m.rewrite != nil {
+		request = m.rewrite(request)
+		return request, m.name + ":" + request, nil, nil
+	}
+	return "", m.name + ":" + request, nil, nil
+}
+
+func (m *testMiddleware) seen() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.requests...)
+}
+
+// newTestChatModels serves chat completions answering with the given
+// function of the messages sent.
+func newTestChatModels(t *testing.T, answer func(messages []map[string]string) string) *llms.Handler {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message": map[string]string{"role": "assistant", "content": answer(req.Messages)},
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return llms.New(config.LLMsConfig{
+		Enabled: []string{"test"},
+		Items: map[string]config.LLMConfig{
+			"test": {
+				Provider: config.LLMProviderOpenAI,
+				OpenAI: &config.OpenAIConfig{
+					Key:        "key",
+					BaseURL:    srv.URL,
+					ChatModels: []string{"gpt-3.5-turbo"},
+				},
+			},
+		},
+	})
+}
+
+func TestRouterSeesRewrittenRequest(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		routed   string
+		prompted string
+	)
+	llmsh := newTestChatModels(t, func(messages []map[string]string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		prompted = messages[0]["content"]
+		routed = messages[len(messages)-1]["content"]
+		return "search"
+	})
+
+	spell := &testMiddleware{name: "spell", rewrite: func(s string) string {
+		return strings.ReplaceAll(s, "wether", "weather")
+	}}
+	search := &testMiddleware{name: "lookup"}
+	other := &testMiddleware{name: "other"}
+	h := New(nil, llmsh, []Middleware{NewRedact(), spell, search, other}, nil)
+
+	mc := api.MiddlewareConfig{
+		Items: []*api.Middleware{
+			{ID: "search", Name: "lookup", DependsOn: []string{"spell"}},
+			{ID: "redact", Name: "redact"},
+			{ID: "spell", Name: "spell", DependsOn: []string{"redact"}},
+			{ID: "other", Name: "other"},
+		},
+		Router: &api.MiddlewareRouter{ChatModel: "test:gpt-3.5-turbo"},
+	}
+	if err := h.ValidateConfig(&mc); err != nil {
+		t.Fatal(err)
+	}
+
+	turn := &models.Turn{Request: "wether for a@b.io"}
+	rs, ok := h.Process(context.Background(), mc, turn)
+	if !ok {
+		t.Fatalf("flow terminated: %+v", rs)
+	}
+
+	if want := "weather for [EMAIL_1]"; routed != want {
+		t.Errorf("router request = %q, want %q", routed, want)
+	}
+	if strings.Contains(prompted, "redact") || strings.Contains(prompted, "spell") {
+		t.Errorf("router is asked about the middlewares rewriting the request:\n%s", prompted)
+	}
+	if !strings.Contains(prompted, "search: lookup") || !strings.Contains(prompted, "other: other") {
+		t.Errorf("router is not asked about the other middlewares:\n%s", prompted)
+	}
+
+	codes := map[string]api.MiddlewareErrorCode{}
+	for _, r := range rs {
+		codes[r.ID] = r.Code
+	}
+	want := map[string]api.MiddlewareErrorCode{
+		"search": 0,
+		"redact": 0,
+		"spell":  0,
+		"other":  api.MiddlewareErrorCodeSkipped,
+	}
+	for id, code := range want {
+		if codes[id] != code {
+			t.Errorf("code of %s = %d, want %d", id, codes[id], code)
+		}
+	}
+	if got := search.seen(); len(got) != 1 || got[0] != "weather for [EMAIL_1]" {
+		t.Errorf("search saw %q", got)
+	}
+	if got := other.seen(); len(got) != 0 {
+		t.Errorf("other ran with %q", got)
+	}
+}
+
+func TestRouterWithoutModelSelectsAll(t *testing.T) {
+	llmsh := newTestChatModels(t, func(messages []map[string]string) string {
+		return ""
+	})
+	a := &testMiddleware{name: "a"}
+	h := New(nil, llmsh, []Middleware{a}, nil)
+
+	mc := api.MiddlewareConfig{
+		Items:  []*api.Middleware{{ID: "a", Name: "a"}},
+		Router: &api.MiddlewareRouter{ChatModel: "test:unknown"},
+	}
+	rs, ok := h.Process(context.Background(), mc, &models.Turn{Request: "hi"})
+	if !ok || rs[0].Code != 0 {
+		t.Fatalf("ok = %v, results = %+v", ok, rs[0])
+	}
+	if got := a.seen(); len(got) != 1 {
+		t.Errorf("a ran %d times, want 1", len(got))
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/llms"
+	llmapi "github.com/pandodao/botastic/pkg/llms/api"
+)
+
+type Translate struct {
+	llmsh *llms.Handler
+}
+
+func NewTranslate(llmsh *llms.Handler) *Translate {
+	return &Translate{
+		llmsh: llmsh,
+	}
+}
+
+func (m *Translate) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name: "translate",
+		Desc: "translates the response with a chat model, whose tokens are not counted in the turn",
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name:     "chat_model",
+				Desc:     "the chat model translating",
+				Required: true,
+				ParseValueFunc: func(v string) (any, error) {
+					cm, err := m.llmsh.GetChatModel(v)
+					if err != nil {
+						return nil, fmt.Errorf("chat model %s not found", v)
+					}
+					return cm, nil
+				},
+			},
+			{
+				Name:     "language",
+				Desc:     "the language to translate to, e.g. French",
+				Required: true,
+				ParseValueFunc: func(v string) (any, error) {
+					return v, nil
+				},
+			},
+		},
+	}
+}
+
+func (m *Translate) ProcessResponse(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn, response string) (string, error) {
+	cm := opts["chat_model"].Value.(llmapi.ChatLLM)
+	resp, err := cm.Chat(ctx, llmapi.ChatRequest{
+		Prompt:  fmt.Sprintf("Translate the text of the user to %s. Reply only with the translation, keeping its formatting.", opts["language"].Value.(string)),
+		History: []string{},
+		Request: response,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Response, nil
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/internal/search"
+	"github.com/pandodao/botastic/models"
+)
+
+const defaultWebSearchTemplate = `Web search results:
+{{range .Items}}
+[{{.Index}}] {{.Title}}
+"{{.Snippet}}"
+URL: {{.URL}}
+{{- if .Content}}
+Content: {{.Content}}
+{{- end}}
+{{end}}
+Current date: {{.Date}}`
+
+type WebSearch struct {
+	sh *search.Handler
+}
+
+func NewWebSearch(sh *search.Handler) *WebSearch {
+	return &WebSearch{
+		sh: sh,
+	}
+}
+
+func (m *WebSearch) Desc() *api.MiddlewareDesc {
+	return &api.MiddlewareDesc{
+		Name: "web-search",
+		Desc: "searches the web for the request with a search provider of the config",
+		Options: []*api.MiddlewareDescOption{
+			{
+				Name:         "provider",
+				Desc:         "name of the search provider in the config",
+				DefaultValue: search.DefaultProvider,
+				ParseValueFunc: func(v string) (any, error) {
+					return m.sh.GetProvider(v)
+				},
+			},
+			{
+				Name:           "limit",
+				Desc:           "limit number of results",
+				DefaultValue:   "3",
+				ParseValueFunc: parsePositiveInt,
+			},
+			{
+				Name:         "safe_search",
+				Desc:         "filtering of adult content, one of off, moderate, strict",
+				DefaultValue: string(search.SafeSearchModerate),
+				ParseValueFunc: func(v string) (any, error) {
+					switch s := search.SafeSearch(v); s {
+					case search.SafeSearchOff, search.SafeSearchModerate, search.SafeSearchStrict:
+						return s, nil
+					}
+					return nil, fmt.Errorf("invalid value %s, must be one of off, moderate, strict", v)
+				},
+			},
+			{
+				Name: "region",
+				Desc: "region or language of the results in the format of the provider, e.g. us-en for duckduckgo, en-US for bing",
+				ParseValueFunc: func(v string) (any, error) {
+					return v, nil
+				},
+			},
+			{
+				Name:         "result_template",
+				Desc:         "go template of the result over .Query, .Date and .Items, which have .Index, .Title, .Snippet, .URL and .Content",
+				DefaultValue: defaultWebSearchTemplate,
+				Raw:          true,
+				ParseValueFunc: func(v string) (any, error) {
+					return template.New("result").Parse(v)
+				},
+			},
+			{
+				Name:         "fetch_pages",
+				Desc:         "fetch the pages of this number of top results as their content",
+				DefaultValue: "0",
+				ParseValueFunc: func(v string) (any, error) {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						return nil, err
+					}
+					if n < 0 {
+						return nil, errors.New("fetch_pages must not be negative")
+					}
+					return n, nil
+				},
+			},
+			{
+				Name:           "page_max_length",
+				Desc:           "the content of fetched pages is cut to this number of characters",
+				DefaultValue:   "2000",
+				ParseValueFunc: parsePositiveInt,
+			},
+		},
+	}
+}
+
+func parsePositiveInt(v string) (any, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, errors.New("must be positive")
+	}
+	return n, nil
+}
+
+func (m *WebSearch) Process(ctx context.Context, opts map[string]*api.MiddlewareDescOption, turn *models.Turn) (string, map[string]any, error) {
+	query := turnRequest(ctx, turn)
+	items, err := opts["provider"].Value.(search.Provider).Search(ctx, query, search.Options{
+		Count:      opts["limit"].Value.(int),
+		SafeSearch: opts["safe_search"].Value.(search.SafeSearch),
+		Region:     opts["region"].Value.(string),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if n := opts["fetch_pages"].Value.(int); n > 0 {
+		if n > len(items) {
+			n = len(items)
+		}
+		search.FetchPages(ctx, items[:n], opts["page_max_length"].Value.(int))
+	}
+
+	result, err := renderSearchResult(opts["result_template"].Value.(*template.Template), query, items)
+	if err != nil {
+		return "", nil, err
+	}
+	return result, map[string]any{
+		"items": items,
+	}, nil
+}
+
+func renderSearchResult(t *template.Template, query string, items []*search.Item) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, map[string]any{
+		"Query": query,
+		"Date":  time.Now().Format("2006-01-02"),
+		"Items": items,
+	}); err != nil {
+		return "", fmt.Errorf("failed to render result: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/internal/search"
+	"github.com/pandodao/botastic/models"
+)
+
+func newSearchTestHandler(t *testing.T) *Handler {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html/":
+			w.Write([]byte(`<div class="result"><h2><a class="result__a" href="https://go.dev/">Go</a></h2><a class="result__snippet">the "Go" language</a></div>
+<div class="result"><h2><a class="result__a" href="https://example.com/">Example</a></h2><a class="result__snippet">example</a></div>`))
+		case "/search":
+			w.Write([]byte(`{"results": [{"title": "Go", "url": "https://go.dev/", "content": "the Go language"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	sh := search.New(config.SearchConfig{Providers: map[string]config.SearchProviderConfig{
+		search.DefaultProvider: {Type: config.SearchProviderDuckDuckGo, BaseURL: srv.URL},
+		"searx":                {Type: config.SearchProviderSearxNG, BaseURL: srv.URL},
+	}})
+	return New(nil, nil, []Middleware{NewWebSearch(sh), NewDDGSearch(sh)}, nil)
+}
+
+func processOne(h *Handler, name string, opts map[string]string) *api.MiddlewareResult {
+	rs, _ := h.Process(context.Background(), api.MiddlewareConfig{
+		Items: []*api.Middleware{{ID: "s", Name: name, Options: opts}},
+	}, &models.Turn{Request: "golang"})
+	return rs[0]
+}
+
+func TestDDGSearch(t *testing.T) {
+	h := newSearchTestHandler(t)
+
+	r := processOne(h, "ddg_search", map[string]string{"limit": "1"})
+	if r.Code != 0 {
+		t.Fatalf("code = %d, err = %s", r.Code, r.Err)
+	}
+	result := r.RenderData["MIDDLEWARE_s_RESULT"].(string)
+	if !strings.Contains(result, `[1] "the Go language"`) {
+		t.Errorf("snippet quotes are not stripped:\n%s", result)
+	}
+	if strings.Contains(result, "example") {
+		t.Errorf("limit is not applied:\n%s", result)
+	}
+
+	for _, limit := range []string{"0", "-1", "x"} {
+		r := processOne(h, "ddg_search", map[string]string{"limit": limit})
+		if r.Code != api.MiddlewareErrorCodeConfigInvalid {
+			t.Errorf("limit %s: code = %d, want %d", limit, r.Code, api.MiddlewareErrorCodeConfigInvalid)
+		}
+	}
+}
+
+func TestWebSearch(t *testing.T) {
+	h := newSearchTestHandler(t)
+
+	tests := []struct {
+		name string
+		opts map[string]string
+		code api.MiddlewareErrorCode
+		want string
+	}{
+		{
+			name: "default provider",
+			opts: nil,
+			want: "[1] Go\n\"the \"Go\" language\"\nURL: https://go.dev/",
+		},
+		{
+			name: "provider and result template",
+			opts: map[string]string{
+				"provider":        "searx",
+				"result_template": "{{.Query}}:{{range .Items}} {{.Index}}={{.URL}}{{end}}",
+			},
+			want: "golang: 1=https://go.dev/",
+		},
+		{
+			name: "unknown provider",
+			opts: map[string]string{"provider": "bing"},
+			code: api.MiddlewareErrorCodeConfigInvalid,
+		},
+		{
+			name: "invalid safe search",
+			opts: map[string]string{"safe_search": "maybe"},
+			code: api.MiddlewareErrorCodeConfigInvalid,
+		},
+		{
+			name: "negative limit",
+			opts: map[string]string{"limit": "-1"},
+			code: api.MiddlewareErrorCodeConfigInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := processOne(h, "web-search", tt.opts)
+			if r.Code != tt.code {
+				t.Fatalf("code = %d, want %d, err = %s", r.Code, tt.code, r.Err)
+			}
+			if tt.code != 0 {
+				return
+			}
+			if result := r.RenderData["MIDDLEWARE_s_RESULT"].(string); !strings.Contains(result, tt.want) {
+				t.Errorf("result does not contain %q:\n%s", tt.want, result)
+			}
+		})
+	}
+}
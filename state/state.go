@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"sync"
 	"time"
@@ -21,6 +22,17 @@ import (
 
 type MiddlewareHandler interface {
 	Process(ctx context.Context, mc api.MiddlewareConfig, turn *models.Turn) ([]*api.MiddlewareResult, bool)
+	ProcessResponse(ctx context.Context, mc api.MiddlewareConfig, turn *models.Turn, response string, requestResults []*api.MiddlewareResult) (string, []*api.MiddlewareResult, error)
+}
+
+// TurnNotifier notifies the processed turns through an outbox, the delivery
+// of a turn is created in the transaction updating its final status.
+type TurnNotifier interface {
+	// TurnProcessedDelivery returns the delivery notifying the processed
+	// turn, nil if nobody is to be notified.
+	TurnProcessedDelivery(ctx context.Context, turn *models.Turn) (*models.WebhookDelivery, error)
+	// Notify wakes up the delivery of the created deliveries.
+	Notify()
 }
 
 type Handler struct {
@@ -31,6 +43,7 @@ type Handler struct {
 	llms              *llms.Handler
 	hub               *chanhub.Hub
 	middlewareHandler MiddlewareHandler
+	turnNotifier      TurnNotifier
 
 	tc                *templateCache
 	conversationsLock sync.Mutex
@@ -38,7 +51,7 @@ type Handler struct {
 }
 
 func New(cfg config.StateConfig, logger *zap.Logger, sh *storage.Handler,
-	llms *llms.Handler, hub *chanhub.Hub, middlewareHandler MiddlewareHandler) *Handler {
+	llms *llms.Handler, hub *chanhub.Hub, middlewareHandler MiddlewareHandler, turnNotifier TurnNotifier) *Handler {
 	return &Handler{
 		logger:            logger.Named("state"),
 		cfg:               cfg,
@@ -48,6 +61,7 @@ func New(cfg config.StateConfig, logger *zap.Logger, sh *storage.Handler,
 		conversations:     make(map[uuid.UUID]*conversation),
 		hub:               hub,
 		middlewareHandler: middlewareHandler,
+		turnNotifier:      turnNotifier,
 		tc:                newTemplateCache(),
 	}
 }
@@ -81,23 +95,30 @@ func (h *Handler) GetTurnsChan() chan<- *models.Turn {
 }
 
 func (h *Handler) handleTurnsWorker(ctx context.Context) {
-	var turn *models.Turn
-	select {
-	case <-ctx.Done():
-		return
-	case turn = <-h.turnsChan:
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case turn := <-h.turnsChan:
+			h.handleTurn(ctx, turn)
+		}
 	}
+}
 
+func (h *Handler) handleTurn(ctx context.Context, turn *models.Turn) {
 	h.logger.Info("handling turn", zap.Uint("turn_id", turn.ID))
 	var (
 		middlewareResults []*api.MiddlewareResult
 		c                 *conversation
+		usage             llmapi.Usage
 	)
 	result, err := func() (*llmapi.ChatResponse, error) {
 		if err := h.sh.UpdateTurnToProcessing(ctx, turn.ID); err != nil {
 			return nil, err
 		}
 		h.logger.Debug("turn updated to processing", zap.Uint("turn_id", turn.ID))
+		turn.Status = api.TurnStatusProcessing
+		h.publishTurn(turn)
 
 		var err error
 		c, err = h.getOrloadConversation(ctx, turn.ConvID)
@@ -115,44 +136,46 @@ func (h *Handler) handleTurnsWorker(ctx context.Context) {
 		if bot == nil {
 			return nil, models.NewTurnError(api.TurnErrorCodeBotNotFound)
 		}
-
-		if bot.Middlewares != nil {
-			var ok bool
-			middlewareResults, ok = h.middlewareHandler.Process(ctx, api.MiddlewareConfig(*bot.Middlewares), turn)
-			if !ok {
-				return nil, models.NewTurnError(api.TurnErrorCodeMiddlewareError)
-			}
-
-			data := map[string]any{}
-			for _, r := range middlewareResults {
-				for k, v := range r.RenderData {
-					data[k] = v
-				}
-			}
-
-			if err := h.renderBotPrompts(bot, data); err != nil {
-				return nil, models.NewTurnError(api.TurnErrorCodeRenderPromptError, err.Error())
-			}
+		if err := h.applyBotVersion(ctx, bot, turn.BotVersion); err != nil {
+			return nil, err
 		}
 
-		cm, err := h.llms.GetChatModel(bot.ChatModel)
+		var (
+			cm      llmapi.ChatLLM
+			chatReq llmapi.ChatRequest
+		)
+		cm, chatReq, middlewareResults, err = h.prepareChat(ctx, bot, turn, c.historyText())
+		var canned cannedResponse
+		if errors.As(err, &canned) {
+			return &llmapi.ChatResponse{Response: string(canned)}, nil
+		}
 		if err != nil {
-			return nil, models.NewTurnError(api.TurnErrorCodeChatModelNotFound)
+			return nil, err
 		}
 
 		h.logger.Debug("chat model found", zap.String("chat_model", bot.ChatModel), zap.Uint("turn_id", turn.ID), zap.String("conv_id", turn.ConvID.String()))
+		// the timeout only applies to the chat model and the response
+		// middlewares, the turn is updated with ctx afterwards
+		callCtx := ctx
 		if bot.TimeoutSeconds > 0 {
 			var cancel context.CancelFunc
-			ctx, cancel = context.WithTimeout(ctx, time.Duration(bot.TimeoutSeconds)*time.Second)
+			callCtx, cancel = context.WithTimeout(ctx, time.Duration(bot.TimeoutSeconds)*time.Second)
 			defer cancel()
 		}
-		result, err := cm.Chat(ctx, llmapi.ChatRequest{
-			Temperature:    bot.Temperature,
-			Prompt:         bot.Prompt,
-			BoundaryPrompt: bot.BoundaryPrompt,
-			History:        c.historyText(),
-			Request:        turn.Request,
-		})
+		// the response is not streamed if response middlewares can change it
+		hasResponseItems := bot.Middlewares != nil && len(bot.Middlewares.ResponseItems) > 0
+		var result *llmapi.ChatResponse
+		if s, ok := cm.(llmapi.ChatStreamer); ok && !hasResponseItems && h.hub.HasSubscribers(turn.ConvID) {
+			result, err = s.ChatStream(callCtx, chatReq, func(delta string) {
+				h.hub.Publish(turn.ConvID, &api.ConvEvent{
+					Type:   api.ConvEventTypeDelta,
+					TurnID: turn.ID,
+					Delta:  delta,
+				})
+			})
+		} else {
+			result, err = cm.Chat(callCtx, chatReq)
+		}
 		if err != nil {
 			h.logger.Error("chat model error", zap.Error(err), zap.Uint("turn_id", turn.ID))
 			code := api.TurnErrorCodeChatModelCallError
@@ -167,10 +190,24 @@ func (h *Handler) handleTurnsWorker(ctx context.Context) {
 			zap.String("chat_model", bot.ChatModel),
 			zap.Int("total_tokens", result.Usage.TotalTokens),
 		)
+
+		if hasResponseItems {
+			var responseResults []*api.MiddlewareResult
+			result.Response, responseResults, err = h.middlewareHandler.ProcessResponse(callCtx, api.MiddlewareConfig(*bot.Middlewares), turn, result.Response, middlewareResults)
+			middlewareResults = append(middlewareResults, responseResults...)
+			if err != nil {
+				// the tokens are spent even if the response is rejected
+				usage = result.Usage
+				return nil, err
+			}
+		}
 		return result, nil
 	}()
 
-	var updateFunc func() error
+	// the history is only needed while the middlewares run
+	turn.History = nil
+	var updateFunc func(delivery *models.WebhookDelivery) error
+	storedTurn := turn
 	if err != nil {
 		var target *models.TurnError
 		if !errors.As(err, &target) {
@@ -178,8 +215,13 @@ func (h *Handler) handleTurnsWorker(ctx context.Context) {
 		}
 
 		turn.Status = api.TurnStatusFailed
-		updateFunc = func() error {
-			return h.sh.UpdateTurnToFailed(ctx, turn.ID, target, middlewareResults)
+		turn.Error = target
+		turn.PromptTokens = usage.PromptTokens
+		turn.CompletionTokens = usage.CompletionTokens
+		turn.TotalTokens = usage.TotalTokens
+		turn.MiddlewareResults = middlewareResults
+		updateFunc = func(delivery *models.WebhookDelivery) error {
+			return h.sh.UpdateTurnToFailed(ctx, turn.ID, target, turn.PromptTokens, turn.CompletionTokens, turn.TotalTokens, storedTurn.MiddlewareResults, delivery)
 		}
 	} else {
 		turn.Response = result.Response
@@ -188,13 +230,38 @@ func (h *Handler) handleTurnsWorker(ctx context.Context) {
 		turn.CompletionTokens = result.Usage.CompletionTokens
 		turn.TotalTokens = result.Usage.TotalTokens
 		turn.MiddlewareResults = middlewareResults
-		updateFunc = func() error {
-			return h.sh.UpdateTurnToSuccess(ctx, turn.ID, turn.Response, turn.PromptTokens, turn.CompletionTokens, turn.TotalTokens, turn.MiddlewareResults)
+		updateFunc = func(delivery *models.WebhookDelivery) error {
+			return h.sh.UpdateTurnToSuccess(ctx, turn.ID, storedTurn.Response, turn.PromptTokens, turn.CompletionTokens, turn.TotalTokens, storedTurn.MiddlewareResults, delivery)
+		}
+	}
+
+	// only the redacted text is stored if the redaction says so, including
+	// the payload of the webhook delivery, the turn is still published with
+	// the original text. Otherwise the
+	// turn keeps the original text everywhere, it is redacted again when it
+	// is in the history of the next turns.
+	if r := turn.Redaction; r != nil {
+		if r.Persist {
+			v := *turn
+			v.Request = r.Redact(turn.Request)
+			v.Response = r.Redact(turn.Response)
+			v.MiddlewareResults = redactResults(r, turn.MiddlewareResults)
+			storedTurn = &v
+		} else if turn.RewrittenRequest != "" {
+			if turn.RewrittenRequest = r.Restore(turn.RewrittenRequest); turn.RewrittenRequest == turn.Request {
+				turn.RewrittenRequest = ""
+			}
 		}
 	}
 
 	for {
-		updateErr := updateFunc()
+		delivery, updateErr := h.turnNotifier.TurnProcessedDelivery(ctx, storedTurn)
+		if updateErr == nil && (storedTurn.Request != turn.Request || turn.RewrittenRequest != "") {
+			updateErr = h.sh.UpdateTurnRequest(ctx, turn.ID, storedTurn.Request, storedTurn.RewrittenRequest)
+		}
+		if updateErr == nil {
+			updateErr = updateFunc(delivery)
+		}
 		if updateErr == nil {
 			break
 		}
@@ -208,11 +275,198 @@ func (h *Handler) handleTurnsWorker(ctx context.Context) {
 	}
 
 	if turn.Status == api.TurnStatusSuccess {
-		c.appendTurn(turn)
+		c.appendTurn(storedTurn)
 	}
 
 	h.logger.Info("turn processed", zap.Uint("turn_id", turn.ID), zap.String("status", turn.Status.String()))
 	h.hub.Broadcast(turn.ID, struct{}{})
+	h.publishTurn(turn)
+	h.turnNotifier.Notify()
+}
+
+// redactResults returns copies of the middleware results with the text in
+// them redacted, e.g. the response restored by unredact.
+func redactResults(r *models.Redaction, results models.MiddlewareResults) models.MiddlewareResults {
+	rs := make(models.MiddlewareResults, 0, len(results))
+	for _, result := range results {
+		v := *result
+		v.Err = r.Redact(v.Err)
+		v.Response = r.Redact(v.Response)
+		v.Request = r.Redact(v.Request)
+		if v.RenderData != nil {
+			v.RenderData = make(map[string]any, len(result.RenderData))
+			for k, d := range result.RenderData {
+				if s, ok := d.(string); ok {
+					d = r.Redact(s)
+				}
+				v.RenderData[k] = d
+			}
+		}
+		rs = append(rs, &v)
+	}
+	return rs
+}
+
+// publishTurn sends the turn to the subscribers of its conversation.
+func (h *Handler) publishTurn(turn *models.Turn) {
+	v := turn.API()
+	h.hub.Publish(turn.ConvID, &api.ConvEvent{
+		Type: api.ConvEventTypeTurn,
+		Turn: &v,
+	})
+}
+
+// cannedResponse is returned by prepareChat when a middleware blocking the
+// request responds instead of the chat model.
+type cannedResponse string
+
+func (r cannedResponse) Error() string {
+	return "canned response"
+}
+
+// prepareChat runs the bot's middlewares for the turn, renders the bot prompts
+// with their results and builds the request to send to the chat model.
+func (h *Handler) prepareChat(ctx context.Context, bot *models.Bot, turn *models.Turn, history []string) (llmapi.ChatLLM, llmapi.ChatRequest, []*api.MiddlewareResult, error) {
+	var middlewareResults []*api.MiddlewareResult
+	turn.History = history
+	if bot.Middlewares != nil {
+		var ok bool
+		middlewareResults, ok = h.middlewareHandler.Process(ctx, api.MiddlewareConfig(*bot.Middlewares), turn)
+		if !ok {
+			for _, r := range middlewareResults {
+				if r.Code != api.MiddlewareErrorCodeBlocked {
+					continue
+				}
+				if r.Response != "" {
+					return nil, llmapi.ChatRequest{}, middlewareResults, cannedResponse(r.Response)
+				}
+				return nil, llmapi.ChatRequest{}, middlewareResults, models.NewTurnError(api.TurnErrorCodeRequestBlocked, r.Err)
+			}
+			return nil, llmapi.ChatRequest{}, middlewareResults, models.NewTurnError(api.TurnErrorCodeMiddlewareError)
+		}
+
+		data := map[string]any{}
+		for _, r := range middlewareResults {
+			for k, v := range r.RenderData {
+				data[k] = v
+			}
+		}
+
+		if err := h.renderBotPrompts(bot, data); err != nil {
+			return nil, llmapi.ChatRequest{}, middlewareResults, models.NewTurnError(api.TurnErrorCodeRenderPromptError, err.Error())
+		}
+	}
+
+	cm, err := h.llms.GetChatModel(bot.ChatModel)
+	if err != nil {
+		return nil, llmapi.ChatRequest{}, middlewareResults, models.NewTurnError(api.TurnErrorCodeChatModelNotFound)
+	}
+
+	// the chat model sees the request rewritten by the last middleware in
+	// config order that rewrote it, never with redacted values
+	request := turn.Request
+	for _, r := range middlewareResults {
+		if r.Code == 0 && r.Request != "" {
+			request = r.Request
+		}
+	}
+	if turn.Redaction != nil {
+		request = turn.Redaction.Redact(request)
+		redacted := make([]string, len(history))
+		for i, text := range history {
+			redacted[i] = turn.Redaction.Redact(text)
+		}
+		history = redacted
+	}
+	if request != turn.Request {
+		turn.RewrittenRequest = request
+	}
+	return cm, llmapi.ChatRequest{
+		Temperature:    bot.Temperature,
+		Prompt:         bot.Prompt,
+		BoundaryPrompt: bot.BoundaryPrompt,
+		History:        history,
+		Request:        request,
+	}, middlewareResults, nil
+}
+
+// PreviewTurn builds the chat request a new turn with the given content would
+// send to the bot's chat model, without calling the model or storing anything.
+// If convID is not uuid.Nil, the history of that conversation is included.
+func (h *Handler) PreviewTurn(ctx context.Context, bot *models.Bot, convID uuid.UUID, content string) (*api.PreviewBotResponse, error) {
+	turn := &models.Turn{
+		AppID:   bot.AppID,
+		ConvID:  convID,
+		BotID:   bot.ID,
+		Request: content,
+		Status:  api.TurnStatusInit,
+	}
+
+	history := []string{}
+	if convID != uuid.Nil {
+		c, err := h.getOrloadConversation(ctx, convID)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Lock()
+		history = c.historyText()
+		c.Unlock()
+	}
+
+	cm, chatReq, middlewareResults, err := h.prepareChat(ctx, bot, turn, history)
+	var canned cannedResponse
+	if errors.As(err, &canned) {
+		return &api.PreviewBotResponse{
+			ChatModel:         bot.ChatModel,
+			Messages:          []*api.ChatMessage{},
+			MiddlewareResults: middlewareResults,
+			Response:          string(canned),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := cm.CountChatTokens(chatReq)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := cm.ChatMessages(chatReq)
+	r := &api.PreviewBotResponse{
+		ChatModel:         bot.ChatModel,
+		Messages:          make([]*api.ChatMessage, len(messages)),
+		PromptTokens:      tokens,
+		MaxRequestTokens:  cm.MaxRequestTokens(),
+		MiddlewareResults: middlewareResults,
+	}
+	for i, m := range messages {
+		r.Messages[i] = &api.ChatMessage{
+			Role:    m.Role,
+			Content: m.Content,
+		}
+	}
+
+	return r, nil
+}
+
+// applyBotVersion sets the chat settings of the version of the turn to the
+// bot, which has the settings of the published version.
+func (h *Handler) applyBotVersion(ctx context.Context, bot *models.Bot, version int) error {
+	if version == 0 || version == bot.PublishedVersion {
+		return nil
+	}
+
+	v, err := h.sh.GetBotVersion(ctx, bot.ID, version)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return models.NewTurnError(api.TurnErrorCodeBotNotFound, fmt.Sprintf("bot version %d not found", version))
+	}
+	v.Apply(bot)
+	return nil
 }
 
 func (h *Handler) getOrloadConversation(ctx context.Context, convID uuid.UUID) (*conversation, error) {
@@ -302,7 +556,12 @@ func (c *conversation) historyText() []string {
 
 	text := make([]string, 0, len(c.history)*2)
 	for _, t := range c.history {
-		text = append(text, t.Request)
+		// the history has the requests the chat model saw
+		if t.RewrittenRequest != "" {
+			text = append(text, t.RewrittenRequest)
+		} else {
+			text = append(text, t.Request)
+		}
 		text = append(text, t.Response)
 	}
 	return text
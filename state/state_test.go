@@ -0,0 +1,206 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/internal/webhook"
+	"github.com/pandodao/botastic/models"
+	"github.com/pandodao/botastic/pkg/chanhub"
+	"github.com/pandodao/botastic/pkg/llms"
+	"github.com/pandodao/botastic/pkg/middleware"
+	"github.com/pandodao/botastic/storage"
+	"go.uber.org/zap"
+)
+
+// newTestHandler returns a state handler with a running worker, whose chat
+// model answers every request with answer.
+func newTestHandler(t *testing.T, answer string) (*Handler, *storage.Handler) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{
+				"message": map[string]string{"role": "assistant", "content": answer},
+			}},
+			"usage": map[string]int{"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	llmsh := llms.New(config.LLMsConfig{
+		Enabled: []string{"test"},
+		Items: map[string]config.LLMConfig{
+			"test": {
+				Provider: config.LLMProviderOpenAI,
+				OpenAI: &config.OpenAIConfig{
+					Key:        "key",
+					BaseURL:    srv.URL,
+					ChatModels: []string{"gpt-3.5-turbo"},
+				},
+			},
+		},
+	})
+
+	sh, err := storage.Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mh := middleware.New(sh, llmsh, []middleware.Middleware{middleware.NewRedact()}, []middleware.ResponseMiddleware{middleware.NewUnredact()})
+	d := webhook.New(config.WebhookConfig{MaxAttempts: 3, TimeoutSeconds: 10, WorkerCount: 1}, sh, zap.NewNop())
+	h := New(config.StateConfig{WorkerCount: 1}, zap.NewNop(), sh, llmsh, chanhub.New(), mh, d)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.handleTurnsWorker(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return h, sh
+}
+
+// processTurn creates a turn of a new conversation with the bot and waits
+// until it is processed.
+func processTurn(t *testing.T, h *Handler, sh *storage.Handler, bot *models.Bot, request string) *models.Turn {
+	ctx := context.Background()
+	conv := &models.Conv{ID: uuid.New(), AppID: bot.AppID, BotID: bot.ID}
+	if err := sh.CreateConv(ctx, conv); err != nil {
+		t.Fatal(err)
+	}
+	turn := &models.Turn{AppID: bot.AppID, ConvID: conv.ID, BotID: bot.ID, Request: request, Status: api.TurnStatusInit}
+	if err := sh.CreateTurn(ctx, turn); err != nil {
+		t.Fatal(err)
+	}
+	h.GetTurnsChan() <- turn
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		turn, err := sh.GetTurn(ctx, turn.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if turn.IsProcessed() {
+			return turn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("turn %d is not processed", turn.ID)
+	return nil
+}
+
+func TestHandleTurnWithTimeout(t *testing.T) {
+	h, sh := newTestHandler(t, "hello")
+	bot := &models.Bot{
+		AppID:          1,
+		Name:           "bot",
+		ChatModel:      "test:gpt-3.5-turbo",
+		Prompt:         "You are helpful.",
+		TimeoutSeconds: 10,
+		WebhookURL:     "https://example.com/hook",
+	}
+	if err := sh.CreateBot(context.Background(), bot); err != nil {
+		t.Fatal(err)
+	}
+
+	turn := processTurn(t, h, sh, bot, "hi")
+	if turn.Status != api.TurnStatusSuccess || turn.Response != "hello" || turn.TotalTokens != 5 {
+		t.Fatalf("turn = %+v, want it answered", turn)
+	}
+	ds, err := sh.GetDueWebhookDeliveries(context.Background(), time.Now(), 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 || ds[0].TurnID != turn.ID {
+		t.Fatalf("deliveries = %+v, want the turn notified", ds)
+	}
+}
+
+func TestHandleTurnPersistRedacted(t *testing.T) {
+	h, sh := newTestHandler(t, "I will write to [EMAIL_1].")
+	bot := &models.Bot{
+		AppID:      1,
+		Name:       "bot",
+		ChatModel:  "test:gpt-3.5-turbo",
+		Prompt:     "You are helpful.",
+		WebhookURL: "https://example.com/hook",
+		Middlewares: &models.MiddlewareConfig{
+			Items: []*api.Middleware{
+				{ID: "redact", Name: "redact", Options: map[string]string{"persist_redacted": "true"}},
+			},
+			ResponseItems: []*api.Middleware{
+				{ID: "unredact", Name: "unredact"},
+			},
+		},
+	}
+	if err := sh.CreateBot(context.Background(), bot); err != nil {
+		t.Fatal(err)
+	}
+
+	turn := processTurn(t, h, sh, bot, "write to alice@example.com")
+	if turn.Status != api.TurnStatusSuccess {
+		t.Fatalf("turn = %+v, want it answered", turn)
+	}
+	stored, err := json.Marshal(turn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(stored), "alice@example.com") {
+		t.Errorf("the turn is stored with the email: %s", stored)
+	}
+
+	ds, err := sh.GetDueWebhookDeliveries(context.Background(), time.Now(), 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 {
+		t.Fatalf("deliveries = %+v, want the turn notified", ds)
+	}
+	if strings.Contains(ds[0].Payload, "alice@example.com") || !strings.Contains(ds[0].Payload, "[EMAIL_1]") {
+		t.Errorf("the delivery is stored with the email: %s", ds[0].Payload)
+	}
+}
+
+// appMiddlewareHandler blocks every turn, recording the app of the turn.
+type appMiddlewareHandler struct {
+	MiddlewareHandler
+	appID uint
+}
+
+func (m *appMiddlewareHandler) Process(ctx context.Context, mc api.MiddlewareConfig, turn *models.Turn) ([]*api.MiddlewareResult, bool) {
+	m.appID = turn.AppID
+	return []*api.MiddlewareResult{{Code: api.MiddlewareErrorCodeBlocked, Response: "blocked"}}, false
+}
+
+func TestPreviewTurnApp(t *testing.T) {
+	mh := &appMiddlewareHandler{}
+	h := New(config.StateConfig{}, zap.NewNop(), nil, nil, chanhub.New(), mh, nil)
+	bot := &models.Bot{
+		AppID:       7,
+		Name:        "bot",
+		Middlewares: &models.MiddlewareConfig{Items: []*api.Middleware{{Name: "fetch"}}},
+	}
+
+	r, err := h.PreviewTurn(context.Background(), bot, uuid.Nil, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Response != "blocked" {
+		t.Errorf("response = %q, want the canned response", r.Response)
+	}
+	if mh.appID != bot.AppID {
+		t.Errorf("middlewares see app %d, want %d", mh.appID, bot.AppID)
+	}
+}
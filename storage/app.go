@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/pandodao/botastic/models"
+	"gorm.io/gorm"
+)
+
+func (h *Handler) CreateApp(ctx context.Context, app *models.App) error {
+	return h.db.WithContext(ctx).Create(app).Error
+}
+
+func (h *Handler) GetAppByAppID(ctx context.Context, appID uuid.UUID) (*models.App, error) {
+	app := &models.App{}
+	if err := h.db.WithContext(ctx).Where("app_id = ?", appID).First(app).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return app, nil
+}
+
+func (h *Handler) GetApps(ctx context.Context) ([]*models.App, error) {
+	var apps []*models.App
+	if err := h.db.WithContext(ctx).Find(&apps).Error; err != nil {
+		return nil, err
+	}
+
+	return apps, nil
+}
+
+func (h *Handler) UpdateAppSecretHash(ctx context.Context, appID uuid.UUID, secretHash string) (int64, error) {
+	r := h.db.WithContext(ctx).Model(&models.App{}).Where("app_id = ?", appID).Update("secret_hash", secretHash)
+	return r.RowsAffected, r.Error
+}
+
+func (h *Handler) DeleteApp(ctx context.Context, appID uuid.UUID) (int64, error) {
+	r := h.db.WithContext(ctx).Where("app_id = ?", appID).Delete(&models.App{})
+	return r.RowsAffected, r.Error
+}
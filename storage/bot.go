@@ -3,22 +3,83 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/pandodao/botastic/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// CreateBot creates the bot with its chat settings as the published first
+// version.
 func (h *Handler) CreateBot(ctx context.Context, bot *models.Bot) error {
-	return h.db.WithContext(ctx).Create(bot).Error
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(bot).Error; err != nil {
+			return err
+		}
+
+		v := models.NewBotVersion(bot)
+		if err := createBotVersion(tx, v); err != nil {
+			return err
+		}
+		if err := publishBotVersion(tx, v); err != nil {
+			return err
+		}
+		bot.PublishedVersion = v.Version
+		return nil
+	})
+}
+
+// ErrBotModified is returned when updating a bot that was updated since the
+// given time.
+var ErrBotModified = errors.New("bot was modified")
+
+// UpdateBotVersion updates the bot with m and stores v as its next version if
+// not nil, publishing it if asked. If updatedAt is not zero the bot is only
+// updated if it was not updated since, ErrBotModified is returned otherwise.
+func (h *Handler) UpdateBotVersion(ctx context.Context, appID, id uint, updatedAt time.Time, m map[string]any, v *models.BotVersion, publish bool) (int64, error) {
+	var rowsAffected int64
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if !updatedAt.IsZero() {
+			bot := &models.Bot{}
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("app_id = ? AND id = ?", appID, id).First(bot).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				return nil
+			case err != nil:
+				return err
+			case !bot.UpdatedAt.Equal(updatedAt):
+				return ErrBotModified
+			}
+		}
+
+		r := tx.Model(&models.Bot{}).Where("app_id = ? AND id = ?", appID, id).Updates(m)
+		if r.Error != nil || r.RowsAffected == 0 {
+			return r.Error
+		}
+		rowsAffected = r.RowsAffected
+
+		if v == nil {
+			return nil
+		}
+		if err := createBotVersion(tx, v); err != nil {
+			return err
+		}
+		if publish {
+			return publishBotVersion(tx, v)
+		}
+		return nil
+	})
+	return rowsAffected, err
 }
 
-func (h *Handler) UpdateBot(ctx context.Context, id uint, m map[string]any) (int64, error) {
-	r := h.db.Model(&models.Bot{}).Where("id = ?", id).Updates(m)
+func (h *Handler) UpdateBot(ctx context.Context, appID, id uint, m map[string]any) (int64, error) {
+	r := h.db.WithContext(ctx).Model(&models.Bot{}).Where("app_id = ? AND id = ?", appID, id).Updates(m)
 	return r.RowsAffected, r.Error
 }
 
-func (h *Handler) DeleteBot(ctx context.Context, id uint) error {
-	return h.db.WithContext(ctx).Delete(&models.Bot{}, id).Error
+func (h *Handler) DeleteBot(ctx context.Context, appID, id uint) error {
+	return h.db.WithContext(ctx).Where("app_id = ?", appID).Delete(&models.Bot{}, id).Error
 }
 
 func (h *Handler) GetBot(ctx context.Context, id uint) (*models.Bot, error) {
@@ -33,11 +94,23 @@ func (h *Handler) GetBot(ctx context.Context, id uint) (*models.Bot, error) {
 	return bot, nil
 }
 
-func (h *Handler) GetBots(ctx context.Context) ([]*models.Bot, error) {
+func (h *Handler) GetBots(ctx context.Context, appID uint) ([]*models.Bot, error) {
 	var bots []*models.Bot
-	if err := h.db.WithContext(ctx).Find(&bots).Error; err != nil {
+	if err := h.db.WithContext(ctx).Where("app_id = ?", appID).Find(&bots).Error; err != nil {
 		return nil, err
 	}
 
 	return bots, nil
 }
+
+func (h *Handler) GetBotByName(ctx context.Context, appID uint, name string) (*models.Bot, error) {
+	bot := &models.Bot{}
+	if err := h.db.WithContext(ctx).Where("app_id = ? AND name = ?", appID, name).First(bot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return bot, nil
+}
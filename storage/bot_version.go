@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pandodao/botastic/models"
+	"gorm.io/gorm"
+)
+
+// CreateBotVersion stores v as the next version of its bot.
+func (h *Handler) CreateBotVersion(ctx context.Context, v *models.BotVersion) error {
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createBotVersion(tx, v)
+	})
+}
+
+func createBotVersion(tx *gorm.DB, v *models.BotVersion) error {
+	var latest int
+	if err := tx.Model(&models.BotVersion{}).Where("bot_id = ?", v.BotID).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return err
+	}
+
+	v.Version = latest + 1
+	return tx.Create(v).Error
+}
+
+func (h *Handler) GetBotVersion(ctx context.Context, botID uint, version int) (*models.BotVersion, error) {
+	v := &models.BotVersion{}
+	if err := h.db.WithContext(ctx).Where("bot_id = ? AND version = ?", botID, version).First(v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// GetBotVersions returns the versions of the bot, latest first.
+func (h *Handler) GetBotVersions(ctx context.Context, botID uint) ([]*models.BotVersion, error) {
+	var versions []*models.BotVersion
+	if err := h.db.WithContext(ctx).Where("bot_id = ?", botID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// GetLatestBotVersion returns the latest version of the bot published before
+// the given version, or the latest version of all if before is 0.
+func (h *Handler) GetLatestBotVersion(ctx context.Context, botID uint, publishedBefore int) (*models.BotVersion, error) {
+	db := h.db.WithContext(ctx).Where("bot_id = ?", botID)
+	if publishedBefore > 0 {
+		db = db.Where("version < ? AND published_at IS NOT NULL", publishedBefore)
+	}
+
+	v := &models.BotVersion{}
+	if err := db.Order("version DESC").First(v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// PublishBotVersion copies the chat settings of the version to its bot.
+func (h *Handler) PublishBotVersion(ctx context.Context, v *models.BotVersion) error {
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return publishBotVersion(tx, v)
+	})
+}
+
+func publishBotVersion(tx *gorm.DB, v *models.BotVersion) error {
+	now := time.Now()
+	if err := tx.Model(v).Update("published_at", now).Error; err != nil {
+		return err
+	}
+	v.PublishedAt = &now
+
+	return tx.Model(&models.Bot{}).Where("id = ?", v.BotID).Updates(v.Columns()).Error
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pandodao/botastic/models"
@@ -17,8 +18,26 @@ func (h *Handler) CreateConv(ctx context.Context, conv *models.Conv) error {
 	return h.db.WithContext(ctx).Create(conv).Error
 }
 
-func (h *Handler) UpdateConv(ctx context.Context, id uuid.UUID, m map[string]any) (int64, error) {
-	r := h.db.Model(&models.Conv{}).Where("id = ?", id).Updates(m)
+// CreateConvWithTurns creates the conversation and its turns, in their order,
+// in one transaction.
+func (h *Handler) CreateConvWithTurns(ctx context.Context, conv *models.Conv, turns []*models.Turn) error {
+	if conv.ID == uuid.Nil {
+		conv.ID = uuid.New()
+	}
+
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(conv).Error; err != nil {
+			return err
+		}
+		for _, turn := range turns {
+			turn.ConvID = conv.ID
+		}
+		return tx.Create(turns).Error
+	})
+}
+
+func (h *Handler) UpdateConv(ctx context.Context, appID uint, id uuid.UUID, m map[string]any) (int64, error) {
+	r := h.db.WithContext(ctx).Model(&models.Conv{}).Where("app_id = ? AND id = ?", appID, id).Updates(m)
 	return r.RowsAffected, r.Error
 }
 
@@ -34,6 +53,47 @@ func (h *Handler) GetConv(ctx context.Context, id uuid.UUID) (*models.Conv, erro
 	return conv, nil
 }
 
-func (h *Handler) DeleteConv(ctx context.Context, id uuid.UUID) error {
-	return h.db.WithContext(ctx).Delete(&models.Conv{}, id).Error
+func (h *Handler) DeleteConv(ctx context.Context, appID uint, id uuid.UUID) error {
+	return h.db.WithContext(ctx).Where("app_id = ? AND id = ?", appID, id).Delete(&models.Conv{}).Error
+}
+
+type ListConvsParams struct {
+	AppID        uint
+	BotID        uint
+	UserIdentity string
+
+	// AfterCreatedAt and AfterID are the values of the last conversation of
+	// the previous page, zero values start from the first page.
+	AfterCreatedAt time.Time
+	AfterID        uuid.UUID
+	Limit          int
+	Desc           bool
+}
+
+func (h *Handler) ListConvs(ctx context.Context, p ListConvsParams) ([]*models.Conv, error) {
+	q := h.db.WithContext(ctx).Where("app_id = ?", p.AppID)
+	if p.BotID != 0 {
+		q = q.Where("bot_id = ?", p.BotID)
+	}
+	if p.UserIdentity != "" {
+		q = q.Where("user_identity = ?", p.UserIdentity)
+	}
+
+	op, order := ">", "created_at, id"
+	if p.Desc {
+		op, order = "<", "created_at DESC, id DESC"
+	}
+	if p.AfterID != uuid.Nil {
+		// sqlite compares the times as text, in the local time zone they
+		// are created in
+		after := p.AfterCreatedAt.Local()
+		q = q.Where("created_at "+op+" ? OR (created_at = ? AND id "+op+" ?)", after, after, p.AfterID)
+	}
+
+	var convs []*models.Conv
+	if err := q.Order(order).Limit(p.Limit).Find(&convs).Error; err != nil {
+		return nil, err
+	}
+
+	return convs, nil
 }
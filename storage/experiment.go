@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrExperimentRunning is returned when creating an experiment of a bot which
+// runs another one.
+var ErrExperimentRunning = errors.New("an experiment of the bot is running")
+
+// CreateExperiment creates the experiment unless another experiment of the
+// bot is running, ErrExperimentRunning is returned then.
+func (h *Handler) CreateExperiment(ctx context.Context, e *models.Experiment) error {
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the bot is locked so that its experiments are created one at a time
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", e.BotID).First(&models.Bot{}).Error; err != nil {
+			return err
+		}
+
+		running := &models.Experiment{}
+		err := tx.Where("bot_id = ? AND stopped_at IS NULL", e.BotID).First(running).Error
+		switch {
+		case err == nil:
+			return fmt.Errorf("experiment %d: %w", running.ID, ErrExperimentRunning)
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		return tx.Create(e).Error
+	})
+}
+
+func (h *Handler) GetExperiment(ctx context.Context, id uint) (*models.Experiment, error) {
+	e := &models.Experiment{}
+	if err := h.db.WithContext(ctx).Where("id = ?", id).First(e).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// GetExperiments returns the experiments of the app, of the bot if botID is
+// not 0, latest first.
+func (h *Handler) GetExperiments(ctx context.Context, appID, botID uint) ([]*models.Experiment, error) {
+	db := h.db.WithContext(ctx).Where("app_id = ?", appID)
+	if botID != 0 {
+		db = db.Where("bot_id = ?", botID)
+	}
+
+	var experiments []*models.Experiment
+	if err := db.Order("id DESC").Find(&experiments).Error; err != nil {
+		return nil, err
+	}
+
+	return experiments, nil
+}
+
+func (h *Handler) GetRunningExperiment(ctx context.Context, botID uint) (*models.Experiment, error) {
+	e := &models.Experiment{}
+	if err := h.db.WithContext(ctx).Where("bot_id = ? AND stopped_at IS NULL", botID).First(e).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (h *Handler) StopExperiment(ctx context.Context, e *models.Experiment) error {
+	now := time.Now()
+	if err := h.db.WithContext(ctx).Model(e).Update("stopped_at", now).Error; err != nil {
+		return err
+	}
+
+	e.StoppedAt = &now
+	return nil
+}
+
+// CountExperimentConvs returns the number of conversations of each variant of
+// the experiment.
+func (h *Handler) CountExperimentConvs(ctx context.Context, experimentID uint) (map[string]int64, error) {
+	var rows []struct {
+		Variant string
+		Count   int64
+	}
+	if err := h.db.WithContext(ctx).Model(&models.Conv{}).
+		Select("variant, COUNT(*) AS count").
+		Where("experiment_id = ?", experimentID).
+		Group("variant").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Variant] = r.Count
+	}
+	return counts, nil
+}
+
+// EachExperimentTurn calls fn with the processed turns of the conversations
+// of the experiment and their variant. Only the status, token and processing
+// time fields of the turns are loaded.
+func (h *Handler) EachExperimentTurn(ctx context.Context, experimentID uint, fn func(variant string, turn *models.Turn) error) error {
+	db := h.db.WithContext(ctx)
+	rows, err := db.Model(&models.Turn{}).
+		Select("turns.id, turns.status, turns.prompt_tokens, turns.completion_tokens, turns.total_tokens, turns.processing_started_at, turns.processed_at, convs.variant").
+		Joins("JOIN convs ON convs.id = turns.conv_id").
+		Where("convs.experiment_id = ? AND turns.status IN ?", experimentID, []api.TurnStatus{api.TurnStatusSuccess, api.TurnStatusFailed}).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r struct {
+			models.Turn
+			Variant string
+		}
+		if err := db.ScanRows(rows, &r); err != nil {
+			return err
+		}
+		if err := fn(r.Variant, &r.Turn); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+)
+
+func TestCreateExperiment(t *testing.T) {
+	ctx := context.Background()
+	sh, err := Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := &models.Bot{AppID: 1, Name: "bot", ChatModel: "openai:gpt-3.5-turbo"}
+	if err := sh.CreateBot(ctx, bot); err != nil {
+		t.Fatal(err)
+	}
+
+	first := &models.Experiment{AppID: 1, BotID: bot.ID, Name: "first"}
+	if err := sh.CreateExperiment(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.CreateExperiment(ctx, &models.Experiment{AppID: 1, BotID: bot.ID, Name: "second"}); !errors.Is(err, ErrExperimentRunning) {
+		t.Fatalf("err = %v, want ErrExperimentRunning", err)
+	}
+	if err := sh.StopExperiment(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent experiments of the bot, at most one is created
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sh.CreateExperiment(ctx, &models.Experiment{AppID: 1, BotID: bot.ID, Name: "concurrent"})
+		}()
+	}
+	wg.Wait()
+	experiments, err := sh.GetExperiments(ctx, 1, bot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := 0
+	for _, e := range experiments {
+		if e.Running() {
+			running++
+		}
+	}
+	if running != 1 {
+		t.Errorf("%d experiments are running, want 1", running)
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/models"
+	"gorm.io/gorm"
+)
+
+// SaveFeedback creates the feedback of the turn, or replaces the rating, tags
+// and correction of its existing one.
+func (h *Handler) SaveFeedback(ctx context.Context, f *models.Feedback) error {
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		old := &models.Feedback{}
+		err := tx.Where("turn_id = ?", f.TurnID).First(old).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return tx.Create(f).Error
+		case err != nil:
+			return err
+		}
+
+		f.Model = old.Model
+		return tx.Select("rating", "tags", "correction", "updated_at").Updates(f).Error
+	})
+}
+
+func (h *Handler) GetTurnFeedback(ctx context.Context, turnID uint) (*models.Feedback, error) {
+	f := &models.Feedback{}
+	if err := h.db.WithContext(ctx).Where("turn_id = ?", turnID).First(f).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// GetTurnsFeedback returns the feedback of the turns by turn id, turns without
+// feedback are left out.
+func (h *Handler) GetTurnsFeedback(ctx context.Context, turnIDs []uint) (map[uint]*models.Feedback, error) {
+	r := make(map[uint]*models.Feedback, len(turnIDs))
+	if len(turnIDs) == 0 {
+		return r, nil
+	}
+
+	var feedback []*models.Feedback
+	if err := h.db.WithContext(ctx).Where("turn_id IN ?", turnIDs).Find(&feedback).Error; err != nil {
+		return nil, err
+	}
+	for _, f := range feedback {
+		r[f.TurnID] = f
+	}
+	return r, nil
+}
+
+type ListFeedbackParams struct {
+	BotID  uint
+	Rating api.FeedbackRating
+
+	// AfterID is the id of the last feedback of the previous page, 0 starts
+	// from the first page.
+	AfterID uint
+	Limit   int
+	Desc    bool
+}
+
+func (h *Handler) ListFeedback(ctx context.Context, p ListFeedbackParams) ([]*models.Feedback, error) {
+	q := h.db.WithContext(ctx).Where("bot_id = ?", p.BotID)
+	if p.Rating != 0 {
+		q = q.Where("rating = ?", p.Rating)
+	}
+
+	op, order := ">", "id"
+	if p.Desc {
+		op, order = "<", "id DESC"
+	}
+	if p.AfterID != 0 {
+		q = q.Where("id "+op+" ?", p.AfterID)
+	}
+
+	var feedback []*models.Feedback
+	if err := q.Order(order).Limit(p.Limit).Find(&feedback).Error; err != nil {
+		return nil, err
+	}
+
+	return feedback, nil
+}
+
+// EachBotFeedback calls fn with every feedback of the bot.
+func (h *Handler) EachBotFeedback(ctx context.Context, botID uint, fn func(*models.Feedback) error) error {
+	db := h.db.WithContext(ctx)
+	rows, err := db.Model(&models.Feedback{}).Where("bot_id = ?", botID).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f models.Feedback
+		if err := db.ScanRows(rows, &f); err != nil {
+			return err
+		}
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountExperimentFeedback returns the number of feedback of each rating in
+// the conversations of each variant of the experiment.
+func (h *Handler) CountExperimentFeedback(ctx context.Context, experimentID uint) (map[string]map[api.FeedbackRating]int64, error) {
+	var rows []struct {
+		Variant string
+		Rating  api.FeedbackRating
+		Count   int64
+	}
+	if err := h.db.WithContext(ctx).Model(&models.Feedback{}).
+		Select("convs.variant, feedbacks.rating, COUNT(*) AS count").
+		Joins("JOIN convs ON convs.id = feedbacks.conv_id").
+		Where("convs.experiment_id = ?", experimentID).
+		Group("convs.variant, feedbacks.rating").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]map[api.FeedbackRating]int64)
+	for _, r := range rows {
+		if counts[r.Variant] == nil {
+			counts[r.Variant] = make(map[api.FeedbackRating]int64)
+		}
+		counts[r.Variant][r.Rating] = r.Count
+	}
+	return counts, nil
+}
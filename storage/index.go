@@ -44,16 +44,24 @@ func (h *Handler) DeleteIndexes(ctx context.Context, ids []uint) error {
 	return h.db.WithContext(ctx).Where("id IN (?)", ids).Delete(&models.Index{}).Error
 }
 
-func (h *Handler) GetIndexesByGroupKey(ctx context.Context, groupKey string) ([]*models.Index, error) {
+func (h *Handler) GetIndexesByGroupKey(ctx context.Context, appID uint, groupKey string) ([]*models.Index, error) {
 	var indexes []*models.Index
-	if err := h.db.WithContext(ctx).Where("group_key = ?", groupKey).Find(&indexes).Error; err != nil {
+	if err := h.db.WithContext(ctx).Where("app_id = ? AND group_key = ?", appID, groupKey).Find(&indexes).Error; err != nil {
 		return nil, err
 	}
 	return indexes, nil
 }
 
-func (h *Handler) SearchIndexes(ctx context.Context, groupKey string, data []float32, limit int) ([]*models.Index, error) {
-	indexes, err := h.GetIndexesByGroupKey(ctx, groupKey)
+func (h *Handler) CountIndexesByGroupKey(ctx context.Context, appID uint, groupKey string) (int64, error) {
+	var count int64
+	if err := h.db.WithContext(ctx).Model(&models.Index{}).Where("app_id = ? AND group_key = ?", appID, groupKey).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (h *Handler) SearchIndexes(ctx context.Context, appID uint, groupKey string, data []float32, limit int) ([]*models.Index, error) {
+	indexes, err := h.GetIndexesByGroupKey(ctx, appID, groupKey)
 	if err != nil {
 		return nil, err
 	}
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"errors"
+
 	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/mattn/go-sqlite3"
 	"github.com/pandodao/botastic/config"
 	"github.com/pandodao/botastic/models"
 	"gorm.io/driver/mysql"
@@ -10,6 +13,174 @@ import (
 	"gorm.io/gorm"
 )
 
+// migrations are applied to databases created before InitSchema changed,
+// fresh databases get the latest schema from InitSchema directly.
+var migrations = []*gormigrate.Migration{
+	{
+		ID: "0001_add_apps",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.App{}, &models.Conv{}, &models.Turn{}, &models.Bot{}, &models.Index{})
+		},
+	},
+	{
+		ID: "0002_add_app_quotas",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.App{})
+		},
+	},
+	{
+		ID: "0003_add_webhooks",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Bot{}, &models.Conv{}, &models.WebhookDelivery{})
+		},
+	},
+	{
+		ID: "0004_add_bot_versions",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&models.BotVersion{}, &models.Bot{}, &models.Conv{}, &models.Turn{}); err != nil {
+				return err
+			}
+
+			// the current settings of existing bots become their first version
+			var bots []*models.Bot
+			if err := tx.Find(&bots).Error; err != nil {
+				return err
+			}
+			for _, bot := range bots {
+				v := models.NewBotVersion(bot)
+				if err := createBotVersion(tx, v); err != nil {
+					return err
+				}
+				if err := publishBotVersion(tx, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "0005_add_experiments",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Experiment{}, &models.Conv{})
+		},
+	},
+	{
+		ID: "0006_add_feedback",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Feedback{})
+		},
+	},
+	{
+		ID: "0007_add_turn_rewritten_request",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Turn{})
+		},
+	},
+	{
+		ID: "0008_move_to_default_app",
+		Migrate: func(tx *gorm.DB) error {
+			if err := moveToDefaultApp(tx); err != nil {
+				return err
+			}
+			return scopeBotNamesToApps(tx)
+		},
+	},
+	{
+		ID: "0009_add_turn_processing_times",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Turn{})
+		},
+	},
+}
+
+// DefaultAppName is the name of the app the rows created before there were
+// apps are moved to.
+const DefaultAppName = "default"
+
+// appScopedModels are the models that belong to an app.
+var appScopedModels = []any{
+	&models.Bot{}, &models.BotVersion{}, &models.Conv{}, &models.Turn{}, &models.Index{},
+	&models.Experiment{}, &models.Feedback{}, &models.WebhookDelivery{},
+}
+
+// moveToDefaultApp moves the rows created before there were apps, which have
+// no app, to a new default app. Its secret is not known, it has to be reset
+// to use the app.
+func moveToDefaultApp(tx *gorm.DB) error {
+	noApp := "app_id IS NULL OR app_id = 0"
+	found := false
+	for _, m := range appScopedModels {
+		var count int64
+		if err := tx.Unscoped().Model(m).Where(noApp).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	app, _, err := models.NewApp(DefaultAppName)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(app).Error; err != nil {
+		return err
+	}
+	for _, m := range appScopedModels {
+		if err := tx.Unscoped().Model(m).Where(noApp).UpdateColumn("app_id", app.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopeBotNamesToApps replaces the unique index on the names of the bots,
+// which bots had before there were apps, with the unique index on the app and
+// name.
+func scopeBotNamesToApps(tx *gorm.DB) error {
+	var err error
+	switch config.DBDriver(tx.Dialector.Name()) {
+	case config.DBMysql:
+		if tx.Migrator().HasIndex(&models.Bot{}, "name") {
+			err = tx.Migrator().DropIndex(&models.Bot{}, "name")
+		}
+	case config.DBPostgres:
+		err = tx.Exec("ALTER TABLE bots DROP CONSTRAINT IF EXISTS bots_name_key").Error
+	case config.DBSqlite:
+		// the index of a unique column cannot be dropped, the table is
+		// rebuilt with the column as it is now, without its indexes
+		var count int64
+		err = tx.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = 'bots' AND name LIKE 'sqlite_autoindex_bots_%'").Scan(&count).Error
+		if err == nil && count > 0 {
+			err = tx.Migrator().AlterColumn(&models.Bot{}, "Name")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// creates the missing indexes, including the one on the app and name
+	return tx.AutoMigrate(&models.Bot{})
+}
+
+// sqliteDialector fixes the error translation of the sqlite driver, which
+// only translates *sqlite3.Error while the errors are sqlite3.Error values.
+type sqliteDialector struct {
+	*sqlite.Dialector
+}
+
+func (d sqliteDialector) Translate(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return gorm.ErrDuplicatedKey
+	}
+	return err
+}
+
 type Handler struct {
 	cfg config.DBConfig
 	db  *gorm.DB
@@ -19,14 +190,17 @@ func Init(cfg config.DBConfig) (*Handler, error) {
 	var dialector gorm.Dialector
 	switch cfg.Driver {
 	case config.DBSqlite:
-		dialector = sqlite.Open(cfg.DSN)
+		dialector = sqliteDialector{sqlite.Open(cfg.DSN).(*sqlite.Dialector)}
 	case config.DBMysql:
 		dialector = mysql.Open(cfg.DSN)
 	case config.DBPostgres:
 		dialector = postgres.Open(cfg.DSN)
 	}
 
-	db, err := gorm.Open(dialector, &gorm.Config{})
+	db, err := gorm.Open(dialector, &gorm.Config{
+		// unique constraint violations are returned as gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -35,9 +209,9 @@ func Init(cfg config.DBConfig) (*Handler, error) {
 		db = db.Debug()
 	}
 
-	m := gormigrate.New(db, gormigrate.DefaultOptions, []*gormigrate.Migration{})
+	m := gormigrate.New(db, gormigrate.DefaultOptions, migrations)
 	m.InitSchema(func(tx *gorm.DB) error {
-		return tx.AutoMigrate(&models.Conv{}, &models.Turn{}, &models.Bot{}, &models.Index{})
+		return tx.AutoMigrate(&models.App{}, &models.Conv{}, &models.Turn{}, &models.Bot{}, &models.Index{}, &models.WebhookDelivery{}, &models.BotVersion{}, &models.Experiment{}, &models.Feedback{})
 	})
 
 	if err := m.Migrate(); err != nil {
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/pandodao/botastic/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMoveToDefaultApp(t *testing.T) {
+	db, err := gorm.Open(sqliteDialector{sqlite.Open("file:" + t.Name() + "?mode=memory&cache=shared").(*sqlite.Dialector)}, &gorm.Config{
+		Logger:         logger.Discard,
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(append([]any{&models.App{}}, appScopedModels...)...); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bots of before there were apps, with unique names and no app
+	for _, q := range []string{
+		"DROP TABLE bots",
+		"CREATE TABLE `bots` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`chat_model` varchar(128),`name` varchar(128) UNIQUE,`prompt` text,`boundary_prompt` text,`context_turn_count` integer,`temperature` real,`timeout_seconds` integer,`middlewares` json,`app_id` integer,`webhook_url` varchar(1024),`webhook_secret` varchar(255),`published_version` integer,PRIMARY KEY (`id`))",
+		"CREATE INDEX `idx_bots_deleted_at` ON `bots`(`deleted_at`)",
+		"INSERT INTO bots (id, name) VALUES (1, 'a'), (2, 'b')",
+		"INSERT INTO bots (id, name, deleted_at) VALUES (3, 'c', '2023-01-01')",
+		"INSERT INTO convs (id, bot_id) VALUES ('11111111-1111-1111-1111-111111111111', 1)",
+		"INSERT INTO indexes (id, group_key, app_id) VALUES (1, 'docs', 0)",
+	} {
+		if err := db.Exec(q).Error; err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := moveToDefaultApp(tx); err != nil {
+			return err
+		}
+		return scopeBotNamesToApps(tx)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var apps []*models.App
+	if err := db.Find(&apps).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || apps[0].Name != DefaultAppName {
+		t.Fatalf("apps = %+v", apps)
+	}
+	appID := apps[0].ID
+	for _, table := range []string{"bots", "convs", "indexes"} {
+		var count int64
+		if err := db.Table(table).Where("app_id IS NULL OR app_id <> ?", appID).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%d rows of %s are not moved to the default app", count, table)
+		}
+	}
+
+	for _, index := range []string{"idx_bots_app_id_name", "idx_bots_deleted_at"} {
+		if !db.Migrator().HasIndex(&models.Bot{}, index) {
+			t.Errorf("bots have no %s", index)
+		}
+	}
+	if err := db.Create(&models.Bot{AppID: appID + 1, Name: "a"}).Error; err != nil {
+		t.Errorf("the names of the bots are still unique across apps: %v", err)
+	}
+	if err := db.Create(&models.Bot{AppID: appID, Name: "a"}).Error; err != gorm.ErrDuplicatedKey {
+		t.Errorf("the names of the bots are not unique in an app: %v", err)
+	}
+
+	// nothing is left to move the next time
+	if err := moveToDefaultApp(db); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.App{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d apps, want 1", count)
+	}
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pandodao/botastic/api"
@@ -14,14 +15,33 @@ func (h *Handler) CreateTurn(ctx context.Context, turn *models.Turn) error {
 	return h.db.WithContext(ctx).Create(turn).Error
 }
 
+// CreateTurns creates the turns at once, in their order.
+func (h *Handler) CreateTurns(ctx context.Context, turns []*models.Turn) error {
+	return h.db.WithContext(ctx).Create(turns).Error
+}
+
 func (h *Handler) GetTurnCount(ctx context.Context, convId uuid.UUID, status api.TurnStatus) (int64, error) {
 	var count int64
 	return count, h.db.WithContext(ctx).Model(&models.Turn{}).Where("conv_id = ? AND status = ?", convId, int(status)).Count(&count).Error
 }
 
+// SumTurnTokens returns the total tokens used by the turns of the app created
+// since the given time. If userIdentity is not empty, only the turns of the
+// conversations of that user are counted.
+func (h *Handler) SumTurnTokens(ctx context.Context, appID uint, userIdentity string, since time.Time) (int64, error) {
+	var sum int64
+	q := h.db.WithContext(ctx).Model(&models.Turn{}).
+		Select("COALESCE(SUM(turns.total_tokens), 0)").
+		Where("turns.app_id = ? AND turns.created_at >= ?", appID, since)
+	if userIdentity != "" {
+		q = q.Joins("JOIN convs ON convs.id = turns.conv_id").Where("convs.user_identity = ?", userIdentity)
+	}
+	return sum, q.Scan(&sum).Error
+}
+
 func (h *Handler) GetTurns(ctx context.Context, convId uuid.UUID, status api.TurnStatus, limit int) ([]*models.Turn, error) {
 	var turns []*models.Turn
-	if err := h.db.WithContext(ctx).Where("conv_id = ? AND status = ?", convId, int(status)).Limit(limit).Order("created_at DESC").Find(&turns).Error; err != nil {
+	if err := h.db.WithContext(ctx).Where("conv_id = ? AND status = ?", convId, int(status)).Limit(limit).Order("created_at DESC, id DESC").Find(&turns).Error; err != nil {
 		return nil, err
 	}
 
@@ -41,27 +61,60 @@ func (h *Handler) GetTurnsByStatus(ctx context.Context, status []api.TurnStatus)
 	return turns, nil
 }
 
-func (h *Handler) UpdateTurnToSuccess(ctx context.Context, id uint, response string, promptTokens, completionTokens, totalTokens int, mr models.MiddlewareResults) error {
-	return h.db.WithContext(ctx).Model(&models.Turn{}).Where("id = ?", id).Updates(map[string]any{
+func (h *Handler) UpdateTurnToSuccess(ctx context.Context, id uint, response string, promptTokens, completionTokens, totalTokens int, mr models.MiddlewareResults, delivery *models.WebhookDelivery) error {
+	return h.updateProcessedTurn(ctx, id, map[string]any{
 		"status":             int(api.TurnStatusSuccess),
 		"response":           response,
 		"prompt_tokens":      promptTokens,
 		"completion_tokens":  completionTokens,
 		"total_tokens":       totalTokens,
 		"middleware_results": mr,
-	}).Error
+	}, delivery)
 }
 
-func (h *Handler) UpdateTurnToFailed(ctx context.Context, id uint, err *models.TurnError, mr models.MiddlewareResults) error {
-	return h.db.WithContext(ctx).Model(&models.Turn{}).Where("id = ?", id).Updates(map[string]any{
+// UpdateTurnToFailed fails the turn, the tokens are those spent anyway, e.g.
+// on a rejected response.
+func (h *Handler) UpdateTurnToFailed(ctx context.Context, id uint, err *models.TurnError, promptTokens, completionTokens, totalTokens int, mr models.MiddlewareResults, delivery *models.WebhookDelivery) error {
+	return h.updateProcessedTurn(ctx, id, map[string]any{
 		"status":             int(api.TurnStatusFailed),
 		"error":              err,
+		"prompt_tokens":      promptTokens,
+		"completion_tokens":  completionTokens,
+		"total_tokens":       totalTokens,
 		"middleware_results": mr,
+	}, delivery)
+}
+
+// updateProcessedTurn updates the processed turn and creates the webhook
+// delivery notifying it, if any, in the same transaction.
+func (h *Handler) updateProcessedTurn(ctx context.Context, id uint, m map[string]any, delivery *models.WebhookDelivery) error {
+	m["processed_at"] = time.Now()
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Turn{}).Where("id = ?", id).Updates(m).Error; err != nil {
+			return err
+		}
+		if delivery == nil {
+			return nil
+		}
+		return tx.Create(delivery).Error
+	})
+}
+
+// UpdateTurnRequest sets the request of the turn, e.g. to the redacted one,
+// and the request rewritten by middlewares.
+func (h *Handler) UpdateTurnRequest(ctx context.Context, id uint, request, rewrittenRequest string) error {
+	return h.db.WithContext(ctx).Model(&models.Turn{}).Where("id = ?", id).Updates(map[string]any{
+		"request":           request,
+		"rewritten_request": rewrittenRequest,
 	}).Error
 }
 
+// UpdateTurnToProcessing also (re)starts the processing time of the turn.
 func (h *Handler) UpdateTurnToProcessing(ctx context.Context, id uint) error {
-	return h.db.WithContext(ctx).Model(&models.Turn{}).Where("id = ?", id).Update("status", int(api.TurnStatusProcessing)).Error
+	return h.db.WithContext(ctx).Model(&models.Turn{}).Where("id = ?", id).Updates(map[string]any{
+		"status":                int(api.TurnStatusProcessing),
+		"processing_started_at": time.Now(),
+	}).Error
 }
 
 func (h *Handler) GetTurn(ctx context.Context, id uint) (*models.Turn, error) {
@@ -75,3 +128,49 @@ func (h *Handler) GetTurn(ctx context.Context, id uint) (*models.Turn, error) {
 
 	return &turn, nil
 }
+
+type ListTurnsParams struct {
+	ConvID uuid.UUID
+	Status []api.TurnStatus
+	// Since and Until filter turns by creation time when not zero.
+	Since time.Time
+	Until time.Time
+
+	// AfterID is the id of the last turn of the previous page, 0 starts from
+	// the first page.
+	AfterID uint
+	Limit   int
+	Desc    bool
+}
+
+func (h *Handler) ListTurns(ctx context.Context, p ListTurnsParams) ([]*models.Turn, error) {
+	q := h.db.WithContext(ctx).Where("conv_id = ?", p.ConvID)
+	if len(p.Status) > 0 {
+		ss := make([]int, 0, len(p.Status))
+		for _, s := range p.Status {
+			ss = append(ss, int(s))
+		}
+		q = q.Where("status IN (?)", ss)
+	}
+	if !p.Since.IsZero() {
+		q = q.Where("created_at >= ?", p.Since)
+	}
+	if !p.Until.IsZero() {
+		q = q.Where("created_at < ?", p.Until)
+	}
+
+	op, order := ">", "id"
+	if p.Desc {
+		op, order = "<", "id DESC"
+	}
+	if p.AfterID != 0 {
+		q = q.Where("id "+op+" ?", p.AfterID)
+	}
+
+	var turns []*models.Turn
+	if err := q.Order(order).Limit(p.Limit).Find(&turns).Error; err != nil {
+		return nil, err
+	}
+
+	return turns, nil
+}
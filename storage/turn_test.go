@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pandodao/botastic/api"
+	"github.com/pandodao/botastic/config"
+	"github.com/pandodao/botastic/models"
+)
+
+func TestTurnProcessingTimes(t *testing.T) {
+	ctx := context.Background()
+	sh, err := Init(config.DBConfig{
+		Driver: config.DBSqlite,
+		DSN:    "file:" + t.Name() + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	turn := &models.Turn{AppID: 1, BotID: 1, Request: "hi", Status: api.TurnStatusInit}
+	if err := sh.CreateTurn(ctx, turn); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.UpdateTurnToProcessing(ctx, turn.ID); err != nil {
+		t.Fatal(err)
+	}
+	if turn, err = sh.GetTurn(ctx, turn.ID); err != nil {
+		t.Fatal(err)
+	}
+	if turn.ProcessingStartedAt == nil || turn.ProcessedAt != nil {
+		t.Fatalf("processing turn: started at %v, processed at %v", turn.ProcessingStartedAt, turn.ProcessedAt)
+	}
+
+	if err := sh.UpdateTurnToSuccess(ctx, turn.ID, "hello", 1, 1, 2, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if turn, err = sh.GetTurn(ctx, turn.ID); err != nil {
+		t.Fatal(err)
+	}
+	if turn.ProcessedAt == nil || turn.ProcessedAt.Before(*turn.ProcessingStartedAt) {
+		t.Fatalf("processed turn: started at %v, processed at %v", turn.ProcessingStartedAt, turn.ProcessedAt)
+	}
+}
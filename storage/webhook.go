@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/pandodao/botastic/models"
+)
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is due,
+// except those to the given urls.
+func (h *Handler) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int, exceptURLs []string) ([]*models.WebhookDelivery, error) {
+	var ds []*models.WebhookDelivery
+	db := h.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", int(models.WebhookDeliveryStatusPending), now)
+	if len(exceptURLs) > 0 {
+		db = db.Where("url NOT IN ?", exceptURLs)
+	}
+	if err := db.Order("next_attempt_at").Order("id").Limit(limit).Find(&ds).Error; err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+func (h *Handler) UpdateWebhookDelivery(ctx context.Context, id uint, m map[string]any) error {
+	return h.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("id = ?", id).Updates(m).Error
+}